@@ -0,0 +1,153 @@
+package gabi
+
+import (
+	"sort"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+)
+
+// AttributeCommitment is a Damgård-Fujisaki commitment C = R_i^m S^r to an undisclosed attribute m
+// of a ProofD, in the group of the issuer public key, along with the response for r of the proof
+// that C commits to the same attribute as the ProofD. The response for m is the response of the
+// attribute in the ProofD.
+type AttributeCommitment struct {
+	C         *big.Int `json:"C"`
+	RResponse *big.Int `json:"r_response"`
+}
+
+// AttributeCommitmentOpening is the opening of an AttributeCommitment, which the holder can use
+// in protocols outside of gabi. Attribute is the exponent with which the attribute is proven, i.e.,
+// the attribute itself or its hash if it is too large.
+type AttributeCommitmentOpening struct {
+	Index      int      `json:"index"`
+	Commitment *big.Int `json:"C"`
+	Attribute  *big.Int `json:"attribute"`
+	Randomness *big.Int `json:"randomness"`
+}
+
+type attributeCommitmentBuilder struct {
+	opening    *AttributeCommitmentOpening
+	randomizer *big.Int
+}
+
+// Verify checks that the opening opens its commitment, using the specified issuer public key.
+func (o *AttributeCommitmentOpening) Verify(pk *gabikeys.PublicKey) bool {
+	if o.Index < 0 || o.Index >= len(pk.R) {
+		return false
+	}
+	return commitToAttribute(pk, o.Index, o.Attribute, o.Randomness).Cmp(o.Commitment) == 0
+}
+
+// commitToAttribute computes R_i^m S^r.
+func commitToAttribute(pk *gabikeys.PublicKey, index int, m, r *big.Int) *big.Int {
+	c := pk.ExpModN(pk.R[index], m)
+	return c.Mul(c, pk.ExpModN(pk.S, r)).Mod(c, pk.N)
+}
+
+// CommitToAttribute makes the builder include in its ProofD a commitment to the undisclosed
+// attribute at the specified index, along with a proof that it commits to the same attribute. It
+// returns the opening of the commitment, which the holder should keep for later use. It must be
+// called before the builder is committed. The secret key cannot be committed to, as it may be
+// shared with a keyshare server.
+func (d *DisclosureProofBuilder) CommitToAttribute(index int) (*AttributeCommitmentOpening, error) {
+	if index <= 0 || index >= len(d.attributes) || !isUndisclosedAttribute(d.disclosedAttributes, index) {
+		return nil, errors.New("can only commit to undisclosed attributes other than the secret key")
+	}
+	if _, ok := d.attrCommitments[index]; ok {
+		return nil, errors.New("attribute already committed to")
+	}
+	r, err := common.RandomBigIntFrom(d.random, d.pk.Params.LvPrime)
+	if err != nil {
+		return nil, err
+	}
+	randomizer, err := common.RandomBigIntFrom(d.random, d.pk.Params.LvPrimeCommit)
+	if err != nil {
+		return nil, err
+	}
+	m := d.attributeExponent(index)
+	opening := &AttributeCommitmentOpening{
+		Index:      index,
+		Commitment: commitToAttribute(d.pk, index, m, r),
+		Attribute:  new(big.Int).Set(m),
+		Randomness: r,
+	}
+	if d.attrCommitments == nil {
+		d.attrCommitments = make(map[int]*attributeCommitmentBuilder)
+	}
+	d.attrCommitments[index] = &attributeCommitmentBuilder{opening: opening, randomizer: randomizer}
+	return opening, nil
+}
+
+// attributeCommitmentIndices returns the keys of the specified map in ascending order.
+func attributeCommitmentIndices(m map[int]*AttributeCommitment) []int {
+	indices := make([]int, 0, len(m))
+	for index := range m {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// commitAttributeCommitments returns the commitments of the proofs of the attribute commitments,
+// i.e. C and R_i^{m_commit} S^{r_commit} per attribute commitment, in order of attribute index.
+func (d *DisclosureProofBuilder) commitAttributeCommitments() []*big.Int {
+	var list []*big.Int
+	for index := 0; index < len(d.attributes); index++ {
+		b, ok := d.attrCommitments[index]
+		if !ok {
+			continue
+		}
+		list = append(list, b.opening.Commitment,
+			commitToAttribute(d.pk, index, d.attrRandomizers[index], b.randomizer))
+	}
+	return list
+}
+
+// createAttributeCommitments creates the attribute commitment proofs with the provided challenge.
+func (d *DisclosureProofBuilder) createAttributeCommitments(challenge *big.Int) map[int]*AttributeCommitment {
+	if d.attrCommitments == nil {
+		return nil
+	}
+	commitments := make(map[int]*AttributeCommitment, len(d.attrCommitments))
+	for index, b := range d.attrCommitments {
+		response := new(big.Int).Mul(challenge, b.opening.Randomness)
+		commitments[index] = &AttributeCommitment{
+			C:         new(big.Int).Set(b.opening.Commitment),
+			RResponse: response.Add(b.randomizer, response),
+		}
+	}
+	return commitments
+}
+
+// attributeCommitmentContributions reconstructs the commitments of the proofs of the attribute
+// commitments of the ProofD, i.e. C and C^{-c} R_i^{s_m} S^{s_r} per attribute commitment.
+func (p *ProofD) attributeCommitmentContributions(pk *gabikeys.PublicKey) ([]*big.Int, error) {
+	var list []*big.Int
+	for _, index := range attributeCommitmentIndices(p.AttributeCommitments) {
+		commitment := p.AttributeCommitments[index]
+		if index <= 0 || index >= len(pk.R) || p.AResponses[index] == nil {
+			return nil, errors.New("attribute commitment to disclosed or nonexisting attribute")
+		}
+		if commitment == nil || commitment.C == nil || commitment.RResponse == nil ||
+			commitment.C.Sign() <= 0 || commitment.C.Cmp(pk.N) >= 0 ||
+			commitment.RResponse.Sign() < 0 || uint(commitment.RResponse.BitLen()) > pk.Params.LvPrimeCommit+1 {
+			return nil, errors.New("invalid attribute commitment")
+		}
+
+		cc, err := common.ModPow(commitment.C, new(big.Int).Neg(p.C), pk.N)
+		if err != nil {
+			return nil, err
+		}
+		rm, err := pk.ModPow(pk.R[index], p.AResponses[index])
+		if err != nil {
+			return nil, err
+		}
+		cc.Mul(cc, rm).Mod(cc, pk.N)
+		cc.Mul(cc, pk.ExpModN(pk.S, commitment.RResponse)).Mod(cc, pk.N)
+		list = append(list, commitment.C, cc)
+	}
+	return list, nil
+}
@@ -0,0 +1,254 @@
+package gabi
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+)
+
+// BatchItem is a ProofList along with the parameters against which it should verify
+// (see ProofList.VerifyWithLinks()).
+type BatchItem struct {
+	Proofs          ProofList
+	PublicKeys      []*gabikeys.PublicKey
+	Context, Nonce  *big.Int
+	IsSig           bool
+	KeyshareServers []string
+	Links           AttributeLinks
+}
+
+// batchEquation is the product of the equations
+//
+//	ZCommit = (Z / (A^{2^{l_e - 1}} PROD_{disclosed} R_i^{a_i}))^{-c} A^{e_response}
+//	          PROD_{undisclosed} R_i^{a_response_i} S^{v_response}
+//
+// of a number of ProofDs against the same public key, each raised to a small random exponent.
+// As the same bases Z, S and R_i occur in each equation, their exponents can be summed, so that
+// checking the product costs about one exponentiation per base, along with an exponentiation of
+// A (with an exponent about the size of e) and of ZCommit (with a small exponent) per proof.
+//
+// If all equations hold then so does their product. The converse does not quite hold in Z_N^*,
+// which contains elements of order 2 such as -1: if ZCommit is off by such a factor u, then the
+// product is off by u^delta, which is 1 whenever delta is even. Therefore the square of the
+// product is checked instead, which holds with negligible probability unless each equation holds
+// up to a factor u with u^2 = 1. Finding such u other than ±1 is as hard as factoring N, so this
+// amounts to verifying each proof for the commitment ±ZCommit; a proof that verifies for
+// -ZCommit yields a representation of -Z in the bases A, S and R_i, which is as hard to forge as
+// one of Z.
+type batchEquation struct {
+	pk       *gabikeys.PublicKey
+	zExp     *big.Int
+	sExp     *big.Int
+	rExps    []*big.Int
+	bases    []*big.Int // Per proof bases A and ZCommit
+	exps     []*big.Int
+	contribs []int // Indices of the items that contributed to this equation
+}
+
+// batchEquations contains a batchEquation per public key.
+type batchEquations map[*gabikeys.PublicKey]*batchEquation
+
+// BatchVerify verifies the specified proof lists, returning whether all of them are valid. If not,
+// it returns the indices of the invalid proof lists.
+//
+// The commitments Z of the ProofDs contained in the lists are not reconstructed, which is the most
+// expensive part of verification. Instead, they are taken from the proofs (see ProofD.ZCommit and
+// DisclosureProofBuilder.BatchVerifiable()), and the equations that they should satisfy are
+// checked at once per public key. If that fails, the proof lists involved are verified separately
+// to find the invalid ones. ProofDs without ZCommit are verified as usual.
+func BatchVerify(items []*BatchItem) (bool, []int) {
+	var failed, fallback []int
+	equations := make(batchEquations)
+	for i, item := range items {
+		batch := make(batchEquations)
+		if err := item.Proofs.verify(
+			context.Background(), 1, item.PublicKeys, item.Context, item.Nonce, item.IsSig, item.KeyshareServers, item.Links, batch,
+		); err != nil {
+			// Either the proof list is invalid, or it has incorrect ZCommits
+			fallback = append(fallback, i)
+			continue
+		}
+		equations.merge(batch, i)
+	}
+
+	for _, eq := range equations {
+		if !eq.verify() {
+			fallback = append(fallback, eq.contribs...)
+		}
+	}
+
+	for _, i := range uniqueSorted(fallback) {
+		item := items[i]
+		if !item.Proofs.VerifyWithLinks(item.PublicKeys, item.Context, item.Nonce, item.IsSig, item.KeyshareServers, item.Links) {
+			failed = append(failed, i)
+		}
+	}
+	return len(failed) == 0, failed
+}
+
+// BatchVerifyProofD verifies the specified ProofDs against the public key, each with its own
+// nonce, returning whether all of them are valid. If not, it returns the indices of the invalid
+// proofs. See BatchVerify().
+func BatchVerifyProofD(pk *gabikeys.PublicKey, proofs []*ProofD, context *big.Int, nonces []*big.Int, issig bool) (bool, []int) {
+	items := make([]*BatchItem, len(proofs))
+	for i, proof := range proofs {
+		items[i] = &BatchItem{
+			Proofs:     ProofList{proof},
+			PublicKeys: []*gabikeys.PublicKey{pk},
+			Context:    context,
+			Nonce:      nonces[i],
+			IsSig:      issig,
+		}
+	}
+	return BatchVerify(items)
+}
+
+// batchChallengeContribution returns the contribution of this proof to the challenge, using
+// ZCommit instead of reconstructing Z, and adds the equation ZCommit should satisfy to batch.
+// If the proof has no ZCommit, Z is reconstructed as usual.
+func (p *ProofD) batchChallengeContribution(pk *gabikeys.PublicKey, batch batchEquations) ([]*big.Int, error) {
+	if p.ZCommit == nil {
+		return p.ChallengeContribution(pk)
+	}
+	if err := batch.add(pk, p); err != nil {
+		return nil, err
+	}
+	return p.challengeContribution(pk, p.ZCommit)
+}
+
+func (batch batchEquations) equation(pk *gabikeys.PublicKey) *batchEquation {
+	eq, ok := batch[pk]
+	if !ok {
+		eq = &batchEquation{
+			pk:    pk,
+			zExp:  big.NewInt(0),
+			sExp:  big.NewInt(0),
+			rExps: make([]*big.Int, len(pk.R)),
+		}
+		for i := range eq.rExps {
+			eq.rExps[i] = big.NewInt(0)
+		}
+		batch[pk] = eq
+	}
+	return eq
+}
+
+// add adds the equation of the proof, raised to a random exponent, to the equation of its public
+// key.
+func (batch batchEquations) add(pk *gabikeys.PublicKey, p *ProofD) error {
+	if p.C == nil || p.A == nil || p.EResponse == nil || p.VResponse == nil ||
+		p.ZCommit.Sign() <= 0 || p.ZCommit.Cmp(pk.N) >= 0 {
+		return errors.New("incomplete proof")
+	}
+	for i := range p.AResponses {
+		if i < 0 || i >= len(pk.R) {
+			return errors.New("attribute index out of range")
+		}
+	}
+	for i := range p.ADisclosed {
+		if i < 0 || i >= len(pk.R) {
+			return errors.New("attribute index out of range")
+		}
+	}
+
+	delta, err := common.RandomBigInt(pk.Params.Lstatzk)
+	if err != nil {
+		return err
+	}
+	eq := batch.equation(pk)
+	dc := new(big.Int).Mul(delta, p.C)
+
+	// Z^{-delta c}
+	eq.zExp.Sub(eq.zExp, dc)
+
+	// A^{delta (e_response + c 2^{l_e - 1})}
+	aExp := new(big.Int).Lsh(p.C, pk.Params.Le-1)
+	aExp.Add(aExp, p.EResponse).Mul(aExp, delta)
+	eq.bases = append(eq.bases, p.A, p.ZCommit)
+	eq.exps = append(eq.exps, aExp, new(big.Int).Neg(delta))
+
+	// R_i^{delta c a_i} for disclosed, R_i^{delta a_response_i} for undisclosed attributes
+	for i, attribute := range p.ADisclosed {
+		exp := attribute
+		if exp.BitLen() > int(pk.Params.Lm) {
+			exp = common.IntHashSha256(exp.Bytes())
+		}
+		eq.rExps[i].Add(eq.rExps[i], new(big.Int).Mul(dc, exp))
+	}
+	for i, response := range p.AResponses {
+		eq.rExps[i].Add(eq.rExps[i], new(big.Int).Mul(delta, response))
+	}
+
+	// S^{delta v_response}
+	eq.sExp.Add(eq.sExp, new(big.Int).Mul(delta, p.VResponse))
+
+	return nil
+}
+
+// merge adds the equations of other, which were contributed by the specified item, to batch.
+func (batch batchEquations) merge(other batchEquations, item int) {
+	for pk, o := range other {
+		eq := batch.equation(pk)
+		eq.zExp.Add(eq.zExp, o.zExp)
+		eq.sExp.Add(eq.sExp, o.sExp)
+		for i := range eq.rExps {
+			eq.rExps[i].Add(eq.rExps[i], o.rExps[i])
+		}
+		eq.bases = append(eq.bases, o.bases...)
+		eq.exps = append(eq.exps, o.exps...)
+		eq.contribs = append(eq.contribs, item)
+	}
+}
+
+// verify checks that the square of the product of the equations holds, i.e. that
+//
+//	(Z^{z_exp} S^{s_exp} PROD_i R_i^{r_exp_i} PROD_{proofs} A^{a_exp} ZCommit^{-delta})^2 = 1.
+func (eq *batchEquation) verify() bool {
+	pk := eq.pk
+	result := big.NewInt(1)
+	mul := func(base, exp *big.Int) bool {
+		if exp.Sign() == 0 {
+			return true
+		}
+		t, err := pk.ModPow(base, exp)
+		if err != nil {
+			return false
+		}
+		result.Mul(result, t).Mod(result, pk.N)
+		return true
+	}
+
+	if !mul(pk.Z, eq.zExp) || !mul(pk.S, eq.sExp) {
+		return false
+	}
+	for i, exp := range eq.rExps {
+		if !mul(pk.R[i], exp) {
+			return false
+		}
+	}
+	for i, base := range eq.bases {
+		if !mul(base, eq.exps[i]) {
+			return false
+		}
+	}
+	result.Mul(result, result).Mod(result, pk.N)
+	return result.Cmp(big.NewInt(1)) == 0
+}
+
+// uniqueSorted returns the distinct elements of the list in ascending order.
+func uniqueSorted(list []int) []int {
+	seen := make(map[int]bool, len(list))
+	var result []int
+	for _, i := range list {
+		if !seen[i] {
+			seen[i] = true
+			result = append(result, i)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
@@ -1,4 +1,5 @@
-// Package big contains a mostly API-compatible "math/big".Int that JSON-marshals to and from Base64.
+// Package big contains a mostly API-compatible "math/big".Int that JSON-marshals to and from Base64,
+// and CBOR-marshals to and from bignums.
 package big
 
 import (
@@ -8,14 +9,15 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"math/rand"
 
 	"github.com/go-errors/errors"
 )
 
-// Int is an API-compatible "math/big".Int that JSON-marshals to and from Base64.
-// Only supports positive integers.
+// Int is an API-compatible "math/big".Int that JSON-marshals to and from Base64,
+// and CBOR-marshals to and from bignums. Only supports positive integers.
 type Int big.Int
 
 func (i *Int) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
@@ -75,6 +77,120 @@ func (i *Int) UnmarshalJSON(b []byte) error {
 	return err
 }
 
+// CBOR major types and tags used in the encoding of bignums (RFC 8949, section 3.4.3).
+const (
+	cborUnsignedInt   = 0
+	cborNegativeInt   = 1
+	cborByteString    = 2
+	cborTag           = 6
+	cborTagPosBignum  = 2
+	cborTagNegBignum  = 3
+	cborMaxInlineHead = 23
+)
+
+// MarshalCBOR implements cbor.Marshaler, returning i.Bytes() as a byte string tagged as a
+// positive bignum. Previously, integers were encoded as untagged byte strings (using
+// MarshalBinary()); types whose encoding must not change, such as the signed accumulators and
+// updates of the revocation package, encode their integers as byte strings themselves.
+func (i *Int) MarshalCBOR() ([]byte, error) {
+	if i.Sign() == -1 {
+		return nil, errors.New("Marshaling negative integers is not supported")
+	}
+	bts := i.Bytes()
+	enc := AppendCBORHead(make([]byte, 0, len(bts)+10), cborTag, cborTagPosBignum)
+	enc = AppendCBORHead(enc, cborByteString, uint64(len(bts)))
+	return append(enc, bts...), nil
+}
+
+// UnmarshalCBOR implements cbor.Unmarshaler. It accepts positive bignums, plain byte strings
+// (as produced by encoders using MarshalBinary()) and unsigned integers.
+func (i *Int) UnmarshalCBOR(data []byte) error {
+	major, val, rest, err := ParseCBORHead(data)
+	if err != nil {
+		return err
+	}
+	if major == cborTag {
+		if val == cborTagNegBignum {
+			return errors.New("Unexpected negative integer")
+		}
+		if val != cborTagPosBignum {
+			return errors.Errorf("unexpected CBOR tag %d, expected bignum", val)
+		}
+		if major, val, rest, err = ParseCBORHead(rest); err != nil {
+			return err
+		}
+		if major != cborByteString {
+			return errors.New("CBOR bignum does not contain a byte string")
+		}
+	}
+
+	switch major {
+	case cborUnsignedInt:
+		i.SetUint64(val)
+	case cborByteString:
+		if uint64(len(rest)) < val {
+			return errors.New("CBOR byte string too short")
+		}
+		i.SetBytes(rest[:val])
+		rest = rest[val:]
+	case cborNegativeInt:
+		return errors.New("Unexpected negative integer")
+	default:
+		return errors.Errorf("unexpected CBOR major type %d for integer", major)
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data after CBOR integer")
+	}
+	return nil
+}
+
+// AppendCBORHead appends the head of a CBOR data item of the specified major type and argument
+// (RFC 8949, section 3) to bts, using the shortest encoding of the argument.
+func AppendCBORHead(bts []byte, major byte, val uint64) []byte {
+	major <<= 5
+	switch {
+	case val <= cborMaxInlineHead:
+		return append(bts, major|byte(val))
+	case val <= math.MaxUint8:
+		return append(bts, major|24, byte(val))
+	case val <= math.MaxUint16:
+		return append(bts, major|25, byte(val>>8), byte(val))
+	case val <= math.MaxUint32:
+		return append(bts, major|26, byte(val>>24), byte(val>>16), byte(val>>8), byte(val))
+	default:
+		bts = append(bts, major|27)
+		for shift := 56; shift >= 0; shift -= 8 {
+			bts = append(bts, byte(val>>uint(shift)))
+		}
+		return bts
+	}
+}
+
+// ParseCBORHead parses the head of a CBOR data item, returning its major type and argument, and
+// the remaining data.
+func ParseCBORHead(data []byte) (byte, uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, 0, nil, errors.New("empty CBOR data item")
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+	if info <= cborMaxInlineHead {
+		return major, uint64(info), data, nil
+	}
+	if info > 27 {
+		return 0, 0, nil, errors.New("unsupported CBOR argument encoding")
+	}
+	size := 1 << (info - 24)
+	if len(data) < size {
+		return 0, 0, nil, errors.New("CBOR data item too short")
+	}
+	var val uint64
+	for _, b := range data[:size] {
+		val = val<<8 | uint64(b)
+	}
+	return major, val, data[size:], nil
+}
+
 // RandInt wraps "crypto/rand".Int:
 // returns a uniform random value in [0, max). It panics if max <= 0.
 func RandInt(rnd io.Reader, max *Int) (*Int, error) {
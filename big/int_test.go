@@ -2,9 +2,11 @@ package big
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"testing"
 
+	"github.com/fxamacker/cbor"
 	"github.com/stretchr/testify/require"
 )
 
@@ -54,3 +56,65 @@ func TestNegative(t *testing.T) {
 	err = json.Unmarshal([]byte("-1234567891234567890123456789012345678"), bigint)
 	require.Error(t, err)
 }
+
+func testCBOR(t *testing.T, bigint *Int) {
+	bts, err := cbor.Marshal(bigint, cbor.EncOptions{})
+	require.NoError(t, err)
+	require.Equal(t, byte(0xc2), bts[0]) // tag 2: positive bignum
+	unmarshaled := new(Int)
+	require.NoError(t, cbor.Unmarshal(bts, unmarshaled))
+	require.Zero(t, bigint.Cmp(unmarshaled))
+}
+
+func TestCBOR(t *testing.T) {
+	testCBOR(t, NewInt(0))
+	testCBOR(t, NewInt(42))
+	max := new(Int).Lsh(NewInt(1), 3000)
+	bigint, err := RandInt(rand.Reader, max)
+	require.NoError(t, err)
+	testCBOR(t, bigint)
+
+	// Within structs and maps, nil pointers encode as null
+	type container struct {
+		A *Int
+		B *Int
+		M map[int]*Int
+	}
+	bts, err := cbor.Marshal(container{A: bigint, M: map[int]*Int{3: NewInt(300)}}, cbor.EncOptions{})
+	require.NoError(t, err)
+	var c container
+	require.NoError(t, cbor.Unmarshal(bts, &c))
+	require.Zero(t, bigint.Cmp(c.A))
+	require.Nil(t, c.B)
+	require.Zero(t, NewInt(300).Cmp(c.M[3]))
+}
+
+func TestCBORDecoding(t *testing.T) {
+	for enc, expected := range map[string]int64{
+		"c2420100": 256, // bignum
+		"420100":   256, // untagged byte string, as previously encoded using MarshalBinary()
+		"40":       0,
+		"190100":   256, // unsigned integer
+		"17":       23,
+	} {
+		bts, err := hex.DecodeString(enc)
+		require.NoError(t, err)
+		i := new(Int)
+		require.NoError(t, cbor.Unmarshal(bts, i), enc)
+		require.Equal(t, expected, i.Int64(), enc)
+	}
+
+	for _, enc := range []string{
+		"c3420100", // negative bignum
+		"20",       // negative integer
+		"c1420100", // other tag
+		"62abcd",   // text string
+	} {
+		bts, err := hex.DecodeString(enc)
+		require.NoError(t, err)
+		require.Error(t, new(Int).UnmarshalCBOR(bts), enc)
+	}
+
+	_, err := cbor.Marshal(NewInt(-42), cbor.EncOptions{})
+	require.Error(t, err)
+}
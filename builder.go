@@ -5,7 +5,7 @@
 package gabi
 
 import (
-	"encoding/json"
+	"io"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -26,37 +26,6 @@ type IssueCommitmentMessage struct {
 	ProofPjwts map[string]string `json:"proofPJwts,omitempty"`
 }
 
-// UnmarshalJSON implements json.Unmarshaler (json's default unmarshaler
-// is unable to handle a list of interfaces).
-func (pl *ProofList) UnmarshalJSON(bytes []byte) error {
-	proofs := []Proof{}
-	temp := []json.RawMessage{}
-	if err := json.Unmarshal(bytes, &temp); err != nil {
-		return err
-	}
-	for _, proofbytes := range temp {
-		proofd := &ProofD{}
-		if err := json.Unmarshal(proofbytes, proofd); err != nil {
-			return err
-		}
-		if proofd.A != nil {
-			proofs = append(proofs, proofd)
-			continue
-		}
-		proofu := &ProofU{}
-		if err := json.Unmarshal(proofbytes, proofu); err != nil {
-			return err
-		}
-		if proofu.U != nil {
-			proofs = append(proofs, proofu)
-			continue
-		}
-		return errors.New("Unknown proof type found in ProofList")
-	}
-	*pl = proofs
-	return nil
-}
-
 // IssueSignatureMessage encapsulates the messages sent from the issuer to the
 // reciver in the final step of the issuance protocol.
 type IssueSignatureMessage struct {
@@ -69,10 +38,10 @@ type IssueSignatureMessage struct {
 // Commits to the provided secret and user's share of random blind attributes "msg"
 func userCommitment(pk *gabikeys.PublicKey, secret *big.Int, vPrime *big.Int, msg map[int]*big.Int) (U *big.Int) {
 	// U = S^{vPrime} * R0^{secret} * Ri^{mi}
-	U = new(big.Int).Exp(pk.S, vPrime, pk.N)
-	U.Mul(U, new(big.Int).Exp(pk.R[0], secret, pk.N))
+	U = pk.ExpModN(pk.S, vPrime)
+	U.Mul(U, pk.ExpModN(pk.R[0], secret))
 	for i, mi := range msg {
-		U.Mul(U, new(big.Int).Exp(pk.R[i], mi, pk.N))
+		U.Mul(U, pk.ExpModN(pk.R[i], mi))
 	}
 	U.Mod(U, pk.N)
 	return
@@ -82,13 +51,19 @@ func userCommitment(pk *gabikeys.PublicKey, secret *big.Int, vPrime *big.Int, ms
 // The resulting credential builder is already committed to the provided secret.
 // arg blind: list of indices of random blind attributes (exlcuding the secret key)
 func NewCredentialBuilder(pk *gabikeys.PublicKey, context, secret *big.Int, nonce2 *big.Int, blind []int) (*CredentialBuilder, error) {
-	vPrime, err := common.RandomBigInt(pk.Params.LvPrime)
+	return NewCredentialBuilderWithRand(nil, pk, context, secret, nonce2, blind)
+}
+
+// NewCredentialBuilderWithRand creates a new credential builder like NewCredentialBuilder(),
+// which reads all of its randomness from the specified source (if nil, crypto/rand is used).
+func NewCredentialBuilderWithRand(random io.Reader, pk *gabikeys.PublicKey, context, secret *big.Int, nonce2 *big.Int, blind []int) (*CredentialBuilder, error) {
+	vPrime, err := common.RandomBigIntFrom(random, pk.Params.LvPrime)
 	if err != nil {
 		return nil, err
 	}
 	mUser := make(map[int]*big.Int, len(blind))
 	for _, i := range blind {
-		mUser[i+1], err = common.RandomBigInt(pk.Params.Lm - 1)
+		mUser[i+1], err = common.RandomBigIntFrom(random, pk.Params.Lm-1)
 		if err != nil {
 			return nil, err
 		}
@@ -106,6 +81,7 @@ func NewCredentialBuilder(pk *gabikeys.PublicKey, context, secret *big.Int, nonc
 		uCommit: big.NewInt(1),
 		nonce2:  nonce2,
 		mUser:   mUser,
+		random:  random,
 	}, nil
 }
 
@@ -150,8 +126,8 @@ func (b *CredentialBuilder) ConstructCredential(msg *IssueSignatureMessage, attr
 		E: msg.Signature.E,
 		V: new(big.Int).Add(msg.Signature.V, b.vPrime),
 	}
-	if b.proofPcomm != nil {
-		signature.KeyshareP = b.proofPcomm.P
+	if b.keyshareP != nil {
+		signature.KeyshareP = new(big.Int).Set(b.keyshareP)
 	}
 
 	// For all attributes that are sums of shares between user/issuer, compute this sum
@@ -165,6 +141,15 @@ func (b *CredentialBuilder) ConstructCredential(msg *IssueSignatureMessage, attr
 		}
 		ms[i] = new(big.Int).Add(msg.MIssuer[i], miUser) // mi = mi' + mi", for i \in randomblind
 	}
+	for i, attr := range b.carried {
+		if i >= len(ms) {
+			return nil, errors.New("got too few attributes")
+		}
+		if ms[i] != nil {
+			return nil, errors.New("attribute at carried over index should be nil before issuance")
+		}
+		ms[i] = new(big.Int).Set(attr.value)
+	}
 
 	if msg.NonRevocationWitness != nil {
 		if err := msg.NonRevocationWitness.Verify(b.pk); err != nil {
@@ -190,9 +175,61 @@ func (b *CredentialBuilder) ConstructCredential(msg *IssueSignatureMessage, attr
 	return cred, nil
 }
 
+// CarryOverAttribute includes the undisclosed attribute at index from of the disclosure proof
+// builder, hidden, as the attribute at the specified index of the credential being issued
+// (excluding the secret key, as with random blind attributes). The resulting ProofU proves that
+// the attribute is equal to the attribute of the ProofD, and so both builders must be part of the
+// same ProofBuilderList. The issuer must pass nil for the attribute and list its index in carried to
+// Issuer.IssueSignatureWithCarriedAttributes(), and the user must pass nil for the attribute to
+// ConstructCredential(). It must be called before the builder is committed.
+func (b *CredentialBuilder) CarryOverAttribute(index int, disclosure *DisclosureProofBuilder, from int) error {
+	if index < 0 || index+1 >= len(b.pk.R) {
+		return errors.New("attribute index out of range")
+	}
+	if _, ok := b.mUser[index+1]; ok {
+		return errors.New("cannot carry over attribute into random blind attribute")
+	}
+	if _, ok := b.carried[index+1]; ok {
+		return errors.New("attribute already carried over")
+	}
+	if from <= 0 || from >= len(disclosure.attributes) || !isUndisclosedAttribute(disclosure.disclosedAttributes, from) {
+		return errors.New("can only carry over undisclosed attributes other than the secret key")
+	}
+	value := disclosure.attributes[from]
+	if value.BitLen() > int(disclosure.pk.Params.Lm) || value.BitLen() > int(b.pk.Params.Lm) {
+		return errors.New("attribute too large to be carried over")
+	}
+
+	if b.carried == nil {
+		b.carried = make(map[int]*carriedAttribute)
+	}
+	b.carried[index+1] = &carriedAttribute{disclosure: disclosure, index: from, value: value}
+	b.u.Mul(b.u, b.pk.ExpModN(b.pk.R[index+1], value)).Mod(b.u, b.pk.N)
+	return nil
+}
+
+// resolveCrossAttributes looks up the positions of the disclosure proof builders from which
+// attributes are carried over, along with the randomizers they use for these attributes.
+func (b *CredentialBuilder) resolveCrossAttributes(builders ProofBuilderList, randomizers map[string]*big.Int) error {
+	for _, attr := range b.carried {
+		attr.ref = AttributeRef{Proof: -1, Attribute: attr.index}
+		for i, builder := range builders {
+			if builder == attr.disclosure {
+				attr.ref.Proof = i
+				break
+			}
+		}
+		if attr.ref.Proof < 0 {
+			return errors.New("disclosure proof builder of carried over attribute not in list")
+		}
+		attr.randomizer = attr.disclosure.attributeRandomizer(attr.index, randomizers)
+	}
+	return nil
+}
+
 // Creates a proofU using a provided nonce
 func (b *CredentialBuilder) proveCommitment(nonce1 *big.Int) (Proof, error) {
-	sCommit, err := common.RandomBigInt(b.pk.Params.LsCommit)
+	sCommit, err := common.RandomBigIntFrom(b.random, b.pk.Params.LsCommit)
 	if err != nil {
 		return nil, err
 	}
@@ -216,16 +253,41 @@ type CredentialBuilder struct {
 	uCommit      *big.Int
 	skRandomizer *big.Int
 
-	pk         *gabikeys.PublicKey
-	context    *big.Int
-	proofPcomm *ProofPCommitment
+	pk        *gabikeys.PublicKey
+	context   *big.Int
+	keyshareP *big.Int // Product of the P's of all merged ProofPCommitments
 
 	mUser       map[int]*big.Int // Map of users shares of random blind attributes
 	mUserCommit map[int]*big.Int
+
+	carried map[int]*carriedAttribute // Map of attributes carried over from disclosure proofs
+
+	random io.Reader // Source of randomness, crypto/rand if nil
 }
 
+// carriedAttribute is an attribute of a DisclosureProofBuilder that is carried over into the
+// credential being issued, without disclosing it to the issuer.
+type carriedAttribute struct {
+	disclosure *DisclosureProofBuilder
+	index      int
+	value      *big.Int
+	ref        AttributeRef
+	randomizer *big.Int
+}
+
+func (b *CredentialBuilder) randomSource() io.Reader {
+	return b.random
+}
+
+// MergeProofPCommitment merges the commitment of a keyshare server into the proof of this builder.
+// If the secret key is shared with multiple keyshare servers, it should be called once for each
+// of them, after which the credential is bound to the sum of the user's and all servers' shares.
 func (b *CredentialBuilder) MergeProofPCommitment(commitment *ProofPCommitment) {
-	b.proofPcomm = commitment
+	if b.keyshareP == nil {
+		b.keyshareP = new(big.Int).Set(commitment.P)
+	} else {
+		b.keyshareP.Mod(b.keyshareP.Mul(b.keyshareP, commitment.P), b.pk.N)
+	}
 	b.uCommit.Mod(
 		b.uCommit.Mul(b.uCommit, commitment.Pcommit),
 		b.pk.N,
@@ -242,33 +304,43 @@ func (b *CredentialBuilder) PublicKey() *gabikeys.PublicKey {
 func (b *CredentialBuilder) Commit(randomizers map[string]*big.Int) ([]*big.Int, error) {
 	b.skRandomizer = randomizers["secretkey"]
 	var err error
-	b.vPrimeCommit, err = common.RandomBigInt(b.pk.Params.LvPrimeCommit)
+	b.vPrimeCommit, err = common.RandomBigIntFrom(b.random, b.pk.Params.LvPrimeCommit)
 	if err != nil {
 		return nil, err
 	}
 	b.mUserCommit = make(map[int]*big.Int)
 	for i := range b.mUser {
-		b.mUserCommit[i], err = common.RandomBigInt(b.pk.Params.LmCommit)
+		b.mUserCommit[i], err = common.RandomBigIntFrom(b.random, b.pk.Params.LmCommit)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// U_commit = U_commit * S^{v_prime_commit} * R_0^{s_commit}
-	sv := new(big.Int).Exp(b.pk.S, b.vPrimeCommit, b.pk.N)
-	r0s := new(big.Int).Exp(b.pk.R[0], b.skRandomizer, b.pk.N)
+	sv := b.pk.ExpModN(b.pk.S, b.vPrimeCommit)
+	r0s := b.pk.ExpModN(b.pk.R[0], b.skRandomizer)
 	b.uCommit.Mul(b.uCommit, sv).Mul(b.uCommit, r0s)
 	b.uCommit.Mod(b.uCommit, b.pk.N)
 
 	// U_commit = U_commit * R_i^{m_iUserCommit} for i in random blind
 	for i := range b.mUser {
-		b.uCommit.Mul(b.uCommit, new(big.Int).Exp(b.pk.R[i], b.mUserCommit[i], b.pk.N))
+		b.uCommit.Mul(b.uCommit, b.pk.ExpModN(b.pk.R[i], b.mUserCommit[i]))
+		b.uCommit.Mod(b.uCommit, b.pk.N)
+	}
+
+	// U_commit = U_commit * R_i^{m_iCommit} for i carried over, using the randomizer of the
+	// attribute in its disclosure proof
+	for i, attr := range b.carried {
+		if attr.randomizer == nil {
+			return nil, errors.New("carried over attributes require a ProofBuilderList")
+		}
+		b.uCommit.Mul(b.uCommit, b.pk.ExpModN(b.pk.R[i], attr.randomizer))
 		b.uCommit.Mod(b.uCommit, b.pk.N)
 	}
 
 	ucomm := new(big.Int).Set(b.u)
-	if b.proofPcomm != nil {
-		ucomm.Mul(ucomm, b.proofPcomm.P).Mod(ucomm, b.pk.N)
+	if b.keyshareP != nil {
+		ucomm.Mul(ucomm, b.keyshareP).Mod(ucomm, b.pk.N)
 	}
 
 	return []*big.Int{ucomm, b.uCommit}, nil
@@ -284,11 +356,20 @@ func (b *CredentialBuilder) CreateProof(challenge *big.Int) Proof {
 		mUserResponses[i] = new(big.Int).Add(b.mUserCommit[i], new(big.Int).Mul(challenge, miUser))
 	}
 
+	var carried map[int]AttributeRef
+	if len(b.carried) > 0 {
+		carried = make(map[int]AttributeRef, len(b.carried))
+		for i, attr := range b.carried {
+			carried[i] = attr.ref
+		}
+	}
+
 	return &ProofU{
-		U:              b.u,
-		C:              challenge,
-		VPrimeResponse: vPrimeResponse,
-		SResponse:      sResponse,
-		MUserResponses: mUserResponses,
+		U:                 b.u,
+		C:                 challenge,
+		VPrimeResponse:    vPrimeResponse,
+		SResponse:         sResponse,
+		MUserResponses:    mUserResponses,
+		CarriedAttributes: carried,
 	}
 }
@@ -5,7 +5,7 @@
 package gabi
 
 import (
-	"crypto/rand"
+	"io"
 
 	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi/big"
@@ -19,7 +19,14 @@ import (
 // with R and N coming from the public key. The exponents are hashed if their length
 // exceeds the maximum message length from the public key.
 func RepresentToPublicKey(pk *gabikeys.PublicKey, exps []*big.Int) (*big.Int, error) {
-	return common.RepresentToBases(pk.R, exps, pk.N, pk.Params.Lm), nil
+	r := big.NewInt(1)
+	for i, exp := range exps {
+		if exp.BitLen() > int(pk.Params.Lm) {
+			exp = common.IntHashSha256(exp.Bytes())
+		}
+		r.Mul(r, pk.ExpModN(pk.R[i], exp)).Mod(r, pk.N)
+	}
+	return r, nil
 }
 
 // CLSignature is a data structure for holding a Camenisch-Lysyanskaya signature.
@@ -32,96 +39,126 @@ type CLSignature struct {
 
 // SignMessageBlock signs a message block (ms) and a commitment (U) using the
 // Camenisch-Lysyanskaya signature scheme as used in the IdeMix system.
-func signMessageBlockAndCommitment(sk *gabikeys.PrivateKey, pk *gabikeys.PublicKey, U *big.Int, ms []*big.Int) (
+func signMessageBlockAndCommitment(random io.Reader, sk *gabikeys.PrivateKey, pk *gabikeys.PublicKey, U *big.Int, ms []*big.Int) (
 	*CLSignature, error) {
-	R, err := RepresentToPublicKey(pk, ms)
+	Q, e, v, err := prepareSignature(random, pk, U, ms)
 	if err != nil {
 		return nil, err
 	}
 
-	vTilde, err := common.RandomBigInt(pk.Params.Lv - 1)
+	d, ok := common.ModInverse(e, sk.Order)
+	if !ok {
+		return nil, errors.New("failed to invert mod order")
+	}
+	A := new(big.Int).Exp(Q, d, pk.N)
+
+	// TODO: this is probably open to side channel attacks, maybe use a
+	// safe (raw) RSA signature?
+
+	return &CLSignature{A: A, E: e, V: v}, nil
+}
+
+// prepareSignature chooses e and v of a signature on the message block (ms) and the commitment
+// (U), returning them along with Q = Z / (S^v * R * U), of which A is the e-th root.
+func prepareSignature(random io.Reader, pk *gabikeys.PublicKey, U *big.Int, ms []*big.Int) (Q, e, v *big.Int, err error) {
+	R, err := RepresentToPublicKey(pk, ms)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+
+	vTilde, err := common.RandomBigIntFrom(random, pk.Params.Lv-1)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 	twoLv := new(big.Int).Lsh(big.NewInt(1), pk.Params.Lv-1)
-	v := new(big.Int).Add(twoLv, vTilde)
+	v = new(big.Int).Add(twoLv, vTilde)
 
 	// Q = inv( S^v * R * U) * Z
-	numerator := new(big.Int).Exp(pk.S, v, pk.N)
+	numerator := pk.ExpModN(pk.S, v)
 	numerator.Mul(numerator, R).Mul(numerator, U).Mod(numerator, pk.N)
 
 	invNumerator, ok := common.ModInverse(numerator, pk.N)
 	if !ok {
-		return nil, errors.New("failed to invert mod n")
+		return nil, nil, nil, errors.New("failed to invert mod n")
 	}
-	Q := new(big.Int).Mul(pk.Z, invNumerator)
+	Q = new(big.Int).Mul(pk.Z, invNumerator)
 	Q.Mod(Q, pk.N)
 
-	e, err := common.RandomPrimeInRange(rand.Reader, pk.Params.Le-1, pk.Params.LePrime-1)
+	e, err = common.RandomPrimeInRange(common.RandReader(random), pk.Params.Le-1, pk.Params.LePrime-1)
 	if err != nil {
-		return nil, err
-	}
-
-	d, ok := common.ModInverse(e, sk.Order)
-	if !ok {
-		return nil, errors.New("failed to invert mod order")
+		return nil, nil, nil, err
 	}
-	A := new(big.Int).Exp(Q, d, pk.N)
-
-	// TODO: this is probably open to side channel attacks, maybe use a
-	// safe (raw) RSA signature?
-
-	return &CLSignature{A: A, E: e, V: v}, nil
+	return Q, e, v, nil
 }
 
 // SignMessageBlock signs a message block (ms) using the Camenisch-Lysyanskaya
 // signature scheme as used in the IdeMix system.
 func SignMessageBlock(sk *gabikeys.PrivateKey, pk *gabikeys.PublicKey, ms []*big.Int) (*CLSignature, error) {
-	return signMessageBlockAndCommitment(sk, pk, big.NewInt(1), ms)
+	return signMessageBlockAndCommitment(nil, sk, pk, big.NewInt(1), ms)
+}
+
+// SignMessageBlockWithRand signs a message block like SignMessageBlock(), using the specified
+// source of randomness (if nil, crypto/rand is used).
+func SignMessageBlockWithRand(random io.Reader, sk *gabikeys.PrivateKey, pk *gabikeys.PublicKey, ms []*big.Int) (*CLSignature, error) {
+	return signMessageBlockAndCommitment(random, sk, pk, big.NewInt(1), ms)
 }
 
 // Verify checks whether the signature is correct while being given a public key
 // and the messages.
 func (s *CLSignature) Verify(pk *gabikeys.PublicKey, ms []*big.Int) bool {
+	return s.VerifyDetailed(pk, ms) == nil
+}
+
+// VerifyDetailed checks the signature like Verify(), returning a *VerificationError describing
+// the failed check if the signature is invalid.
+func (s *CLSignature) VerifyDetailed(pk *gabikeys.PublicKey, ms []*big.Int) error {
 	// First check that e is in the range [2^{l_e - 1}, 2^{l_e - 1} + 2^{l_e_prime - 1}]
 	start := new(big.Int).Lsh(big.NewInt(1), pk.Params.Le-1)
 	end := new(big.Int).Lsh(big.NewInt(1), pk.Params.LePrime-1)
 	end.Add(end, start)
 	if s.E.Cmp(start) < 0 || s.E.Cmp(end) > 0 {
-		return false
+		return verificationError(ErrSignatureE, nil)
 	}
 
 	if !s.E.ProbablyPrime(80) {
-		return false
+		return verificationError(ErrSignatureE, nil)
 	}
 
 	// Q = A^e * R * S^v
 	Ae := new(big.Int).Exp(s.A, s.E, pk.N)
 	R, err := RepresentToPublicKey(pk, ms)
 	if err != nil {
-		return false
+		return verificationError(ErrSignature, err)
 	}
 	if s.KeyshareP != nil {
 		R.Mul(R, s.KeyshareP)
 	}
-	Sv, err := common.ModPow(pk.S, s.V, pk.N)
+	Sv, err := pk.ModPow(pk.S, s.V)
 	if err != nil {
-		return false
+		return verificationError(ErrSignature, err)
 	}
 	Q := new(big.Int).Mul(Ae, R)
 	Q.Mul(Q, Sv).Mod(Q, pk.N)
 
 	// Signature verifies if Q == Z
-	return pk.Z.Cmp(Q) == 0
+	if pk.Z.Cmp(Q) != 0 {
+		return verificationError(ErrSignature, nil)
+	}
+	return nil
 }
 
 // Randomize returns a randomized copy of the signature.
 func (s *CLSignature) Randomize(pk *gabikeys.PublicKey) (*CLSignature, error) {
-	r, err := common.RandomBigInt(pk.Params.LRA)
+	return s.randomize(nil, pk)
+}
+
+// randomize returns a copy of the signature randomized using the specified source of randomness.
+func (s *CLSignature) randomize(random io.Reader, pk *gabikeys.PublicKey) (*CLSignature, error) {
+	r, err := common.RandomBigIntFrom(random, pk.Params.LRA)
 	if err != nil {
 		return nil, err
 	}
-	APrime := new(big.Int).Mul(s.A, new(big.Int).Exp(pk.S, r, pk.N))
+	APrime := new(big.Int).Mul(s.A, pk.ExpModN(pk.S, r))
 	APrime.Mod(APrime, pk.N)
 	t := new(big.Int).Mul(s.E, r)
 	VPrime := new(big.Int).Sub(s.V, t)
@@ -5,12 +5,15 @@
 package gabi
 
 import (
+	"io"
+
 	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/gabikeys"
 	"github.com/privacybydesign/gabi/internal/common"
 	"github.com/privacybydesign/gabi/rangeproof"
 	"github.com/privacybydesign/gabi/revocation"
+	"github.com/privacybydesign/gabi/setmembership"
 )
 
 // Credential represents an Idemix credential.
@@ -35,9 +38,26 @@ type DisclosureProofBuilder struct {
 	pk                    *gabikeys.PublicKey
 	attributes            []*big.Int
 	nonrevBuilder         *NonRevocationProofBuilder
+	attrLinks             map[int]string
 
 	rpStructures map[int][]*rangeproof.ProofStructure
 	rpCommits    map[int][]*rangeproof.ProofCommit
+	crossAttrs   map[AttributeRef]crossAttribute
+
+	smStructures map[int][]*setmembership.ProofStructure
+	smCommits    map[int][]*setmembership.ProofCommit
+
+	attrCommitments map[int]*attributeCommitmentBuilder
+	showTag         *showTagBuilder
+	batchVerifiable bool
+
+	random io.Reader // Source of randomness, crypto/rand if nil
+}
+
+// crossAttribute holds the value and randomizer of an attribute of another builder, to which
+// a range statement of a DisclosureProofBuilder relates.
+type crossAttribute struct {
+	value, randomizer *big.Int
 }
 
 type NonRevocationProofBuilder struct {
@@ -47,6 +67,7 @@ type NonRevocationProofBuilder struct {
 	commitments []*big.Int
 	randomizer  *big.Int
 	index       uint64
+	random      io.Reader
 }
 
 // UpdateCommit updates the builder to the latest accumulator contained in the specified (updated) witness.
@@ -66,7 +87,7 @@ func (b *NonRevocationProofBuilder) UpdateCommit(witness *revocation.Witness) er
 func (b *NonRevocationProofBuilder) Commit() ([]*big.Int, error) {
 	if b.commitments == nil {
 		var err error
-		b.commitments, b.commit, err = revocation.NewProofCommit(b.pk, b.witness, b.randomizer)
+		b.commitments, b.commit, err = revocation.NewProofCommitWithRand(b.random, b.pk, b.witness, b.randomizer)
 		if err != nil {
 			return nil, err
 		}
@@ -132,19 +153,32 @@ func (ic *Credential) CreateDisclosureProofBuilder(
 	rangeStatements map[int][]*rangeproof.Statement,
 	nonrev bool,
 ) (*DisclosureProofBuilder, error) {
-	d := &DisclosureProofBuilder{}
+	return ic.CreateDisclosureProofBuilderWithRand(nil, disclosedAttributes, rangeStatements, nonrev)
+}
+
+// CreateDisclosureProofBuilderWithRand produces a DisclosureProofBuilder like
+// CreateDisclosureProofBuilder(), which reads all of its randomness from the specified source (if
+// nil, crypto/rand is used). With a custom source, the cached nonrevocation proof builder (see
+// NonrevPrepareCache()) is not used, as its randomness does not come from the source.
+func (ic *Credential) CreateDisclosureProofBuilderWithRand(
+	random io.Reader,
+	disclosedAttributes []int,
+	rangeStatements map[int][]*rangeproof.Statement,
+	nonrev bool,
+) (*DisclosureProofBuilder, error) {
+	d := &DisclosureProofBuilder{random: random}
 	d.z = big.NewInt(1)
 	d.pk = ic.Pk
 	var err error
-	d.randomizedSignature, err = ic.Signature.Randomize(ic.Pk)
+	d.randomizedSignature, err = ic.Signature.randomize(random, ic.Pk)
 	if err != nil {
 		return nil, err
 	}
-	d.eCommit, err = common.RandomBigInt(ic.Pk.Params.LeCommit)
+	d.eCommit, err = common.RandomBigIntFrom(random, ic.Pk.Params.LeCommit)
 	if err != nil {
 		return nil, err
 	}
-	d.vCommit, err = common.RandomBigInt(ic.Pk.Params.LvCommit)
+	d.vCommit, err = common.RandomBigIntFrom(random, ic.Pk.Params.LvCommit)
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +188,7 @@ func (ic *Credential) CreateDisclosureProofBuilder(
 	d.undisclosedAttributes = getUndisclosedAttributes(disclosedAttributes, len(ic.Attributes))
 	d.attributes = ic.Attributes
 	for _, v := range d.undisclosedAttributes {
-		d.attrRandomizers[v], err = common.RandomBigInt(ic.Pk.Params.LmCommit)
+		d.attrRandomizers[v], err = common.RandomBigIntFrom(random, ic.Pk.Params.LmCommit)
 		if err != nil {
 			return nil, err
 		}
@@ -167,6 +201,11 @@ func (ic *Credential) CreateDisclosureProofBuilder(
 				return nil, errors.New("Range statements on revealed attributes are not supported")
 			}
 			for _, statement := range statements {
+				if statement.Other != nil && statement.Other.Proof == nil && (statement.Other.Index < 0 ||
+					statement.Other.Index >= len(ic.Attributes) ||
+					!isUndisclosedAttribute(disclosedAttributes, statement.Other.Index)) {
+					return nil, errors.New("Range statements must relate to undisclosed attributes")
+				}
 				structure, err := statement.ProofStructure(index)
 				if err != nil {
 					return nil, err
@@ -187,7 +226,11 @@ func (ic *Credential) CreateDisclosureProofBuilder(
 	if err != nil {
 		return nil, err
 	}
-	d.nonrevBuilder, err = ic.nonrevConsumeBuilder()
+	if random == nil {
+		d.nonrevBuilder, err = ic.nonrevConsumeBuilder()
+	} else {
+		d.nonrevBuilder, err = ic.nonrevBuildProofBuilder(random)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -244,6 +287,10 @@ func (ic *Credential) NonrevPrepareCache() error {
 
 // NonrevBuildProofBuilder builds and returns a new commited-to NonRevocationProofBuilder.
 func (ic *Credential) NonrevBuildProofBuilder() (*NonRevocationProofBuilder, error) {
+	return ic.nonrevBuildProofBuilder(nil)
+}
+
+func (ic *Credential) nonrevBuildProofBuilder(random io.Reader) (*NonRevocationProofBuilder, error) {
 	if ic.NonRevocationWitness == nil {
 		return nil, errors.New("credential has no nonrevocation witness")
 	}
@@ -251,7 +298,8 @@ func (ic *Credential) NonrevBuildProofBuilder() (*NonRevocationProofBuilder, err
 		pk:         ic.Pk,
 		witness:    ic.NonRevocationWitness,
 		index:      ic.NonRevocationWitness.SignedAccumulator.Accumulator.Index,
-		randomizer: revocation.NewProofRandomizer(),
+		randomizer: revocation.NewProofRandomizerWithRand(random),
+		random:     random,
 	}
 	_, err := b.Commit()
 	if err != nil {
@@ -272,6 +320,9 @@ func (ic *Credential) NonrevIndex() (int, error) {
 	return -1, errors.New("revocation attribute not included in credential")
 }
 
+// MergeProofPCommitment merges the commitment of a keyshare server into the proof of this builder.
+// If the secret key is shared with multiple keyshare servers, it should be called once for each
+// of them.
 func (d *DisclosureProofBuilder) MergeProofPCommitment(commitment *ProofPCommitment) {
 	d.z.Mod(
 		d.z.Mul(d.z, commitment.Pcommit),
@@ -279,15 +330,127 @@ func (d *DisclosureProofBuilder) MergeProofPCommitment(commitment *ProofPCommitm
 	)
 }
 
+// LinkAttribute declares that the undisclosed attribute at the specified index equals all other
+// attributes that are linked under the same name within the ProofBuilderList of which this builder
+// is part. This is effected by sharing the randomizer of these attributes, like the secret key
+// randomizer is shared between all builders. The verifier checks the link using
+// ProofList.VerifyWithLinks().
+func (d *DisclosureProofBuilder) LinkAttribute(index int, name string) error {
+	if name == "" || name == "secretkey" {
+		return errors.New("invalid attribute link name")
+	}
+	if index == 0 {
+		return errors.New("the secret key cannot be linked, it is always shared")
+	}
+	if index < 0 || index >= len(d.attributes) || !isUndisclosedAttribute(d.disclosedAttributes, index) {
+		return errors.New("only undisclosed attributes can be linked")
+	}
+	if d.nonrevBuilder != nil && d.attrRandomizers[index] == d.nonrevBuilder.randomizer {
+		return errors.New("the nonrevocation attribute cannot be linked")
+	}
+	if d.attrLinks == nil {
+		d.attrLinks = make(map[int]string)
+	}
+	d.attrLinks[index] = name
+	return nil
+}
+
+// AddSetMembershipStatement adds a statement that the undisclosed attribute at the specified index
+// is an element of the statement's set. It must be called before the builder is committed.
+func (d *DisclosureProofBuilder) AddSetMembershipStatement(index int, statement *setmembership.Statement) error {
+	if index < 0 || index >= len(d.attributes) {
+		return errors.New("attribute index out of range")
+	}
+	if !isUndisclosedAttribute(d.disclosedAttributes, index) {
+		return errors.New("Set membership statements on revealed attributes are not supported")
+	}
+	structure, err := statement.ProofStructure(index)
+	if err != nil {
+		return err
+	}
+	if d.smStructures == nil {
+		d.smStructures = make(map[int][]*setmembership.ProofStructure)
+	}
+	d.smStructures[index] = append(d.smStructures[index], structure)
+	return nil
+}
+
+func (d *DisclosureProofBuilder) linkedAttributes() map[int]string {
+	return d.attrLinks
+}
+
+// attributeRandomizer returns the randomizer that is used for the specified undisclosed attribute
+// when committing using the specified randomizers.
+func (d *DisclosureProofBuilder) attributeRandomizer(index int, randomizers map[string]*big.Int) *big.Int {
+	if index == 0 {
+		return randomizers["secretkey"]
+	}
+	if name, ok := d.attrLinks[index]; ok {
+		return randomizers[name]
+	}
+	return d.attrRandomizers[index]
+}
+
+// attributeExponent returns the exponent with which the specified attribute is proven, i.e., the
+// attribute itself or its hash if it is too large.
+func (d *DisclosureProofBuilder) attributeExponent(index int) *big.Int {
+	exp := d.attributes[index]
+	if exp.BitLen() > int(d.pk.Params.Lm) {
+		exp = common.IntHashSha256(exp.Bytes())
+	}
+	return exp
+}
+
+// resolveCrossAttributes looks up the attributes of other builders to which the range statements
+// of this builder relate, along with the randomizers those builders commit to them with.
+func (d *DisclosureProofBuilder) resolveCrossAttributes(builders ProofBuilderList, randomizers map[string]*big.Int) error {
+	for _, structures := range d.rpStructures {
+		for _, s := range structures {
+			other := s.OtherAttribute()
+			if other == nil || other.Proof == nil {
+				continue
+			}
+			if *other.Proof < 0 || *other.Proof >= len(builders) {
+				return errors.New("range statement relates to nonexisting proof")
+			}
+			builder, ok := builders[*other.Proof].(*DisclosureProofBuilder)
+			if !ok || other.Index < 0 || other.Index >= len(builder.attributes) ||
+				!isUndisclosedAttribute(builder.disclosedAttributes, other.Index) {
+				return errors.New("range statement must relate to undisclosed attribute of disclosure proof")
+			}
+			if d.crossAttrs == nil {
+				d.crossAttrs = make(map[AttributeRef]crossAttribute)
+			}
+			d.crossAttrs[AttributeRef{Proof: *other.Proof, Attribute: other.Index}] = crossAttribute{
+				value:      builder.attributes[other.Index],
+				randomizer: builder.attributeRandomizer(other.Index, randomizers),
+			}
+		}
+	}
+	return nil
+}
+
+// randomSource returns the source of randomness of the builder, or nil for crypto/rand.
+func (d *DisclosureProofBuilder) randomSource() io.Reader {
+	return d.random
+}
+
 // PublicKey returns the Idemix public key against which this disclosure proof will verify.
 func (d *DisclosureProofBuilder) PublicKey() *gabikeys.PublicKey {
 	return d.pk
 }
 
 // Commit commits to the first attribute (the secret) using the provided
-// randomizer.
+// randomizer, and to linked attributes using the randomizers of their links.
 func (d *DisclosureProofBuilder) Commit(randomizers map[string]*big.Int) ([]*big.Int, error) {
 	d.attrRandomizers[0] = randomizers["secretkey"]
+	for index, name := range d.attrLinks {
+		randomizer, ok := randomizers[name]
+		if !ok {
+			return nil, errors.Errorf("no randomizer for attribute link %s", name)
+		}
+		d.attrRandomizers[index] = randomizer
+	}
 
 	// Z = A^{e_commit} * S^{v_commit}
 	//     PROD_{i \in undisclosed} ( R_i^{a_commits{i}} )
@@ -295,14 +458,14 @@ func (d *DisclosureProofBuilder) Commit(randomizers map[string]*big.Int) ([]*big
 	if err != nil {
 		return nil, err
 	}
-	Sv, err := common.ModPow(d.pk.S, d.vCommit, d.pk.N)
+	Sv, err := d.pk.ModPow(d.pk.S, d.vCommit)
 	if err != nil {
 		return nil, err
 	}
 	d.z.Mul(d.z, Ae).Mul(d.z, Sv).Mod(d.z, d.pk.N)
 
 	for _, v := range d.undisclosedAttributes {
-		t, err := common.ModPow(d.pk.R[v], d.attrRandomizers[v], d.pk.N)
+		t, err := d.pk.ModPow(d.pk.R[v], d.attrRandomizers[v])
 		if err != nil {
 			return nil, err
 		}
@@ -329,7 +492,19 @@ func (d *DisclosureProofBuilder) Commit(randomizers map[string]*big.Int) ([]*big
 				continue
 			}
 			for _, s := range structures {
-				contributions, commit, err := s.CommitmentsFromSecrets(d.pk, d.attributes[index], d.attrRandomizers[index])
+				var m2, m2Randomizer *big.Int
+				if other := s.OtherAttribute(); other != nil && other.Proof == nil {
+					m2, m2Randomizer = d.attributes[other.Index], d.attrRandomizers[other.Index]
+				} else if other != nil {
+					attr, ok := d.crossAttrs[AttributeRef{Proof: *other.Proof, Attribute: other.Index}]
+					if !ok {
+						return nil, errors.New("unresolved range statement relating to other proof")
+					}
+					m2, m2Randomizer = attr.value, attr.randomizer
+				}
+				contributions, commit, err := s.CommitmentsFromSecretsWithRand(
+					d.random, d.pk, d.attributes[index], d.attrRandomizers[index], m2, m2Randomizer,
+				)
 				if err != nil {
 					return nil, err
 				}
@@ -339,6 +514,32 @@ func (d *DisclosureProofBuilder) Commit(randomizers map[string]*big.Int) ([]*big
 		}
 	}
 
+	if d.smStructures != nil {
+		d.smCommits = make(map[int][]*setmembership.ProofCommit)
+		for index := 0; index < len(d.attributes); index++ {
+			structures, ok := d.smStructures[index]
+			if !ok {
+				continue
+			}
+			for _, s := range structures {
+				contributions, commit, err := s.CommitmentsFromSecretsWithRand(d.random, d.pk, d.attributes[index], d.attrRandomizers[index])
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, contributions...)
+				d.smCommits[index] = append(d.smCommits[index], commit)
+			}
+		}
+	}
+
+	list = append(list, d.commitAttributeCommitments()...)
+
+	showTag, err := d.commitShowTag()
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, showTag...)
+
 	return list, nil
 }
 
@@ -352,11 +553,7 @@ func (d *DisclosureProofBuilder) CreateProof(challenge *big.Int) Proof {
 
 	aResponses := make(map[int]*big.Int)
 	for _, v := range d.undisclosedAttributes {
-		exp := d.attributes[v]
-		if exp.BitLen() > int(d.pk.Params.Lm) {
-			exp = common.IntHashSha256(exp.Bytes())
-		}
-		t := new(big.Int).Mul(challenge, exp)
+		t := new(big.Int).Mul(challenge, d.attributeExponent(v))
 		aResponses[v] = t.Add(d.attrRandomizers[v], t)
 	}
 
@@ -382,16 +579,44 @@ func (d *DisclosureProofBuilder) CreateProof(challenge *big.Int) Proof {
 		}
 	}
 
+	var setMembershipProofs map[int][]*setmembership.Proof
+	if d.smStructures != nil {
+		setMembershipProofs = make(map[int][]*setmembership.Proof)
+		for index, structures := range d.smStructures {
+			for i, s := range structures {
+				setMembershipProofs[index] = append(setMembershipProofs[index],
+					s.BuildProof(d.smCommits[index][i], challenge))
+			}
+		}
+	}
+
 	return &ProofD{
-		C:                  challenge,
-		A:                  d.randomizedSignature.A,
-		EResponse:          eResponse,
-		VResponse:          vResponse,
-		AResponses:         aResponses,
-		ADisclosed:         aDisclosed,
-		NonRevocationProof: nonrevProof,
-		RangeProofs:        rangeProofs,
+		C:                    challenge,
+		A:                    d.randomizedSignature.A,
+		EResponse:            eResponse,
+		VResponse:            vResponse,
+		AResponses:           aResponses,
+		ADisclosed:           aDisclosed,
+		NonRevocationProof:   nonrevProof,
+		RangeProofs:          rangeProofs,
+		SetMembershipProofs:  setMembershipProofs,
+		AttributeCommitments: d.createAttributeCommitments(challenge),
+		ShowTag:              d.createShowTag(challenge),
+		ZCommit:              d.createZCommit(),
+	}
+}
+
+// BatchVerifiable includes the commitment Z in the ProofD, so that the verifier can check it
+// along with other proofs using BatchVerify(). This enlarges the proof by an element of Z_N^*.
+func (d *DisclosureProofBuilder) BatchVerifiable() {
+	d.batchVerifiable = true
+}
+
+func (d *DisclosureProofBuilder) createZCommit() *big.Int {
+	if !d.batchVerifiable {
+		return nil
 	}
+	return new(big.Int).Set(d.z)
 }
 
 // TimestampRequestContributions returns the contributions of this disclosure proof
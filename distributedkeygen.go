@@ -0,0 +1,434 @@
+package gabi
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+)
+
+// Distributed key generation lets n parties jointly generate an issuer key pair, such that none of
+// them learns the factorization of N, using the protocol of Boneh and Franklin ("Efficient
+// generation of shared RSA keys", CRYPTO 97):
+//
+//  1. Each party i chooses shares p_i and q_i of candidate primes p = sum_i p_i and q = sum_i q_i,
+//     such that p = q = 3 mod 4, and shares them among all parties using integer Shamir secret
+//     sharing (see ThresholdSigner), together with a sharing of 0.
+//  2. Each party multiplies its shares, obtaining a share of N = pq, which is then interpolated.
+//  3. If N has small factors, the parties start over. Otherwise they run the biprimality test:
+//     for public random g with Jacobi symbol 1, party 1 computes v_1 = g^{(N - p_1 - q_1 + 1)/4}
+//     and the others v_i = g^{(p_i + q_i)/4}. If p and q are prime, v_1 = +-prod_{i>1} v_i mod N,
+//     while otherwise this fails for at least half of the g.
+//  4. As N = p^a q^b with a > 1 or b > 1 may also pass the biprimality test, the parties check that
+//     gcd(N, p + q - 1) = 1. Each party i shares a random r_i, its share of p + q - 1 and a random
+//     multiple rho_i N of N, after which they multiply and interpolate as in step 2, obtaining
+//     r(p + q - 1) + rho N with r = sum_i r_i and rho = sum_i rho_i, which with overwhelming
+//     probability is coprime to N if and only if p + q - 1 is.
+//  5. The parties jointly generate S as a product of random squares, and Z and the R_i as
+//     products of random powers of S.
+//
+// Afterwards, party 1 holds the share N - p_1 - q_1 + 1 and the others the shares -p_i - q_i of
+// phi(N) = (p-1)(q-1), with which they can sign using ThresholdSigners. The protocol has the same
+// security properties as threshold signing. Note that p and q are not safe primes, so that the
+// key cannot be proven valid using the keyproof package. Revocation is not supported.
+
+// KeygenParty is a party in the distributed generation of an issuer key pair.
+type KeygenParty struct {
+	Params  *gabikeys.SystemParameters
+	Index   int // 1 <= Index <= Parties
+	Parties int
+
+	// Rand is the source of randomness used for key generation. If nil, crypto/rand is used.
+	Rand io.Reader
+
+	p, q *big.Int // shares of the current candidate primes
+}
+
+// KeygenDeal is a message from party From to party To containing the latter's Shamir shares of the
+// shares of the candidate primes of the former, sent over a private channel.
+type KeygenDeal struct {
+	From, To int
+	P        *big.Int
+	Q        *big.Int
+	Zero     *big.Int
+}
+
+// biprimalityTests is the amount of biprimality tests, each of which at most half of the moduli
+// that are not the product of two primes pass.
+const biprimalityTests = 80
+
+// smallPrimesProduct is the product of the odd primes below 2^14, by which N must not be divisible.
+var smallPrimesProduct = func() *big.Int {
+	const bound = 1 << 14
+	composite := make([]bool, bound)
+	product := big.NewInt(1)
+	for i := 3; i < bound; i += 2 {
+		if composite[i] {
+			continue
+		}
+		product.Mul(product, big.NewInt(int64(i)))
+		for j := i * i; j < bound; j += 2 * i {
+			composite[j] = true
+		}
+	}
+	return product
+}()
+
+// NewKeygenParty creates a new party in the distributed generation of an issuer key pair.
+func NewKeygenParty(params *gabikeys.SystemParameters, index, parties int) *KeygenParty {
+	return &KeygenParty{Params: params, Index: index, Parties: parties}
+}
+
+// primeShareSize is the bit size of the shares of the primes. The share of party 1 is increased by
+// 3 * 2^(l_n/2 - 2), so that p and q are in [1.5 * 2^(l_n/2 - 1), 2^(l_n/2)) and N has l_n bits.
+func (k *KeygenParty) primeShareSize() uint {
+	return k.Params.Ln/2 - 3 - uint(big.NewInt(int64(k.Parties)).BitLen())
+}
+
+// randomPrimeShare returns a random share of a candidate prime.
+func (k *KeygenParty) randomPrimeShare() (*big.Int, error) {
+	share, err := common.RandomBigIntFrom(k.Rand, k.primeShareSize())
+	if err != nil {
+		return nil, err
+	}
+	share.Rsh(share, 2).Lsh(share, 2) // 0 mod 4
+	if k.Index == 1 {
+		share.Add(share, new(big.Int).Lsh(big.NewInt(3), k.Params.Ln/2-2))
+		share.Add(share, big.NewInt(3))
+	}
+	return share, nil
+}
+
+// Deal chooses the shares of new candidate primes, returning the KeygenDeals for all parties
+// (including itself) in order of their index.
+func (k *KeygenParty) Deal() ([]*KeygenDeal, error) {
+	var err error
+	if k.p, err = k.randomPrimeShare(); err != nil {
+		return nil, err
+	}
+	if k.q, err = k.randomPrimeShare(); err != nil {
+		return nil, err
+	}
+
+	n, t := k.Parties, (k.Parties-1)/2
+	coefficientSize := k.Params.Ln/2 + k.Params.Lstatzk + 2*uint(factorial(n).BitLen())
+	ps, err := shareInteger(k.Rand, k.p, t, n, coefficientSize)
+	if err != nil {
+		return nil, err
+	}
+	qs, err := shareInteger(k.Rand, k.q, t, n, coefficientSize)
+	if err != nil {
+		return nil, err
+	}
+	zeros, err := shareInteger(k.Rand, big.NewInt(0), 2*t, n,
+		2*coefficientSize+k.Params.Lstatzk+uint(n+2)*uint(big.NewInt(int64(n)).BitLen()))
+	if err != nil {
+		return nil, err
+	}
+
+	deals := make([]*KeygenDeal, n)
+	for j := range deals {
+		deals[j] = &KeygenDeal{From: k.Index, To: j + 1, P: ps[j], Q: qs[j], Zero: zeros[j]}
+	}
+	return deals, nil
+}
+
+// Multiply returns the share of N = pq of this party, computed from the KeygenDeals addressed to
+// it by all parties. Given the KeygenDeals from CoprimalityDeal() instead, it returns the share of
+// r(p + q - 1) + rho N.
+func (k *KeygenParty) Multiply(deals []*KeygenDeal) (*big.Int, error) {
+	if len(deals) != k.Parties {
+		return nil, errors.New("expected a deal from each party")
+	}
+	p, q, zero := big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	for i, deal := range deals {
+		if deal == nil || deal.From != i+1 || deal.To != k.Index || deal.P == nil || deal.Q == nil || deal.Zero == nil {
+			return nil, errors.Errorf("invalid deal %d", i+1)
+		}
+		p.Add(p, deal.P)
+		q.Add(q, deal.Q)
+		zero.Add(zero, deal.Zero)
+	}
+	return p.Mul(p, q).Add(p, zero), nil
+}
+
+// BiprimalityShare returns v_i for the biprimality test of N with the specified g.
+func (k *KeygenParty) BiprimalityShare(N, g *big.Int) (*big.Int, error) {
+	if k.p == nil {
+		return nil, errors.New("no candidate primes")
+	}
+	exp := new(big.Int).Add(k.p, k.q)
+	if k.Index == 1 {
+		exp.Sub(N, exp).Add(exp, big.NewInt(1))
+	}
+	return new(big.Int).Exp(g, exp.Rsh(exp, 2), N), nil
+}
+
+// CoprimalityDeal chooses a random r_i and rho_i, returning the KeygenDeals for all parties
+// (including itself) in order of their index, containing the Shamir shares of r_i, of the share of
+// p + q - 1 of this party and of rho_i N, for the check that gcd(N, p + q - 1) = 1.
+func (k *KeygenParty) CoprimalityDeal(N *big.Int) ([]*KeygenDeal, error) {
+	if k.p == nil {
+		return nil, errors.New("no candidate primes")
+	}
+	s := new(big.Int).Add(k.p, k.q)
+	if k.Index == 1 {
+		s.Sub(s, big.NewInt(1))
+	}
+	n, t := k.Parties, (k.Parties-1)/2
+	nBits := uint(big.NewInt(int64(n)).BitLen())
+	rSize := k.Params.Ln + k.Params.Lstatzk
+	r, err := common.RandomBigIntFrom(k.Rand, rSize)
+	if err != nil {
+		return nil, err
+	}
+	// rho_i N exceeds r(p + q - 1) by Lstatzk bits, statistically hiding it
+	rho, err := common.RandomBigIntFrom(k.Rand, rSize+k.Params.Lstatzk+2*nBits+3-k.Params.Ln/2)
+	if err != nil {
+		return nil, err
+	}
+
+	rCoefficientSize := rSize + k.Params.Lstatzk + 2*uint(factorial(n).BitLen())
+	sCoefficientSize := k.Params.Ln/2 + 1 + k.Params.Lstatzk + 2*uint(factorial(n).BitLen())
+	rs, err := shareInteger(k.Rand, r, t, n, rCoefficientSize)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := shareInteger(k.Rand, s, t, n, sCoefficientSize)
+	if err != nil {
+		return nil, err
+	}
+	// The product of the sharings of r and s has constant coefficient Delta^2 r s, so the
+	// multiple of N is multiplied by Delta before sharing it
+	multiple := new(big.Int).Mul(rho, N)
+	multiple.Mul(multiple, factorial(n))
+	multiples, err := shareInteger(k.Rand, multiple, 2*t, n,
+		rCoefficientSize+sCoefficientSize+k.Params.Lstatzk+uint(n+2)*nBits)
+	if err != nil {
+		return nil, err
+	}
+
+	deals := make([]*KeygenDeal, n)
+	for j := range deals {
+		deals[j] = &KeygenDeal{From: k.Index, To: j + 1, P: rs[j], Q: ss[j], Zero: multiples[j]}
+	}
+	return deals, nil
+}
+
+// BaseShare returns a random square modulo N, the product of those of all parties being S.
+func (k *KeygenParty) BaseShare(N *big.Int) (*big.Int, error) {
+	s, err := big.RandInt(common.RandReader(k.Rand), N)
+	if err != nil {
+		return nil, err
+	}
+	return s.Exp(s, big.NewInt(2), N), nil
+}
+
+// Exponentiate returns random powers of S, the products of those of all parties being Z and
+// R_0, ..., R_{numAttributes-1}.
+func (k *KeygenParty) Exponentiate(N, S *big.Int, numAttributes int) ([]*big.Int, error) {
+	powers := make([]*big.Int, numAttributes+1)
+	for i := range powers {
+		x, err := common.RandomBigIntFrom(k.Rand, k.Params.Ln/2)
+		if err != nil {
+			return nil, err
+		}
+		powers[i] = new(big.Int).Exp(S, x, N)
+	}
+	return powers, nil
+}
+
+// Share returns the share of phi(N) of this party, with which it can sign using a ThresholdSigner.
+func (k *KeygenParty) Share(N *big.Int) (*SignerShare, error) {
+	if k.p == nil {
+		return nil, errors.New("no candidate primes")
+	}
+	share := new(big.Int).Add(k.p, k.q)
+	if k.Index == 1 {
+		share.Sub(N, share).Add(share, big.NewInt(1))
+	} else {
+		share.Neg(share)
+	}
+	return &SignerShare{Index: k.Index, Parties: k.Parties, Share: share}, nil
+}
+
+// GenerateDistributedKeyPair runs the distributed generation of an issuer key pair among the
+// parties in process, returning the public key and the shares of the parties (in order of their
+// index). It returns ctx.Err() if ctx is done before a modulus has been found.
+func GenerateDistributedKeyPair(
+	ctx context.Context, parties []*KeygenParty, numAttributes int, counter uint, expiryDate time.Time,
+) (*gabikeys.PublicKey, []*SignerShare, error) {
+	n := len(parties)
+	if n < 3 {
+		return nil, nil, errors.New("distributed key generation requires at least 3 parties")
+	}
+	param := parties[0].Params
+	if param == nil {
+		return nil, nil, errors.New("no system parameters")
+	}
+	for i, party := range parties {
+		if party.Index != i+1 || party.Parties != n {
+			return nil, nil, errors.New("parties must be ordered by index")
+		}
+		if party.Params == nil || *party.Params != *param {
+			return nil, nil, errors.Errorf("system parameters of party %d differ from those of party 1", party.Index)
+		}
+	}
+
+	N, err := generateDistributedModulus(ctx, parties)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	S := big.NewInt(1)
+	for _, party := range parties {
+		s, err := party.BaseShare(N)
+		if err != nil {
+			return nil, nil, err
+		}
+		S.Mul(S, s).Mod(S, N)
+	}
+	if S.Cmp(big.NewInt(1)) == 0 || new(big.Int).GCD(nil, nil, S, N).Cmp(big.NewInt(1)) != 0 {
+		return nil, nil, errors.New("invalid S")
+	}
+
+	powers := make([]*big.Int, numAttributes+1)
+	for i := range powers {
+		powers[i] = big.NewInt(1)
+	}
+	for _, party := range parties {
+		p, err := party.Exponentiate(N, S, numAttributes)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range powers {
+			powers[i].Mul(powers[i], p[i]).Mod(powers[i], N)
+		}
+	}
+
+	pk := &gabikeys.PublicKey{
+		N: N, Z: powers[0], S: S, R: powers[1:],
+		Params: param, EpochLength: gabikeys.DefaultEpochLength, Counter: counter, ExpiryDate: expiryDate.Unix(),
+	}
+	shares := make([]*SignerShare, n)
+	for i, party := range parties {
+		if shares[i], err = party.Share(N); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pk, shares, nil
+}
+
+// generateDistributedModulus lets the parties generate candidate moduli until one passes the
+// biprimality test.
+func generateDistributedModulus(ctx context.Context, parties []*KeygenParty) (*big.Int, error) {
+	n := len(parties)
+	ln := parties[0].Params.Ln
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		deals := make([][]*KeygenDeal, n) // by recipient
+		for _, party := range parties {
+			d, err := party.Deal()
+			if err != nil {
+				return nil, err
+			}
+			for j := range d {
+				deals[j] = append(deals[j], d[j])
+			}
+		}
+		products := make([]*big.Int, n)
+		for j, party := range parties {
+			var err error
+			if products[j], err = party.Multiply(deals[j]); err != nil {
+				return nil, err
+			}
+		}
+		N, err := interpolateProduct(products)
+		if err != nil {
+			return nil, err
+		}
+		if uint(N.BitLen()) != ln || new(big.Int).GCD(nil, nil, N, smallPrimesProduct).Cmp(big.NewInt(1)) != 0 {
+			continue
+		}
+
+		ok, err := biprime(N, parties)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if ok, err = coprime(N, parties); err != nil {
+			return nil, err
+		}
+		if ok {
+			return N, nil
+		}
+	}
+}
+
+// biprime runs the biprimality test on N, using public g derived from N.
+func biprime(N *big.Int, parties []*KeygenParty) (bool, error) {
+	for i, index := 0, 0; i < biprimalityTests; index++ {
+		g := common.GetHashNumber(N, nil, index, uint(N.BitLen())+128)
+		if g.Mod(g, N); big.Jacobi(g, N) != 1 {
+			continue
+		}
+		i++
+
+		var v1 *big.Int
+		v := big.NewInt(1)
+		for _, party := range parties {
+			vi, err := party.BiprimalityShare(N, g)
+			if err != nil {
+				return false, err
+			}
+			if party.Index == 1 {
+				v1 = vi
+			} else {
+				v.Mul(v, vi).Mod(v, N)
+			}
+		}
+		if v1.Cmp(v) != 0 && v1.Cmp(v.Sub(N, v)) != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// coprime checks that gcd(N, p + q - 1) = 1, by letting the parties jointly compute
+// r(p + q - 1) + rho N for random r and rho.
+func coprime(N *big.Int, parties []*KeygenParty) (bool, error) {
+	n := len(parties)
+	deals := make([][]*KeygenDeal, n) // by recipient
+	for _, party := range parties {
+		d, err := party.CoprimalityDeal(N)
+		if err != nil {
+			return false, err
+		}
+		for j := range d {
+			deals[j] = append(deals[j], d[j])
+		}
+	}
+	products := make([]*big.Int, n)
+	for j, party := range parties {
+		var err error
+		if products[j], err = party.Multiply(deals[j]); err != nil {
+			return false, err
+		}
+	}
+	z, err := interpolateProduct(products)
+	if err != nil {
+		return false, err
+	}
+	return new(big.Int).GCD(nil, nil, z, N).Cmp(big.NewInt(1)) == 0, nil
+}
@@ -5,11 +5,17 @@
 package gabi
 
 import (
+	stdcontext "context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/fxamacker/cbor"
 	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/gabikeys"
@@ -17,6 +23,8 @@ import (
 	"github.com/privacybydesign/gabi/rangeproof"
 	"github.com/privacybydesign/gabi/revocation"
 	"github.com/privacybydesign/gabi/safeprime"
+	"github.com/privacybydesign/gabi/setmembership"
+	"github.com/privacybydesign/gabi/verenc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -307,7 +315,7 @@ func TestProofS(t *testing.T) {
 	assert.NoError(t, err)
 
 	issuer := NewIssuer(testPrivK, testPubK, context)
-	sig, _, err := issuer.signCommitmentAndAttributes(U, testAttributes1, nil)
+	sig, _, err := issuer.signCommitmentAndAttributes(U, testAttributes1, nil, nil)
 	assert.NoError(t, err)
 
 	proof, err := issuer.proveSignature(sig, nonce)
@@ -424,6 +432,51 @@ func TestCombinedShowingProof(t *testing.T) {
 	assert.True(t, prooflist.Verify([]*gabikeys.PublicKey{issuer1.Pk, issuer2.Pk}, context, nonce1, false, nil), "Prooflist does not verify whereas it should!")
 }
 
+func TestLinkedAttributesShowingProof(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK.Params.Lh)
+	assert.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	assert.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK.Params.Lm)
+	assert.NoError(t, err)
+
+	issuer1 := NewIssuer(testPrivK1, testPubK1, context)
+	cred1 := createCredential(t, context, secret, issuer1)
+	issuer2 := NewIssuer(testPrivK2, testPubK2, context)
+	cred2 := createCredential(t, context, secret, issuer2)
+	pks := []*gabikeys.PublicKey{issuer1.Pk, issuer2.Pk}
+
+	b1, err := cred1.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	b2, err := cred2.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	require.Error(t, b1.LinkAttribute(0, "bsn"))
+	require.Error(t, b1.LinkAttribute(1, "bsn"))
+	require.Error(t, b1.LinkAttribute(2, "secretkey"))
+	require.NoError(t, b1.LinkAttribute(2, "bsn"))
+	require.NoError(t, b2.LinkAttribute(2, "bsn"))
+	require.NoError(t, b1.LinkAttribute(3, "other"))
+	require.NoError(t, b2.LinkAttribute(4, "other"))
+
+	prooflist, err := ProofBuilderList{b1, b2}.BuildProofList(context, nonce1, false)
+	require.NoError(t, err)
+
+	assert.True(t, prooflist.VerifyWithLinks(pks, context, nonce1, false, nil, AttributeLinks{
+		"bsn": {{Proof: 0, Attribute: 2}, {Proof: 1, Attribute: 2}},
+	}), "Linked attributes do not verify whereas they should")
+	assert.False(t, prooflist.VerifyWithLinks(pks, context, nonce1, false, nil, AttributeLinks{
+		"other": {{Proof: 0, Attribute: 3}, {Proof: 1, Attribute: 4}},
+	}), "Linked unequal attributes verify whereas they should not")
+	assert.False(t, prooflist.VerifyWithLinks(pks, context, nonce1, false, nil, AttributeLinks{
+		"bsn": {{Proof: 0, Attribute: 1}, {Proof: 1, Attribute: 2}},
+	}), "Link containing disclosed attribute verifies whereas it should not")
+	for _, refs := range [][]AttributeRef{nil, {{Proof: 0, Attribute: 2}}} {
+		err = prooflist.VerifyDetailed(pks, context, nonce1, false, nil, AttributeLinks{"bsn": refs})
+		assert.True(t, stderrors.Is(err, ErrAttributeLink), "Link of %d attributes verifies whereas it should not", len(refs))
+	}
+	assert.True(t, prooflist.Verify(pks, context, nonce1, false, nil))
+}
+
 // A convenience function for initializing big integers from known correct (10
 // base) strings. Use with care, errors are ignored.
 func s2big(s string) (r *big.Int) {
@@ -620,6 +673,150 @@ func createCredential(t *testing.T, context, secret *big.Int, issuer *Issuer) *C
 	return cred
 }
 
+func TestThresholdIssuance(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	for _, parties := range []int{3, 4, 5} {
+		shares, err := SplitPrivateKey(nil, testPrivK1, testPubK1, parties)
+		require.NoError(t, err)
+		sum := big.NewInt(0)
+		signers := make([]*ThresholdSigner, parties)
+		for i, share := range shares {
+			assert.NotEqual(t, testPrivK1.Order, share.Share)
+			sum.Add(sum, share.Share)
+			signers[i] = NewThresholdSigner(testPubK1, share)
+		}
+		assert.Equal(t, testPrivK1.Order, sum)
+
+		issuer := NewThresholdIssuer(testPubK1, context, signers)
+		nonce1, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+		require.NoError(t, err)
+		nonce2, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+		require.NoError(t, err)
+		cb, err := NewCredentialBuilder(testPubK1, context, secret, nonce2, nil)
+		require.NoError(t, err)
+		commitMsg, err := cb.CommitToSecretAndProve(nonce1)
+		require.NoError(t, err)
+		ism, err := issuer.IssueSignature(commitMsg.U, testAttributes1, nil, nonce2, nil)
+		require.NoError(t, err)
+		assert.True(t, ism.Proof.Verify(testPubK1, ism.Signature, context, nonce2))
+		assert.False(t, ism.Proof.Verify(testPubK1, ism.Signature, context, nonce1))
+
+		// The credential is indistinguishable from one issued by a single issuer
+		cred, err := cb.ConstructCredential(ism, testAttributes1)
+		require.NoError(t, err)
+		assert.True(t, cred.Signature.Verify(testPubK1, append([]*big.Int{secret}, testAttributes1...)))
+		nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+		require.NoError(t, err)
+		proof, err := cred.CreateDisclosureProof([]int{1, 2}, nil, false, context, nonce)
+		require.NoError(t, err)
+		assert.True(t, proof.Verify(testPubK1, context, nonce, false))
+	}
+
+	// All parties must participate, in order of their index
+	shares, err := SplitPrivateKey(nil, testPrivK1, testPubK1, 3)
+	require.NoError(t, err)
+	signers := []*ThresholdSigner{NewThresholdSigner(testPubK1, shares[0]), NewThresholdSigner(testPubK1, shares[1])}
+	_, err = NewThresholdIssuer(testPubK1, context, signers).IssueSignature(big.NewInt(1), testAttributes1, nil, context, nil)
+	assert.Error(t, err)
+	signers = append(signers, NewThresholdSigner(testPubK1, shares[2]))
+	signers[0], signers[1] = signers[1], signers[0]
+	_, err = NewThresholdIssuer(testPubK1, context, signers).IssueSignature(big.NewInt(1), testAttributes1, nil, context, nil)
+	assert.Error(t, err)
+	_, err = SplitPrivateKey(nil, testPrivK1, testPubK1, 2)
+	assert.Error(t, err)
+
+	// Tampered shares of gamma are detected
+	signer := NewThresholdSigner(testPubK1, shares[0])
+	_, err = signer.Deal(big.NewInt(4), big.NewInt(65537))
+	require.NoError(t, err)
+	_, err = signer.Exponentiate([]*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)})
+	assert.Error(t, err)
+}
+
+func TestDistributedKeyGeneration(t *testing.T) {
+	params := gabikeys.DefaultSystemParameters[1024]
+	parties := make([]*KeygenParty, 3)
+	for i := range parties {
+		parties[i] = NewKeygenParty(params, i+1, len(parties))
+	}
+	pk, shares, err := GenerateDistributedKeyPair(stdcontext.Background(), parties, 6, 1, time.Now().AddDate(1, 0, 0))
+	require.NoError(t, err)
+	assert.Equal(t, 1024, pk.N.BitLen())
+	assert.Len(t, pk.R, 6)
+	assert.Equal(t, 1, big.Jacobi(pk.S, pk.N))
+	require.Len(t, shares, 3)
+
+	// The shares can be used for threshold issuance
+	signers := make([]*ThresholdSigner, len(shares))
+	for i, share := range shares {
+		signers[i] = NewThresholdSigner(pk, share)
+	}
+	context, err := common.RandomBigInt(pk.Params.Lh)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(pk.Params.Lm)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(pk.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(pk.Params.Lstatzk)
+	require.NoError(t, err)
+	cb, err := NewCredentialBuilder(pk, context, secret, nonce2, nil)
+	require.NoError(t, err)
+	commitMsg, err := cb.CommitToSecretAndProve(nonce1)
+	require.NoError(t, err)
+	ism, err := NewThresholdIssuer(pk, context, signers).IssueSignature(commitMsg.U, testAttributes1, nil, nonce2, nil)
+	require.NoError(t, err)
+	cred, err := cb.ConstructCredential(ism, testAttributes1)
+	require.NoError(t, err)
+	proof, err := cred.CreateDisclosureProof([]int{1}, nil, false, context, nonce1)
+	require.NoError(t, err)
+	assert.True(t, proof.Verify(pk, context, nonce1, false))
+
+	// Too few or misordered parties are rejected
+	_, _, err = GenerateDistributedKeyPair(stdcontext.Background(), parties[:2], 6, 1, time.Now())
+	assert.Error(t, err)
+	parties[0], parties[1] = parties[1], parties[0]
+	_, _, err = GenerateDistributedKeyPair(stdcontext.Background(), parties, 6, 1, time.Now())
+	assert.Error(t, err)
+	parties[0], parties[1] = parties[1], parties[0]
+	cancelled, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	_, _, err = GenerateDistributedKeyPair(cancelled, parties, 6, 1, time.Now())
+	assert.Equal(t, stdcontext.Canceled, err)
+
+	// Parameters are compared by value
+	same := *params
+	parties[1].Params = &same
+	_, _, err = GenerateDistributedKeyPair(cancelled, parties, 6, 1, time.Now())
+	assert.Equal(t, stdcontext.Canceled, err)
+	other := *params
+	other.Lstatzk++
+	parties[1].Params = &other
+	_, _, err = GenerateDistributedKeyPair(cancelled, parties, 6, 1, time.Now())
+	assert.EqualError(t, err, "system parameters of party 2 differ from those of party 1")
+	parties[1].Params = params
+
+	// Candidate primes p, q such that gcd(N, p + q - 1) != 1 are rejected
+	setPrimes := func(p, q int64) {
+		for _, party := range parties {
+			party.p, party.q = big.NewInt(0), big.NewInt(0)
+		}
+		parties[0].p, parties[0].q = big.NewInt(p), big.NewInt(q)
+	}
+	p, q := int64(1<<61-1), int64(1<<31-1)
+	setPrimes(p, q)
+	ok, err := coprime(new(big.Int).Mul(big.NewInt(p), big.NewInt(q)), parties)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	setPrimes(15, 7)
+	ok, err = coprime(big.NewInt(15*7), parties)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
 var squaresTable = rangeproof.GenerateSquaresTable(65535)
 
 func TestRangeProofGreaterOrEqual(t *testing.T) {
@@ -654,6 +851,156 @@ func TestRangeProofFalseStatement(t *testing.T) {
 	testRangeProofs(t, false, []*rangeproof.Statement{stmt})
 }
 
+func TestRangeProofNotEqual(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	issuer := NewIssuer(testPrivK1, testPubK1, context)
+	cred := createCredential(t, context, secret, issuer)
+
+	stmt, err := rangeproof.NewStatement(rangeproof.NotEqual, new(big.Int).Add(testAttributes1[0], big.NewInt(1)))
+	require.NoError(t, err)
+	geq, err := rangeproof.NewStatement(rangeproof.GreaterOrEqual, new(big.Int).Sub(testAttributes1[0], big.NewInt(63)))
+	require.NoError(t, err)
+	proof, err := cred.CreateDisclosureProof(
+		[]int{2}, map[int][]*rangeproof.Statement{1: {stmt, geq}}, false, context, nonce,
+	)
+	require.NoError(t, err)
+	assert.True(t, proof.Verify(testPubK1, context, nonce, false))
+	assert.True(t, proof.RangeProofs[1][0].Proves(stmt))
+	assert.False(t, proof.RangeProofs[1][0].Proves(geq))
+	assert.True(t, proof.RangeProofs[1][1].Proves(geq))
+
+	// Claiming another bound invalidates the proof
+	proof.RangeProofs[1][0].K.Add(proof.RangeProofs[1][0].K, big.NewInt(1))
+	proof.cachedRangeStructures = nil
+	assert.False(t, proof.Verify(testPubK1, context, nonce, false))
+
+	stmt, err = rangeproof.NewStatement(rangeproof.NotEqual, testAttributes1[0])
+	require.NoError(t, err)
+	_, err = cred.CreateDisclosureProof(
+		[]int{2}, map[int][]*rangeproof.Statement{1: {stmt}}, false, context, nonce,
+	)
+	require.Equal(t, rangeproof.ErrFalseStatement, err)
+}
+
+func TestRangeProofRelation(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	issuer := NewIssuer(testPrivK1, testPubK1, context)
+	cred := createCredential(t, context, secret, issuer)
+
+	// Attribute 3 is testAttributes1[2], attribute 1 is testAttributes1[0]
+	diff := new(big.Int).Sub(testAttributes1[2], testAttributes1[0])
+	geq, err := rangeproof.NewRelationStatement(rangeproof.GreaterOrEqual, 1, new(big.Int).Sub(diff, big.NewInt(10)))
+	require.NoError(t, err)
+	neq, err := rangeproof.NewRelationStatement(rangeproof.NotEqual, 1, big.NewInt(0))
+	require.NoError(t, err)
+
+	_, err = cred.CreateDisclosureProofBuilder([]int{1}, map[int][]*rangeproof.Statement{3: {geq}}, false)
+	require.Error(t, err)
+
+	proof, err := cred.CreateDisclosureProof(
+		[]int{2}, map[int][]*rangeproof.Statement{3: {geq, neq}}, false, context, nonce,
+	)
+	require.NoError(t, err)
+	assert.True(t, proof.Verify(testPubK1, context, nonce, false))
+	assert.True(t, proof.RangeProofs[3][0].Proves(geq))
+	assert.True(t, proof.RangeProofs[3][1].Proves(neq))
+
+	// Relating to another attribute invalidates the proof
+	proof.RangeProofs[3][0].Other.Index = 4
+	proof.cachedRangeStructures = nil
+	assert.False(t, proof.Verify(testPubK1, context, nonce, false))
+
+	geq, err = rangeproof.NewRelationStatement(rangeproof.GreaterOrEqual, 1, new(big.Int).Add(diff, big.NewInt(1)))
+	require.NoError(t, err)
+	_, err = cred.CreateDisclosureProof(
+		[]int{2}, map[int][]*rangeproof.Statement{3: {geq}}, false, context, nonce,
+	)
+	require.Equal(t, rangeproof.ErrFalseStatement, err)
+}
+
+func TestRangeProofCrossCredential(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	cred1 := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	cred2 := createCredential(t, context, secret, NewIssuer(testPrivK2, testPubK2, context))
+	keys := []*gabikeys.PublicKey{testPubK1, testPubK2}
+
+	// Attribute 3 of cred1 is at least twice attribute 1 of cred2
+	proofIndex := 1
+	stmt := &rangeproof.Statement{Sign: 1, Factor: 1, Bound: big.NewInt(0),
+		Other: &rangeproof.OtherAttribute{Index: 1, Factor: 2, Proof: &proofIndex}}
+
+	b1, err := cred1.CreateDisclosureProofBuilder([]int{2}, map[int][]*rangeproof.Statement{3: {stmt}}, false)
+	require.NoError(t, err)
+	b2, err := cred2.CreateDisclosureProofBuilder([]int{2}, nil, false)
+	require.NoError(t, err)
+	prooflist, err := ProofBuilderList{b1, b2}.BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+
+	// Serialize and deserialize the proofs as a verifier would receive them
+	bts, err := json.Marshal(prooflist)
+	require.NoError(t, err)
+	var received ProofList
+	require.NoError(t, json.Unmarshal(bts, &received))
+	assert.True(t, received.Verify(keys, context, nonce, false, nil))
+	assert.True(t, received[0].(*ProofD).RangeProofs[3][0].Proves(stmt))
+
+	// The proof does not verify on its own, nor against another attribute
+	require.NoError(t, json.Unmarshal(bts, &received))
+	assert.False(t, received[0].(*ProofD).Verify(testPubK1, context, nonce, false))
+	require.NoError(t, json.Unmarshal(bts, &received))
+	received[0].(*ProofD).RangeProofs[3][0].Other.Index = 3
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+	require.NoError(t, json.Unmarshal(bts, &received))
+	received[0].(*ProofD).RangeProofs[3][0].Other.Index = 2
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+
+	// Linked attributes can also be referred to
+	b1, err = cred1.CreateDisclosureProofBuilder([]int{2}, map[int][]*rangeproof.Statement{3: {stmt}}, false)
+	require.NoError(t, err)
+	b2, err = cred2.CreateDisclosureProofBuilder([]int{2}, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, b1.LinkAttribute(1, "one"))
+	require.NoError(t, b2.LinkAttribute(1, "one"))
+	prooflist, err = ProofBuilderList{b1, b2}.BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+	assert.True(t, prooflist.VerifyWithLinks(keys, context, nonce, false, nil,
+		AttributeLinks{"one": {{Proof: 0, Attribute: 1}, {Proof: 1, Attribute: 1}}}))
+
+	// False statements and disclosed attributes
+	stmt.Sign = -1
+	b1, err = cred1.CreateDisclosureProofBuilder([]int{2}, map[int][]*rangeproof.Statement{3: {stmt}}, false)
+	require.NoError(t, err)
+	b2, err = cred2.CreateDisclosureProofBuilder([]int{2}, nil, false)
+	require.NoError(t, err)
+	_, err = ProofBuilderList{b1, b2}.BuildProofList(context, nonce, false)
+	require.Equal(t, rangeproof.ErrFalseStatement, err)
+
+	stmt.Sign = 1
+	stmt.Other.Index = 2
+	b1, err = cred1.CreateDisclosureProofBuilder([]int{2}, map[int][]*rangeproof.Statement{3: {stmt}}, false)
+	require.NoError(t, err)
+	_, err = ProofBuilderList{b1, b2}.BuildProofList(context, nonce, false)
+	require.Error(t, err)
+}
+
 func testRangeProofs(t *testing.T, trueStatements bool, statements []*rangeproof.Statement) {
 	for _, splitter := range []rangeproof.SquareSplitter{nil, squaresTable} {
 		context, err := common.RandomBigInt(testPubK1.Params.Lh)
@@ -707,6 +1054,469 @@ func testRangeProofs(t *testing.T, trueStatements bool, statements []*rangeproof
 	}
 }
 
+func TestSetMembershipProof(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	issuer := NewIssuer(testPrivK1, testPubK1, context)
+	cred := createCredential(t, context, secret, issuer)
+
+	set := []*big.Int{big.NewInt(1), new(big.Int).Set(testAttributes1[0]), big.NewInt(3)}
+	stmt, err := setmembership.NewStatement(set)
+	require.NoError(t, err)
+
+	builder, err := cred.CreateDisclosureProofBuilder([]int{2}, nil, false)
+	require.NoError(t, err)
+	require.Error(t, builder.AddSetMembershipStatement(2, stmt))
+	require.Error(t, builder.AddSetMembershipStatement(len(cred.Attributes), stmt))
+	require.NoError(t, builder.AddSetMembershipStatement(1, stmt))
+	prooflist, err := ProofBuilderList{builder}.BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+
+	// Serialize and deserialize the proof as a verifier would receive it
+	bts, err := json.Marshal(prooflist[0])
+	require.NoError(t, err)
+	proof := &ProofD{}
+	require.NoError(t, json.Unmarshal(bts, proof))
+	require.Len(t, proof.SetMembershipProofs[1], 1)
+
+	assert.True(t, proof.Verify(testPubK1, context, nonce, false))
+	assert.True(t, proof.SetMembershipProofs[1][0].Proves(stmt))
+	assert.Equal(t, stmt, proof.SetMembershipProofs[1][0].ProvenStatement())
+
+	// A proof that claims a different set must not verify
+	proof = &ProofD{}
+	require.NoError(t, json.Unmarshal(bts, proof))
+	proof.SetMembershipProofs[1][0].Set[1] = big.NewInt(2)
+	assert.False(t, proof.Verify(testPubK1, context, nonce, false))
+
+	// A proof about another attribute must not verify
+	proof = &ProofD{}
+	require.NoError(t, json.Unmarshal(bts, proof))
+	proof.SetMembershipProofs[3] = proof.SetMembershipProofs[1]
+	delete(proof.SetMembershipProofs, 1)
+	assert.False(t, proof.Verify(testPubK1, context, nonce, false))
+
+	// Statements that do not hold cannot be proven
+	stmt, err = setmembership.NewStatement([]*big.Int{big.NewInt(1), big.NewInt(3)})
+	require.NoError(t, err)
+	builder, err = cred.CreateDisclosureProofBuilder([]int{2}, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, builder.AddSetMembershipStatement(1, stmt))
+	_, err = ProofBuilderList{builder}.BuildProofList(context, nonce, false)
+	require.Equal(t, setmembership.ErrFalseStatement, err)
+}
+
+func TestDomainPseudonym(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+
+	nymProof := func(scope string, secret *big.Int) ProofList {
+		db, err := cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+		require.NoError(t, err)
+		nb, err := NewDomainPseudonymBuilder(scope, secret)
+		require.NoError(t, err)
+		prooflist, err := ProofBuilderList{db, nb}.BuildProofList(context, nonce, false)
+		require.NoError(t, err)
+		return prooflist
+	}
+	keys := []*gabikeys.PublicKey{testPubK1, nil}
+
+	// Pseudonyms are deterministic per scope, and differ between scopes
+	prooflist := nymProof("example.com", secret)
+	nym := prooflist[1].(*ProofNym).Nym
+	assert.True(t, prooflist.Verify(keys, context, nonce, false, nil))
+	assert.Equal(t, nym, nymProof("example.com", secret)[1].(*ProofNym).Nym)
+	assert.NotEqual(t, nym, nymProof("example.org", secret)[1].(*ProofNym).Nym)
+
+	// Serialize and deserialize the proofs as a verifier would receive them
+	bts, err := json.Marshal(prooflist)
+	require.NoError(t, err)
+	var received ProofList
+	require.NoError(t, json.Unmarshal(bts, &received))
+	require.IsType(t, &ProofNym{}, received[1])
+	assert.True(t, received.Verify(keys, context, nonce, false, nil))
+
+	// The pseudonym does not verify for another scope
+	received[1].(*ProofNym).Scope = "example.org"
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+
+	// A pseudonym of another secret key is rejected, although the proof of knowledge is valid
+	other, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	prooflist = nymProof("example.com", other)
+	assert.True(t, prooflist[1].(*ProofNym).VerifyWithChallenge(nil, prooflist[0].(*ProofD).C))
+	assert.False(t, prooflist.Verify(keys, context, nonce, false, nil))
+
+	_, err = NewDomainPseudonymBuilder("", secret)
+	assert.Error(t, err)
+}
+
+// secretKeyProofBuilder is a ProofBuilder that is not part of gabi, proving knowledge of the
+// secret key in P = R_0^secret.
+type secretKeyProofBuilder struct {
+	pk                 *gabikeys.PublicKey
+	secret, randomizer *big.Int
+}
+
+type secretKeyProof struct {
+	P         *big.Int `json:"P"`
+	C         *big.Int `json:"c"`
+	SResponse *big.Int `json:"s_response"`
+}
+
+var registerSecretKeyProof sync.Once
+
+func (b *secretKeyProofBuilder) Commit(randomizers map[string]*big.Int) ([]*big.Int, error) {
+	b.randomizer = randomizers["secretkey"]
+	return []*big.Int{b.pk.ExpModN(b.pk.R[0], b.secret), b.pk.ExpModN(b.pk.R[0], b.randomizer)}, nil
+}
+
+func (b *secretKeyProofBuilder) CreateProof(challenge *big.Int) Proof {
+	response := new(big.Int).Mul(challenge, b.secret)
+	return &secretKeyProof{
+		P:         b.pk.ExpModN(b.pk.R[0], b.secret),
+		C:         challenge,
+		SResponse: response.Add(b.randomizer, response),
+	}
+}
+
+func (b *secretKeyProofBuilder) PublicKey() *gabikeys.PublicKey          { return b.pk }
+func (b *secretKeyProofBuilder) MergeProofPCommitment(*ProofPCommitment) {}
+
+func (p *secretKeyProof) VerifyWithChallenge(_ *gabikeys.PublicKey, challenge *big.Int) bool {
+	return p.C.Cmp(challenge) == 0
+}
+
+func (p *secretKeyProof) ChallengeContribution(pk *gabikeys.PublicKey) ([]*big.Int, error) {
+	// commit = R_0^s * P^-c
+	pc := new(big.Int).Exp(p.P, p.C, pk.N)
+	if pc.ModInverse(pc, pk.N) == nil {
+		return nil, common.ErrNoModInverse
+	}
+	commit := pk.ExpModN(pk.R[0], p.SResponse)
+	return []*big.Int{p.P, commit.Mul(commit, pc).Mod(commit, pk.N)}, nil
+}
+
+func (p *secretKeyProof) SecretKeyResponse() *big.Int              { return p.SResponse }
+func (p *secretKeyProof) MergeProofP(*ProofP, *gabikeys.PublicKey) {}
+
+func TestProofTypeRegistry(t *testing.T) {
+	registerSecretKeyProof.Do(func() {
+		RegisterProofType(ProofType{Name: "test-secretkey", New: func() Proof { return &secretKeyProof{} }})
+	})
+	assert.Panics(t, func() {
+		RegisterProofType(ProofType{Name: "test-secretkey", New: func() Proof { return &ProofNym{} }})
+	})
+	assert.Panics(t, func() {
+		RegisterProofType(ProofType{Name: "test-proofd", New: func() Proof { return &ProofD{} }})
+	})
+
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	keys := []*gabikeys.PublicKey{testPubK1, testPubK1}
+
+	db, err := cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	prooflist, err := ProofBuilderList{db, &secretKeyProofBuilder{pk: testPubK1, secret: secret}}.
+		BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+	require.True(t, prooflist.Verify(keys, context, nonce, false, nil))
+
+	// Proofs are tagged with their type, and decoded accordingly
+	bts, err := json.Marshal(prooflist)
+	require.NoError(t, err)
+	var tagged []struct {
+		Type string `json:"type"`
+	}
+	require.NoError(t, json.Unmarshal(bts, &tagged))
+	require.Len(t, tagged, 2)
+	assert.Equal(t, "ProofD", tagged[0].Type)
+	assert.Equal(t, "test-secretkey", tagged[1].Type)
+	var received ProofList
+	require.NoError(t, json.Unmarshal(bts, &received))
+	require.IsType(t, &ProofD{}, received[0])
+	require.IsType(t, &secretKeyProof{}, received[1])
+	assert.True(t, received.Verify(keys, context, nonce, false, nil))
+
+	bts, err = cbor.Marshal(prooflist, cbor.EncOptions{})
+	require.NoError(t, err)
+	received = nil
+	require.NoError(t, cbor.Unmarshal(bts, &received))
+	require.IsType(t, &ProofD{}, received[0])
+	require.IsType(t, &secretKeyProof{}, received[1])
+	assert.True(t, received.Verify(keys, context, nonce, false, nil))
+
+	// Untagged proofs, as encoded by previous versions, are still decoded if they are detectable
+	db, err = cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	nb, err := NewDomainPseudonymBuilder("example.com", secret)
+	require.NoError(t, err)
+	prooflist, err = ProofBuilderList{db, nb}.BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+	bts, err = json.Marshal([]Proof(prooflist))
+	require.NoError(t, err)
+	assert.NotContains(t, string(bts), `"type"`)
+	received = nil
+	require.NoError(t, json.Unmarshal(bts, &received))
+	require.IsType(t, &ProofD{}, received[0])
+	require.IsType(t, &ProofNym{}, received[1])
+	assert.True(t, received.Verify([]*gabikeys.PublicKey{testPubK1, nil}, context, nonce, false, nil))
+
+	// Unknown type names are rejected
+	assert.Error(t, json.Unmarshal([]byte(`[{"type":"unknown","A":"AQ=="}]`), &received))
+	assert.Error(t, json.Unmarshal([]byte(`[{"P":"AQ=="}]`), &received))
+}
+
+func TestVerifiableEncryption(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	inspector, err := verenc.GenerateKey(1024)
+	require.NoError(t, err)
+
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	keys := []*gabikeys.PublicKey{testPubK1, testPubK1}
+	label := []byte("label")
+
+	db, err := cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	vb, err := NewVerifiableEncryptionBuilder(db, 2, &inspector.PublicKey, label)
+	require.NoError(t, err)
+	prooflist, err := ProofBuilderList{db, vb}.BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+	assert.True(t, prooflist.Verify(keys, context, nonce, false, nil))
+
+	// Serialize and deserialize the proofs as a verifier would receive them
+	bts, err := json.Marshal(prooflist)
+	require.NoError(t, err)
+	var received ProofList
+	require.NoError(t, json.Unmarshal(bts, &received))
+	require.IsType(t, &ProofVerEnc{}, received[1])
+	assert.True(t, received.Verify(keys, context, nonce, false, nil))
+
+	// The inspector decrypts the attribute
+	proof := received[1].(*ProofVerEnc)
+	assert.True(t, proof.Inspector.Equal(&inspector.PublicKey))
+	attr, err := proof.Decrypt(inspector)
+	require.NoError(t, err)
+	assert.Equal(t, cred.Attributes[2], attr)
+
+	// The ciphertext must contain the attribute it refers to
+	proof.Attribute = 3
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+	proof.Attribute = 1
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+	proof.Attribute = 2
+	proof.Encryption.Ciphertext.E.Add(proof.Encryption.Ciphertext.E, big.NewInt(1))
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+
+	// Builders must be in the same list, and can only encrypt undisclosed attributes
+	_, err = ProofBuilderList{vb}.BuildProofList(context, nonce, false)
+	assert.Error(t, err)
+	_, err = NewVerifiableEncryptionBuilder(db, 1, &inspector.PublicKey, label)
+	assert.Error(t, err)
+	_, err = NewVerifiableEncryptionBuilder(db, 0, &inspector.PublicKey, label)
+	assert.Error(t, err)
+}
+
+func TestAttributeCommitment(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	keys := []*gabikeys.PublicKey{testPubK1}
+
+	db, err := cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	opening2, err := db.CommitToAttribute(2)
+	require.NoError(t, err)
+	opening4, err := db.CommitToAttribute(4)
+	require.NoError(t, err)
+	prooflist, err := ProofBuilderList{db}.BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+	assert.True(t, prooflist.Verify(keys, context, nonce, false, nil))
+
+	// The holder keeps the openings of the commitments in the proof
+	assert.True(t, opening2.Verify(testPubK1))
+	assert.Equal(t, cred.Attributes[2], opening2.Attribute)
+	assert.Equal(t, cred.Attributes[4], opening4.Attribute)
+
+	// Serialize and deserialize the proofs as a verifier would receive them
+	bts, err := json.Marshal(prooflist)
+	require.NoError(t, err)
+	var received ProofList
+	require.NoError(t, json.Unmarshal(bts, &received))
+	assert.True(t, received.Verify(keys, context, nonce, false, nil))
+	proofd := received[0].(*ProofD)
+	require.Len(t, proofd.AttributeCommitments, 2)
+	assert.Equal(t, opening2.Commitment, proofd.AttributeCommitments[2].C)
+
+	// The commitments must commit to the attributes they are associated to
+	proofd.AttributeCommitments[2], proofd.AttributeCommitments[4] =
+		proofd.AttributeCommitments[4], proofd.AttributeCommitments[2]
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+	proofd.AttributeCommitments[2], proofd.AttributeCommitments[4] =
+		proofd.AttributeCommitments[4], proofd.AttributeCommitments[2]
+	proofd.AttributeCommitments[2].C = new(big.Int).Mul(proofd.AttributeCommitments[2].C, testPubK1.S)
+	assert.False(t, received.Verify(keys, context, nonce, false, nil))
+
+	// Only undisclosed attributes other than the secret key can be committed to
+	_, err = db.CommitToAttribute(1)
+	assert.Error(t, err)
+	_, err = db.CommitToAttribute(0)
+	assert.Error(t, err)
+	_, err = db.CommitToAttribute(2)
+	assert.Error(t, err)
+}
+
+func TestShowTag(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	// Credentials with a limit of 3 showings as attribute 1, and a random serial as attribute 2
+	issue := func(secret *big.Int) *Credential {
+		serial, err := common.RandomBigInt(testPubK1.Params.Lm)
+		require.NoError(t, err)
+		attributes := []*big.Int{big.NewInt(3), serial, testAttributes1[2], testAttributes1[3]}
+		cb, err := NewCredentialBuilder(testPubK1, context, secret, nonce, nil)
+		require.NoError(t, err)
+		commitMsg, err := cb.CommitToSecretAndProve(nonce)
+		require.NoError(t, err)
+		msg, err := NewIssuer(testPrivK1, testPubK1, context).IssueSignature(commitMsg.U, attributes, nil, nonce, nil)
+		require.NoError(t, err)
+		cred, err := cb.ConstructCredential(msg, attributes)
+		require.NoError(t, err)
+		return cred
+	}
+	cred := issue(secret)
+	keys := []*gabikeys.PublicKey{testPubK1}
+	show := func(cred *Credential, epoch uint64, counter int) (*big.Int, ProofList) {
+		db, err := cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+		require.NoError(t, err)
+		tag, err := db.LimitShowings("voucher", epoch, 2, 1, counter)
+		require.NoError(t, err)
+		prooflist, err := ProofBuilderList{db}.BuildProofList(context, nonce, false)
+		require.NoError(t, err)
+
+		// Serialize and deserialize the proofs as a verifier would receive them
+		bts, err := json.Marshal(prooflist)
+		require.NoError(t, err)
+		var received ProofList
+		require.NoError(t, json.Unmarshal(bts, &received))
+		require.NoError(t, received.VerifyDetailed(keys, context, nonce, false, nil, nil))
+		require.True(t, received[0].(*ProofD).ShowTag.Proves("voucher", epoch, 2, 1))
+		assert.Equal(t, 3, received[0].(*ProofD).ShowTag.Limit)
+		assert.Equal(t, tag, received[0].(*ProofD).ShowTag.Tag)
+		return tag, received
+	}
+
+	// Showings with distinct counters or epochs are unlinkable
+	registry := NewShowTagRegistry()
+	tag0, prooflist := show(cred, 1, 0)
+	_, err = registry.Register(prooflist[0].(*ProofD).ShowTag, "session 1")
+	require.NoError(t, err)
+	tag1, prooflist := show(cred, 1, 1)
+	assert.NotEqual(t, tag0, tag1)
+	_, err = registry.Register(prooflist[0].(*ProofD).ShowTag, "session 2")
+	require.NoError(t, err)
+	tag2, prooflist := show(cred, 2, 0)
+	assert.NotEqual(t, tag0, tag2)
+	_, err = registry.Register(prooflist[0].(*ProofD).ShowTag, "session 3")
+	require.NoError(t, err)
+
+	// Other holders, and other credentials of the same holder, using the same counter are unaffected
+	secret2, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	tag3, prooflist := show(issue(secret2), 1, 0)
+	assert.NotEqual(t, tag0, tag3)
+	_, err = registry.Register(prooflist[0].(*ProofD).ShowTag, "session 4")
+	require.NoError(t, err)
+	tag4, prooflist := show(issue(secret), 1, 0)
+	assert.NotEqual(t, tag0, tag4)
+	_, err = registry.Register(prooflist[0].(*ProofD).ShowTag, "session 5")
+	require.NoError(t, err)
+
+	// Reusing a counter links the showings
+	tag5, prooflist := show(cred, 1, 0)
+	assert.Equal(t, tag0, tag5)
+	session, err := registry.Register(prooflist[0].(*ProofD).ShowTag, "session 6")
+	assert.Equal(t, ErrDoubleShow, err)
+	assert.Equal(t, "session 1", session)
+	registry.Prune("voucher", 2)
+	_, err = registry.Register(prooflist[0].(*ProofD).ShowTag, "session 6")
+	assert.NoError(t, err)
+
+	// The tag must be bound to the secret key, the serial, the counter and the limit attribute
+	proofd := prooflist[0].(*ProofD)
+	proofd.ShowTag.Tag = tag1
+	assert.False(t, prooflist.Verify(keys, context, nonce, false, nil))
+	proofd.ShowTag.Tag = tag0
+	proofd.ShowTag.Epoch = 2
+	assert.False(t, prooflist.Verify(keys, context, nonce, false, nil))
+	proofd.ShowTag.Epoch = 1
+	proofd.ShowTag.SerialAttribute = 3
+	assert.False(t, prooflist.Verify(keys, context, nonce, false, nil))
+	assert.False(t, proofd.ShowTag.Proves("voucher", 1, 2, 1))
+	proofd.ShowTag.SerialAttribute = 2
+	proofd.ShowTag.Limit = 2
+	err = prooflist.VerifyDetailed(keys, context, nonce, false, nil, nil)
+	assert.True(t, stderrors.Is(err, ErrShowTag), "expected %v, got %v", ErrShowTag, err)
+	proofd.ShowTag.Limit = 3
+	proofd.ShowTag.LimitAttribute = 3
+	err = prooflist.VerifyDetailed(keys, context, nonce, false, nil, nil)
+	assert.True(t, stderrors.Is(err, ErrShowTag), "expected %v, got %v", ErrShowTag, err)
+	proofd.ShowTag.LimitAttribute = 1
+	proofd.ShowTag.Challenges[0], proofd.ShowTag.Challenges[1] = proofd.ShowTag.Challenges[1], proofd.ShowTag.Challenges[0]
+	assert.False(t, prooflist.Verify(keys, context, nonce, false, nil))
+
+	// The counter must be smaller than the limit, which must be a disclosed attribute
+	db, err := cred.CreateDisclosureProofBuilder([]int{1, 4}, nil, false)
+	require.NoError(t, err)
+	_, err = db.LimitShowings("voucher", 1, 2, 1, 3)
+	assert.Error(t, err)
+	_, err = db.LimitShowings("voucher", 1, 2, 3, 0)
+	assert.Error(t, err)
+	_, err = db.LimitShowings("voucher", 1, 2, 4, 0)
+	assert.Error(t, err)
+	_, err = db.LimitShowings("voucher", 1, 1, 1, 0)
+	assert.Error(t, err)
+	_, err = db.LimitShowings("voucher", 1, 0, 1, 0)
+	assert.Error(t, err)
+	_, err = db.LimitShowings("", 1, 2, 1, 0)
+	assert.Error(t, err)
+	_, err = db.LimitShowings("voucher", 1, 2, 1, 2)
+	require.NoError(t, err)
+	_, err = db.LimitShowings("voucher", 1, 2, 1, 1)
+	assert.Error(t, err)
+}
+
 func TestFullBoundIssuanceAndShowingRandomIssuers(t *testing.T) {
 	keylength := 1024
 	context, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lh)
@@ -752,26 +1562,592 @@ func TestFullBoundIssuanceAndShowingRandomIssuers(t *testing.T) {
 	assert.True(t, proof.Verify(issuer2.Pk, context, nonce1s, false), "Proof of disclosure did not verify, whereas it should.")
 }
 
-func TestWronglyBoundIssuanceAndShowingWithDifferentIssuers(t *testing.T) {
-	keylength := 1024
-	context, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lh)
-	assert.NoError(t, err)
-	// Use two different secrets for the credentials, this should fail eventually
-	secret1, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lm)
-	assert.NoError(t, err)
-	secret2, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lm)
-	assert.NoError(t, err)
-	nonce2, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lstatzk)
-	assert.NoError(t, err)
-
-	// First create a single credential for an issuer
-	issuer1 := NewIssuer(testPrivK1, testPubK1, context)
-	cred1 := createCredential(t, context, secret1, issuer1)
+func TestAttributeCarryOverIssuance(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
 
-	// Then create another credential based on the same credential with a partial
-	// disclosure of the first credential.
+	cred1 := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
 	issuer2 := NewIssuer(testPrivK2, testPubK2, context)
-	cb2, err := NewCredentialBuilder(issuer2.Pk, context, secret2, nonce2, nil)
+	keys := []*gabikeys.PublicKey{testPubK1, testPubK2}
+
+	// Carry over the undisclosed attributes 2 and 3 of the first credential into the second
+	// credential, at attribute indices 1 and 3 (excluding the secret key)
+	db, err := cred1.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	cb, err := NewCredentialBuilder(issuer2.Pk, context, secret, nonce2, nil)
+	require.NoError(t, err)
+	require.NoError(t, cb.CarryOverAttribute(0, db, 2))
+	require.NoError(t, cb.CarryOverAttribute(2, db, 3))
+	prooflist, err := ProofBuilderList{db, cb}.BuildProofList(context, nonce1, false)
+	require.NoError(t, err)
+	commitMsg := cb.CreateIssueCommitmentMessage(prooflist)
+
+	// The issuer receives the proofs and checks them, including which attributes are carried over
+	bts, err := json.Marshal(commitMsg)
+	require.NoError(t, err)
+	var received IssueCommitmentMessage
+	require.NoError(t, json.Unmarshal(bts, &received))
+	require.True(t, received.Proofs.Verify(keys, context, nonce1, false, nil))
+	proofU, err := received.Proofs.GetFirstProofU()
+	require.NoError(t, err)
+	assert.Equal(t, map[int]AttributeRef{1: {Proof: 0, Attribute: 2}, 3: {Proof: 0, Attribute: 3}}, proofU.CarriedAttributes)
+
+	attrs := []*big.Int{nil, testAttributes2[1], nil, testAttributes2[3]}
+	_, err = issuer2.IssueSignature(received.U, attrs, nil, nonce2, nil)
+	assert.Error(t, err)
+	_, err = issuer2.IssueSignatureWithCarriedAttributes(proofU, attrs, nil, nonce2, nil, []int{0})
+	assert.Error(t, err)
+	_, err = issuer2.IssueSignatureWithCarriedAttributes(proofU, attrs, nil, nonce2, nil, []int{0, 1})
+	assert.Error(t, err)
+	_, err = issuer2.IssueSignatureWithCarriedAttributes(proofU, attrs, nil, nonce2, nil, []int{1, 2})
+	assert.Error(t, err)
+	msg, err := issuer2.IssueSignatureWithCarriedAttributes(proofU, attrs, nil, nonce2, nil, []int{0, 2})
+	require.NoError(t, err)
+	cred2, err := cb.ConstructCredential(msg, attrs)
+	require.NoError(t, err)
+	assert.Equal(t, cred1.Attributes[2], cred2.Attributes[1])
+	assert.Equal(t, cred1.Attributes[3], cred2.Attributes[3])
+
+	// The new credential can be shown
+	proof, err := cred2.CreateDisclosureProof([]int{1, 2, 3}, nil, false, context, nonce1)
+	require.NoError(t, err)
+	assert.True(t, proof.Verify(issuer2.Pk, context, nonce1, false))
+
+	// A carried over attribute must equal the attribute of the ProofD it refers to
+	proofU.CarriedAttributes[1] = AttributeRef{Proof: 0, Attribute: 4}
+	assert.False(t, received.Proofs.Verify(keys, context, nonce1, false, nil))
+	proofU.CarriedAttributes[1] = AttributeRef{Proof: 0, Attribute: 1}
+	assert.False(t, received.Proofs.Verify(keys, context, nonce1, false, nil))
+	delete(proofU.CarriedAttributes, 1)
+	assert.False(t, received.Proofs.Verify(keys, context, nonce1, false, nil))
+
+	// Carried over attributes require a ProofBuilderList containing the disclosure proof builder
+	cb, err = NewCredentialBuilder(issuer2.Pk, context, secret, nonce2, []int{1})
+	require.NoError(t, err)
+	require.NoError(t, cb.CarryOverAttribute(0, db, 2))
+	_, err = cb.CommitToSecretAndProve(nonce1)
+	assert.Error(t, err)
+	assert.Error(t, cb.CarryOverAttribute(0, db, 3))
+	assert.Error(t, cb.CarryOverAttribute(1, db, 3))
+	assert.Error(t, cb.CarryOverAttribute(2, db, 1))
+	assert.Error(t, cb.CarryOverAttribute(2, db, 0))
+}
+
+func TestReissuance(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	issuer := NewIssuer(testPrivK2, testPubK2, context)
+
+	b, err := NewReissuanceBuilder(cred, testPubK2, context, nonce2, false)
+	require.NoError(t, err)
+	commitMsg, err := b.CommitToSecretAndProve(nonce1)
+	require.NoError(t, err)
+	proofd := commitMsg.Proofs[0].(*ProofD)
+	assert.Empty(t, proofd.ADisclosed)
+
+	// The proofs must verify against the old key and the nonce
+	_, err = issuer.ReissueSignature(commitMsg, testPubK2, nonce1, nil)
+	assert.Error(t, err)
+	_, err = issuer.ReissueSignature(commitMsg, testPubK1, nonce2, nil)
+	assert.Error(t, err)
+
+	msg, err := issuer.ReissueSignature(commitMsg, testPubK1, nonce1, nil)
+	require.NoError(t, err)
+	newCred, err := b.ConstructCredential(msg)
+	require.NoError(t, err)
+	assert.Equal(t, cred.Attributes, newCred.Attributes)
+	assert.True(t, newCred.Signature.Verify(testPubK2, cred.Attributes))
+
+	// The new credential can be shown as usual
+	showNonce, err := common.RandomBigInt(testPubK2.Params.Lstatzk)
+	require.NoError(t, err)
+	showProof, err := newCred.CreateDisclosureProof([]int{1, 2}, nil, false, context, showNonce)
+	require.NoError(t, err)
+	assert.True(t, showProof.Verify(testPubK2, context, showNonce, false))
+
+	// Disclosing attributes or not carrying over all attributes is rejected
+	db, err := cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	cb, err := NewCredentialBuilder(testPubK2, context, secret, nonce2, nil)
+	require.NoError(t, err)
+	require.NoError(t, cb.CarryOverAttribute(1, db, 2))
+	proofs, err := ProofBuilderList{db, cb}.BuildProofList(context, nonce1, false)
+	require.NoError(t, err)
+	_, err = issuer.ReissueSignature(cb.CreateIssueCommitmentMessage(proofs), testPubK1, nonce1, nil)
+	assert.Error(t, err)
+	db, err = cred.CreateDisclosureProofBuilder(nil, nil, false)
+	require.NoError(t, err)
+	cb, err = NewCredentialBuilder(testPubK2, context, secret, nonce2, nil)
+	require.NoError(t, err)
+	require.NoError(t, cb.CarryOverAttribute(1, db, 2))
+	proofs, err = ProofBuilderList{db, cb}.BuildProofList(context, nonce1, false)
+	require.NoError(t, err)
+	_, err = issuer.ReissueSignature(cb.CreateIssueCommitmentMessage(proofs), testPubK1, nonce1, nil)
+	assert.Error(t, err)
+}
+
+func TestReissuanceWithRevocation(t *testing.T) {
+	witness, _, acc := setupRevocation(t)
+	context, err := common.RandomBigInt(testPubK.Params.Lh)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK.Params.Lm)
+	require.NoError(t, err)
+
+	attrs := append([]*big.Int{secret}, revocationAttrs(witness)...)
+	signature, err := SignMessageBlock(testPrivK, testPubK, attrs)
+	require.NoError(t, err)
+	cred := &Credential{Signature: signature, Pk: testPubK, Attributes: attrs, NonRevocationWitness: witness}
+	issuer := NewIssuer(testPrivK, testPubK, context)
+
+	newWitness, err := revocation.RandomWitness(testPrivK, acc)
+	require.NoError(t, err)
+	newWitness.SignedAccumulator = witness.SignedAccumulator
+
+	b, err := NewReissuanceBuilder(cred, testPubK, context, nonce2, true)
+	require.NoError(t, err)
+	commitMsg, err := b.CommitToSecretAndProve(nonce1)
+	require.NoError(t, err)
+	require.True(t, commitMsg.Proofs[0].(*ProofD).HasNonRevocationProof())
+	_, err = issuer.ReissueSignature(commitMsg, testPubK, nonce1, nil)
+	assert.Error(t, err)
+	msg, err := issuer.ReissueSignature(commitMsg, testPubK, nonce1, newWitness)
+	require.NoError(t, err)
+	newCred, err := b.ConstructCredential(msg)
+	require.NoError(t, err)
+
+	// All attributes are equal, except for the revocation attribute
+	revIndex := len(attrs) - 1
+	assert.Equal(t, attrs[:revIndex], newCred.Attributes[:revIndex])
+	assert.Equal(t, newWitness.E, newCred.Attributes[revIndex])
+	idx, err := newCred.NonrevIndex()
+	require.NoError(t, err)
+	assert.Equal(t, revIndex, idx)
+}
+
+func TestBatchVerification(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	cred1 := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	cred2 := createCredential(t, context, secret, NewIssuer(testPrivK2, testPubK2, context))
+
+	// Disclosure proofs against one public key, each with its own nonce
+	var proofs []*ProofD
+	var nonces []*big.Int
+	for i := 0; i < 5; i++ {
+		nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+		require.NoError(t, err)
+		builder, err := cred1.CreateDisclosureProofBuilder([]int{1, i%4 + 1}, nil, false)
+		require.NoError(t, err)
+		builder.BatchVerifiable()
+		prooflist, err := ProofBuilderList{builder}.BuildProofList(context, nonce, false)
+		require.NoError(t, err)
+		proofs = append(proofs, prooflist[0].(*ProofD))
+		nonces = append(nonces, nonce)
+	}
+	ok, failed := BatchVerifyProofD(testPubK1, proofs, context, nonces, false)
+	assert.True(t, ok)
+	assert.Empty(t, failed)
+
+	// Invalid proofs are identified
+	proofs[1].EResponse = new(big.Int).Add(proofs[1].EResponse, big.NewInt(1))
+	proofs[3].ADisclosed[1] = big.NewInt(1)
+	ok, failed = BatchVerifyProofD(testPubK1, proofs, context, nonces, false)
+	assert.False(t, ok)
+	assert.Equal(t, []int{1, 3}, failed)
+
+	// Proofs with incorrect or without ZCommit are verified as usual
+	proofs[1].EResponse.Sub(proofs[1].EResponse, big.NewInt(1))
+	proofs[1].ZCommit = new(big.Int).Add(proofs[1].ZCommit, big.NewInt(1))
+	proofs[2].ZCommit = nil
+	ok, failed = BatchVerifyProofD(testPubK1, proofs, context, nonces, false)
+	assert.False(t, ok)
+	assert.Equal(t, []int{3}, failed)
+
+	// Proof lists containing proofs against different public keys
+	var items []*BatchItem
+	for i := 0; i < 3; i++ {
+		nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+		require.NoError(t, err)
+		db1, err := cred1.CreateDisclosureProofBuilder([]int{1}, nil, false)
+		require.NoError(t, err)
+		db2, err := cred2.CreateDisclosureProofBuilder([]int{2}, nil, false)
+		require.NoError(t, err)
+		db1.BatchVerifiable()
+		db2.BatchVerifiable()
+		prooflist, err := ProofBuilderList{db1, db2}.BuildProofList(context, nonce, false)
+		require.NoError(t, err)
+		items = append(items, &BatchItem{
+			Proofs:     prooflist,
+			PublicKeys: []*gabikeys.PublicKey{testPubK1, testPubK2},
+			Context:    context,
+			Nonce:      nonce,
+		})
+	}
+	ok, failed = BatchVerify(items)
+	assert.True(t, ok)
+	assert.Empty(t, failed)
+
+	proofd := items[2].Proofs[1].(*ProofD)
+	proofd.VResponse = new(big.Int).Add(proofd.VResponse, big.NewInt(1))
+	ok, failed = BatchVerify(items)
+	assert.False(t, ok)
+	assert.Equal(t, []int{2}, failed)
+
+	// ZCommit is only included if requested
+	proof, err := cred1.CreateDisclosureProof([]int{1}, nil, false, context, nonces[0])
+	require.NoError(t, err)
+	assert.Nil(t, proof.ZCommit)
+}
+
+func TestBatchEquationSign(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	builder, err := cred.CreateDisclosureProofBuilder([]int{1}, nil, false)
+	require.NoError(t, err)
+	builder.BatchVerifiable()
+	prooflist, err := ProofBuilderList{builder}.BuildProofList(context, big.NewInt(1), false)
+	require.NoError(t, err)
+	proof := prooflist[0].(*ProofD)
+
+	verify := func(zcommit *big.Int) bool {
+		p := *proof
+		p.ZCommit = zcommit
+		batch := make(batchEquations)
+		require.NoError(t, batch.add(testPubK1, &p))
+		return batch[testPubK1].verify()
+	}
+
+	// A ZCommit off by -1 passes regardless of the parity of delta, as the proof is verified up to
+	// sign (see batchEquation), while other factors are caught
+	twice := new(big.Int).Lsh(proof.ZCommit, 1)
+	twice.Mod(twice, testPubK1.N)
+	negated := new(big.Int).Sub(testPubK1.N, proof.ZCommit)
+	for i := 0; i < 16; i++ {
+		assert.True(t, verify(proof.ZCommit))
+		assert.True(t, verify(negated))
+		assert.False(t, verify(twice))
+	}
+}
+
+func TestExpTables(t *testing.T) {
+	pk := *testPubK1
+	pk.EnableExpTables()
+
+	// Exponentiations using the tables, including exponents larger than the modulus and negative
+	// exponents, agree with ordinary exponentiations
+	for _, bits := range []uint{1, 256, 1024, 2000, 5000} {
+		exp, err := common.RandomBigInt(bits)
+		require.NoError(t, err)
+		for _, base := range []*big.Int{pk.Z, pk.S, pk.R[2]} {
+			expected := new(big.Int).Exp(base, exp, pk.N)
+			assert.Equal(t, expected, pk.ExpModN(base, exp))
+			result, err := pk.ModPow(base, exp)
+			require.NoError(t, err)
+			assert.Equal(t, expected, result)
+			result, err = pk.ModPow(base, new(big.Int).Neg(exp))
+			require.NoError(t, err)
+			assert.Equal(t, new(big.Int).ModInverse(expected, pk.N), result)
+			ret := new(big.Int)
+			require.True(t, pk.Exp(ret, "R2", exp, pk.N))
+			assert.Equal(t, new(big.Int).Exp(pk.R[2], exp, pk.N), ret)
+		}
+	}
+
+	// Issuance and disclosure using the tables
+	context, err := common.RandomBigInt(pk.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(pk.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(pk.Params.Lm)
+	require.NoError(t, err)
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, &pk, context))
+	proof, err := cred.CreateDisclosureProof([]int{1, 2}, nil, false, context, nonce)
+	require.NoError(t, err)
+	assert.True(t, proof.Verify(&pk, context, nonce, false))
+	assert.True(t, proof.Verify(testPubK1, context, nonce, false))
+}
+
+func TestParallelVerification(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	cred1 := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	cred2 := createCredential(t, context, secret, NewIssuer(testPrivK2, testPubK2, context))
+	stmt, err := rangeproof.NewStatement(rangeproof.GreaterOrEqual, new(big.Int).Sub(testAttributes1[0], big.NewInt(63)))
+	require.NoError(t, err)
+
+	var builders ProofBuilderList
+	var keys []*gabikeys.PublicKey
+	for i := 0; i < 4; i++ {
+		cred, key := cred1, testPubK1
+		if i%2 == 1 {
+			cred, key = cred2, testPubK2
+		}
+		db, err := cred.CreateDisclosureProofBuilder([]int{2}, map[int][]*rangeproof.Statement{1: {stmt}}, false)
+		require.NoError(t, err)
+		builders = append(builders, db)
+		keys = append(keys, key)
+	}
+	prooflist, err := builders.BuildProofList(context, nonce, false)
+	require.NoError(t, err)
+
+	for _, workers := range []int{0, 1, 2, 8} {
+		valid, err := prooflist.VerifyParallel(stdcontext.Background(), workers, keys, context, nonce, false, nil, nil)
+		require.NoError(t, err)
+		assert.True(t, valid)
+	}
+
+	// Same result as Verify for invalid proof lists
+	valid, err := prooflist.VerifyParallel(stdcontext.Background(), 2, keys, context, big.NewInt(1), false, nil, nil)
+	require.NoError(t, err)
+	assert.False(t, valid)
+	prooflist[3].(*ProofD).RangeProofs[1][0].Cs = nil
+	assert.False(t, prooflist.Verify(keys, context, nonce, false, nil))
+	valid, err = prooflist.VerifyParallel(stdcontext.Background(), 2, keys, context, nonce, false, nil, nil)
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	// Cancellation
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	valid, err = prooflist.VerifyParallel(ctx, 2, keys, context, nonce, false, nil, nil)
+	assert.Equal(t, stdcontext.Canceled, err)
+	assert.False(t, valid)
+}
+
+func TestContextCancellation(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	cred := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	db, err := cred.CreateDisclosureProofBuilder([]int{1, 2}, nil, false)
+	require.NoError(t, err)
+
+	prooflist, err := ProofBuilderList{db}.BuildProofListContext(stdcontext.Background(), context, nonce, false)
+	require.NoError(t, err)
+	assert.True(t, prooflist.Verify([]*gabikeys.PublicKey{testPubK1}, context, nonce, false, nil))
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	_, err = ProofBuilderList{db}.BuildProofListContext(ctx, context, nonce, false)
+	assert.Equal(t, stdcontext.Canceled, err)
+
+	ctx, cancel = stdcontext.WithTimeout(stdcontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = gabikeys.GenerateKeyPairContext(ctx, gabikeys.DefaultSystemParameters[4096], 6, 0, time.Now().AddDate(1, 0, 0))
+	assert.Equal(t, stdcontext.DeadlineExceeded, err)
+}
+
+func TestVerifyDetailed(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+	otherSecret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	cred1 := createCredential(t, context, secret, NewIssuer(testPrivK1, testPubK1, context))
+	cred2 := createCredential(t, context, secret, NewIssuer(testPrivK2, testPubK2, context))
+	stmt, err := rangeproof.NewStatement(rangeproof.GreaterOrEqual, new(big.Int).Sub(testAttributes1[0], big.NewInt(63)))
+	require.NoError(t, err)
+	keys := []*gabikeys.PublicKey{testPubK1, testPubK2}
+
+	build := func(cred1, cred2 *Credential) ProofList {
+		b1, err := cred1.CreateDisclosureProofBuilder([]int{2}, nil, false)
+		require.NoError(t, err)
+		b2, err := cred2.CreateDisclosureProofBuilder([]int{2}, map[int][]*rangeproof.Statement{1: {stmt}}, false)
+		require.NoError(t, err)
+		prooflist, err := ProofBuilderList{b1, b2}.BuildProofList(context, nonce, false)
+		require.NoError(t, err)
+		return prooflist
+	}
+	requireCheck := func(err error, check error, proof int) {
+		require.Error(t, err)
+		assert.True(t, stderrors.Is(err, check), "expected %v, got %v", check, err)
+		var verr *VerificationError
+		require.True(t, stderrors.As(err, &verr))
+		assert.Equal(t, proof, verr.Proof)
+	}
+
+	prooflist := build(cred1, cred2)
+	require.NoError(t, prooflist.VerifyDetailed(keys, context, nonce, false, nil, nil))
+	single, err := cred1.CreateDisclosureProof([]int{2}, nil, false, context, nonce)
+	require.NoError(t, err)
+	require.NoError(t, single.VerifyDetailed(testPubK1, context, nonce, false))
+	requireCheck(single.VerifyDetailed(testPubK1, context, big.NewInt(1), false), ErrChallenge, -1)
+
+	requireCheck(ProofList{}.VerifyDetailed(nil, context, nonce, false, nil, nil), ErrEmptyProofList, -1)
+	requireCheck(prooflist.VerifyDetailed(keys[:1], context, nonce, false, nil, nil), ErrPublicKeyMismatch, -1)
+	requireCheck(prooflist.VerifyDetailed(keys, context, big.NewInt(1), false, nil, nil), ErrChallenge, 0)
+	requireCheck(prooflist.VerifyDetailed(keys, context, nonce, false, nil,
+		AttributeLinks{"one": {{Proof: 0, Attribute: 1}, {Proof: 1, Attribute: 3}}}), ErrAttributeLink, -1)
+	assert.False(t, prooflist.Verify(keys, context, big.NewInt(1), false, nil))
+
+	// Different secret keys
+	cred3 := createCredential(t, context, otherSecret, NewIssuer(testPrivK2, testPubK2, context))
+	err = build(cred1, cred3).VerifyDetailed(keys, context, nonce, false, nil, nil)
+	requireCheck(err, ErrSecretKeyMismatch, 1)
+	assert.Contains(t, err.Error(), "proof 1")
+
+	// Invalid range proof
+	prooflist = build(cred1, cred2)
+	prooflist[1].(*ProofD).RangeProofs[1][0].Cs = nil
+	requireCheck(prooflist.VerifyDetailed(keys, context, nonce, false, nil, nil), ErrRangeProof, 1)
+	prooflist = build(cred1, cred2)
+	prooflist[1].(*ProofD).RangeProofs[1][0].Cs = nil
+	requireCheck(prooflist[1].(*ProofD).VerifyDetailed(testPubK2, context, nonce, false), ErrRangeProof, -1)
+
+	// Response out of range
+	prooflist = build(cred1, cred2)
+	prooflist[0].(*ProofD).EResponse.Lsh(prooflist[0].(*ProofD).EResponse, testPubK1.Params.LeCommit)
+	requireCheck(prooflist.VerifyDetailed(keys, context, nonce, false, nil, nil), ErrResponseSize, 0)
+
+	// Signatures
+	sig := *cred1.Signature
+	require.NoError(t, sig.VerifyDetailed(testPubK1, cred1.Attributes))
+	sig.V = new(big.Int).Add(sig.V, big.NewInt(1))
+	requireCheck(sig.VerifyDetailed(testPubK1, cred1.Attributes), ErrSignature, -1)
+	sig.E = new(big.Int).Add(sig.E, big.NewInt(1))
+	requireCheck(sig.VerifyDetailed(testPubK1, cred1.Attributes), ErrSignatureE, -1)
+	assert.False(t, sig.Verify(testPubK1, cred1.Attributes))
+}
+
+// seededRand returns a deterministic source of randomness.
+func seededRand(t *testing.T, seed byte) io.Reader {
+	random, err := common.NewCPRNG(&[32]byte{seed})
+	require.NoError(t, err)
+	return random
+}
+
+func TestInjectedRandomness(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK1.Params.Lh)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK1.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK1.Params.Lm)
+	require.NoError(t, err)
+
+	issue := func(seed byte) (*IssueCommitmentMessage, *IssueSignatureMessage, *Credential) {
+		b, err := NewCredentialBuilderWithRand(seededRand(t, seed), testPubK1, context, secret, nonce2, nil)
+		require.NoError(t, err)
+		commitMsg, err := b.CommitToSecretAndProve(nonce1)
+		require.NoError(t, err)
+		issuer := NewIssuer(testPrivK1, testPubK1, context)
+		issuer.Rand = seededRand(t, seed)
+		msg, err := issuer.IssueSignature(commitMsg.U, testAttributes1, nil, nonce2, nil)
+		require.NoError(t, err)
+		cred, err := b.ConstructCredential(msg, testAttributes1)
+		require.NoError(t, err)
+		return commitMsg, msg, cred
+	}
+	commitMsg, msg, cred := issue(1)
+	commitMsg2, msg2, _ := issue(1)
+	assert.Equal(t, commitMsg, commitMsg2)
+	assert.Equal(t, msg, msg2)
+	commitMsg2, msg2, _ = issue(2)
+	assert.NotEqual(t, commitMsg.U, commitMsg2.U)
+	assert.NotEqual(t, msg.Signature.E, msg2.Signature.E)
+
+	stmt, err := rangeproof.NewStatement(rangeproof.GreaterOrEqual, new(big.Int).Sub(testAttributes1[0], big.NewInt(63)))
+	require.NoError(t, err)
+	inspector, err := verenc.GenerateKey(1024)
+	require.NoError(t, err)
+	disclose := func(seed byte) ProofList {
+		db, err := cred.CreateDisclosureProofBuilderWithRand(
+			seededRand(t, seed), []int{1, 2}, map[int][]*rangeproof.Statement{3: {stmt}}, false,
+		)
+		require.NoError(t, err)
+		require.NoError(t, db.LinkAttribute(4, "link"))
+		vb, err := NewVerifiableEncryptionBuilder(db, 3, &inspector.PublicKey, []byte("label"))
+		require.NoError(t, err)
+		prooflist, err := ProofBuilderList{db, vb}.BuildProofList(context, nonce1, false)
+		require.NoError(t, err)
+		return prooflist
+	}
+	prooflist := disclose(1)
+	bts, err := json.Marshal(prooflist)
+	require.NoError(t, err)
+	same, err := json.Marshal(disclose(1))
+	require.NoError(t, err)
+	other, err := json.Marshal(disclose(2))
+	require.NoError(t, err)
+	assert.Equal(t, string(bts), string(same))
+	assert.NotEqual(t, string(bts), string(other))
+	assert.True(t, prooflist.Verify([]*gabikeys.PublicKey{testPubK1, testPubK1}, context, nonce1, false, nil))
+
+	// Use toy parameters for speed
+	base := gabikeys.BaseParameters{LePrime: 120, Lh: 256, Lm: 256, Ln: 256, Lstatzk: 80}
+	params := &gabikeys.SystemParameters{BaseParameters: base, DerivedParameters: gabikeys.MakeDerivedParameters(base)}
+	generate := func(seed byte) (*gabikeys.PrivateKey, *gabikeys.PublicKey) {
+		privk, pubk, err := gabikeys.GenerateKeyPairWithRand(
+			stdcontext.Background(), seededRand(t, seed), params, 6, 0, time.Now().AddDate(1, 0, 0),
+		)
+		require.NoError(t, err)
+		return privk, pubk
+	}
+	privk, pubk := generate(1)
+	privk2, pubk2 := generate(1)
+	assert.Equal(t, privk.N, privk2.N)
+	assert.Equal(t, []*big.Int{pubk.Z, pubk.S, pubk.G, pubk.H}, []*big.Int{pubk2.Z, pubk2.S, pubk2.G, pubk2.H})
+	assert.Equal(t, pubk.R, pubk2.R)
+	_, pubk2 = generate(2)
+	assert.NotEqual(t, pubk.N, pubk2.N)
+}
+
+func TestWronglyBoundIssuanceAndShowingWithDifferentIssuers(t *testing.T) {
+	keylength := 1024
+	context, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lh)
+	assert.NoError(t, err)
+	// Use two different secrets for the credentials, this should fail eventually
+	secret1, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lm)
+	assert.NoError(t, err)
+	secret2, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lm)
+	assert.NoError(t, err)
+	nonce2, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lstatzk)
+	assert.NoError(t, err)
+
+	// First create a single credential for an issuer
+	issuer1 := NewIssuer(testPrivK1, testPubK1, context)
+	cred1 := createCredential(t, context, secret1, issuer1)
+
+	// Then create another credential based on the same credential with a partial
+	// disclosure of the first credential.
+	issuer2 := NewIssuer(testPrivK2, testPubK2, context)
+	cb2, err := NewCredentialBuilder(issuer2.Pk, context, secret2, nonce2, nil)
 	assert.NoError(t, err)
 
 	nonce1, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[keylength].Lstatzk)
@@ -941,6 +2317,81 @@ func TestFullIssueAndShowWithRevocation(t *testing.T) {
 	require.Equal(t, cache.index, acc.Index)
 }
 
+// testCBOR checks that the value survives a CBOR round trip into decoded, by comparing their JSON
+// encodings, and that its CBOR encoding is smaller than its JSON encoding.
+func testCBOR(t *testing.T, value, decoded interface{}) {
+	bts, err := cbor.Marshal(value, cbor.EncOptions{})
+	require.NoError(t, err)
+	require.NoError(t, cbor.Unmarshal(bts, decoded))
+	expected, err := json.Marshal(value)
+	require.NoError(t, err)
+	actual, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+	assert.Less(t, len(bts), len(expected))
+}
+
+func TestCBOR(t *testing.T) {
+	witness, _, _ := setupRevocation(t)
+
+	// Issuance
+	context, err := common.RandomBigInt(testPubK.Params.Lh)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	secret, err := common.RandomBigInt(testPubK.Params.Lm)
+	require.NoError(t, err)
+	b, err := NewCredentialBuilder(testPubK, context, secret, nonce2, nil)
+	require.NoError(t, err)
+	commitMsg, err := b.CommitToSecretAndProve(nonce1)
+	require.NoError(t, err)
+	var receivedCommitMsg IssueCommitmentMessage
+	testCBOR(t, commitMsg, &receivedCommitMsg)
+	require.IsType(t, &ProofU{}, receivedCommitMsg.Proofs[0])
+	assert.True(t, receivedCommitMsg.Proofs.Verify([]*gabikeys.PublicKey{testPubK}, context, nonce1, false, nil))
+
+	issuer := NewIssuer(testPrivK, testPubK, context)
+	attrs := revocationAttrs(witness)
+	msg, err := issuer.IssueSignature(receivedCommitMsg.U, attrs, witness, nonce2, nil)
+	require.NoError(t, err)
+	var receivedMsg IssueSignatureMessage
+	testCBOR(t, msg, &receivedMsg)
+	cred, err := b.ConstructCredential(&receivedMsg, attrs)
+	require.NoError(t, err)
+	var signature CLSignature
+	testCBOR(t, cred.Signature, &signature)
+	assert.True(t, signature.Verify(testPubK, append([]*big.Int{secret}, attrs...)))
+
+	// Disclosure, including all proof types that a ProofList can contain
+	stmt, err := rangeproof.NewStatement(rangeproof.GreaterOrEqual, big.NewInt(1))
+	require.NoError(t, err)
+	db, err := cred.CreateDisclosureProofBuilder([]int{1, 2}, map[int][]*rangeproof.Statement{3: {stmt}}, true)
+	require.NoError(t, err)
+	nb, err := NewDomainPseudonymBuilder("example.com", secret)
+	require.NoError(t, err)
+	inspector, err := verenc.GenerateKey(1024)
+	require.NoError(t, err)
+	vb, err := NewVerifiableEncryptionBuilder(db, 4, &inspector.PublicKey, []byte("label"))
+	require.NoError(t, err)
+	prooflist, err := ProofBuilderList{db, nb, vb}.BuildProofList(context, nonce1, false)
+	require.NoError(t, err)
+	var received ProofList
+	testCBOR(t, prooflist, &received)
+	require.IsType(t, &ProofD{}, received[0])
+	require.IsType(t, &ProofNym{}, received[1])
+	require.IsType(t, &ProofVerEnc{}, received[2])
+	assert.True(t, received[0].(*ProofD).HasNonRevocationProof())
+	assert.True(t, received.Verify([]*gabikeys.PublicKey{testPubK, nil, testPubK}, context, nonce1, false, nil))
+
+	var proofd ProofD
+	testCBOR(t, prooflist[0], &proofd)
+	var proofs ProofS
+	testCBOR(t, receivedMsg.Proof, &proofs)
+	assert.True(t, proofs.Verify(testPubK, receivedMsg.Signature, context, nonce2))
+}
+
 func TestKeyshare(t *testing.T) {
 	secret, err := NewKeyshareSecret()
 	require.NoError(t, err)
@@ -958,6 +2409,290 @@ func TestKeyshare(t *testing.T) {
 			testPubK.N))
 }
 
+func TestMultiKeyshare(t *testing.T) {
+	const servers = 2
+	// The keyshare randomizers are sized for the system parameters of 2048 bit keys, which are
+	// too large for the range checks on the responses of ProofD with 1024 bit parameters
+	pk := *testPubK
+	pk.Params = gabikeys.DefaultSystemParameters[2048]
+	testPubK := &pk
+
+	context, err := common.RandomBigInt(testPubK.Params.Lh)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+
+	// The client and each keyshare server hold a share of the secret key
+	userSecret, err := NewMultiKeyshareSecret(servers)
+	require.NoError(t, err)
+	serverSecrets := make([]*big.Int, servers)
+	for i := range serverSecrets {
+		serverSecrets[i], err = NewMultiKeyshareSecret(servers)
+		require.NoError(t, err)
+	}
+	_, err = NewMultiKeyshareSecret(0)
+	assert.Error(t, err)
+
+	// keyshareRound lets all servers commit, merges their commitments into the builders and
+	// returns the proof list after having the servers respond to the challenge, merging the
+	// responses of the first respondents servers
+	keyshareRound := func(builders ProofBuilderList, nonce *big.Int, issig bool, respondents int) ProofList {
+		keys := make([]*gabikeys.PublicKey, len(builders))
+		for i, builder := range builders {
+			keys[i] = builder.PublicKey()
+		}
+		sessions := make([]*KeyshareSession, servers)
+		for s := range serverSecrets {
+			sessions[s], err = NewMultiKeyshareSession(servers, serverSecrets[s], keys, time.Minute)
+			require.NoError(t, err)
+			for i, builder := range builders {
+				builder.MergeProofPCommitment(sessions[s].Commitments()[i])
+			}
+		}
+		challenge, err := builders.Challenge(context, nonce, issig)
+		require.NoError(t, err)
+		proofPs := make([][]*ProofP, len(builders))
+		for s := 0; s < respondents; s++ {
+			responses, err := sessions[s].Response(challenge)
+			require.NoError(t, err)
+			for i := range builders {
+				proofPs[i] = append(proofPs[i], responses[i])
+			}
+		}
+		list, err := builders.BuildMultiDistributedProofList(challenge, proofPs)
+		require.NoError(t, err)
+		return list
+	}
+
+	// Issuance
+	cb, err := NewCredentialBuilder(testPubK, context, userSecret, nonce2, nil)
+	require.NoError(t, err)
+	issuanceProofs := keyshareRound(ProofBuilderList{cb}, nonce1, false, servers)
+	require.True(t, issuanceProofs.Verify([]*gabikeys.PublicKey{testPubK}, context, nonce1, false, []string{"ks1,ks2"}))
+	proofU, err := issuanceProofs.GetFirstProofU()
+	require.NoError(t, err)
+	issuer := NewIssuer(testPrivK, testPubK, context)
+	sigMsg, err := issuer.IssueSignature(proofU.U, testAttributes1, nil, nonce2, nil)
+	require.NoError(t, err)
+	cred, err := cb.ConstructCredential(sigMsg, testAttributes1)
+	require.NoError(t, err)
+
+	// The signature is over the sum of all shares, and verifies using the aggregate KeyshareP
+	keyshareP := new(big.Int).Exp(testPubK.R[0], new(big.Int).Add(serverSecrets[0], serverSecrets[1]), testPubK.N)
+	assert.Equal(t, keyshareP, cred.Signature.KeyshareP)
+	assert.True(t, cred.Signature.Verify(testPubK, append([]*big.Int{userSecret}, testAttributes1...)))
+	sk := new(big.Int).Add(userSecret, new(big.Int).Add(serverSecrets[0], serverSecrets[1]))
+	assert.True(t, (&CLSignature{A: cred.Signature.A, E: cred.Signature.E, V: cred.Signature.V}).
+		Verify(testPubK, append([]*big.Int{sk}, testAttributes1...)))
+
+	// Showing, bound to another credential sharing the same keyshare servers
+	cb2, err := NewCredentialBuilder(testPubK, context, userSecret, nonce2, nil)
+	require.NoError(t, err)
+	disclosure, err := cred.CreateDisclosureProofBuilder([]int{1, 2}, nil, false)
+	require.NoError(t, err)
+	proofs := keyshareRound(ProofBuilderList{disclosure, cb2}, nonce1, false, servers)
+	keys := []*gabikeys.PublicKey{testPubK, testPubK}
+	assert.True(t, proofs.Verify(keys, context, nonce1, false, []string{"ks1,ks2", "ks2,ks1"}))
+
+	// All servers must contribute their response
+	disclosure, err = cred.CreateDisclosureProofBuilder([]int{1, 2}, nil, false)
+	require.NoError(t, err)
+	proofs = keyshareRound(ProofBuilderList{disclosure}, nonce1, false, servers-1)
+	assert.False(t, proofs.Verify([]*gabikeys.PublicKey{testPubK}, context, nonce1, false, nil))
+}
+
+func TestKeyshareRefresh(t *testing.T) {
+	// See TestMultiKeyshare
+	pk := *testPubK
+	pk.Params = gabikeys.DefaultSystemParameters[2048]
+	testPubK := &pk
+	keys := []*gabikeys.PublicKey{testPubK}
+
+	context, err := common.RandomBigInt(testPubK.Params.Lh)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	// Shares of less than 2^(Lm-3), so that the refreshed share of the client is negative with
+	// probability at least 1/2
+	userSecret, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[1024].Lm - 3)
+	require.NoError(t, err)
+	serverSecret, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[1024].Lm - 3)
+	require.NoError(t, err)
+
+	// keyshareProofs builds the proofs of the builders with the specified share of the keyshare server
+	keyshareProofs := func(builders ProofBuilderList, serverSecret *big.Int) ProofList {
+		randomizer, commitments, err := NewKeyshareCommitments(serverSecret, keys)
+		require.NoError(t, err)
+		builders[0].MergeProofPCommitment(commitments[0])
+		challenge, err := builders.Challenge(context, nonce1, false)
+		require.NoError(t, err)
+		proofs, err := builders.BuildDistributedProofList(challenge,
+			[]*ProofP{KeyshareResponse(serverSecret, randomizer, challenge, testPubK)})
+		require.NoError(t, err)
+		return proofs
+	}
+
+	cb, err := NewCredentialBuilder(testPubK, context, userSecret, nonce2, nil)
+	require.NoError(t, err)
+	proofU, err := keyshareProofs(ProofBuilderList{cb}, serverSecret).GetFirstProofU()
+	require.NoError(t, err)
+	sigMsg, err := NewIssuer(testPrivK, testPubK, context).IssueSignature(proofU.U, testAttributes1, nil, nonce2, nil)
+	require.NoError(t, err)
+	cred, err := cb.ConstructCredential(sigMsg, testAttributes1)
+	require.NoError(t, err)
+
+	// Refresh the shares, until the refreshed share of the client is negative to test that case
+	var refreshedUserSecret, refreshedServerSecret *big.Int
+	for refreshedUserSecret == nil || refreshedUserSecret.Sign() >= 0 {
+		userShift, err := NewKeyshareClientShift()
+		require.NoError(t, err)
+		serverShift, err := NewKeyshareServerShift(serverSecret)
+		require.NoError(t, err)
+		refreshedUserSecret = RefreshKeyshareSecret(userSecret, userShift, serverShift)
+		refreshedServerSecret = RefreshKeyshareSecret(serverSecret, serverShift, userShift)
+	}
+	assert.Equal(t, new(big.Int).Add(userSecret, serverSecret), new(big.Int).Add(refreshedUserSecret, refreshedServerSecret))
+
+	userProof, err := NewKeyshareRefreshProof(userSecret, refreshedUserSecret, keys)
+	require.NoError(t, err)
+	serverProof, err := NewKeyshareRefreshProof(serverSecret, refreshedServerSecret, keys)
+	require.NoError(t, err)
+	require.NoError(t, userProof.Verify(keys, serverSecret, refreshedServerSecret))
+	require.NoError(t, serverProof.Verify(keys, userSecret, refreshedUserSecret))
+	testCBOR(t, serverProof, &KeyshareRefreshProof{})
+
+	// A party that shifted inconsistently is detected
+	wrongProof, err := NewKeyshareRefreshProof(serverSecret, new(big.Int).Add(refreshedServerSecret, big.NewInt(1)), keys)
+	require.NoError(t, err)
+	err = wrongProof.Verify(keys, userSecret, refreshedUserSecret)
+	assert.True(t, stderrors.Is(err, ErrInconsistentKeyshareRefresh), err)
+	forgedProof := *serverProof
+	forgedProof.Refreshed = []*ProofP{{
+		P:         serverProof.Refreshed[0].P,
+		C:         serverProof.Refreshed[0].C,
+		SResponse: new(big.Int).Add(serverProof.Refreshed[0].SResponse, big.NewInt(1)),
+	}}
+	err = forgedProof.Verify(keys, userSecret, refreshedUserSecret)
+	assert.True(t, stderrors.Is(err, ErrIncorrectKeyshareRefreshProof), err)
+
+	// The credential keeps verifying after the refresh, but not with inconsistent values
+	assert.Error(t, cred.RefreshKeyshare(refreshedUserSecret, serverProof.P[0], wrongProof.Refreshed[0].P))
+	assert.Equal(t, userSecret, cred.Attributes[0])
+	require.NoError(t, cred.RefreshKeyshare(refreshedUserSecret, serverProof.P[0], serverProof.Refreshed[0].P))
+	assert.Equal(t, serverProof.Refreshed[0].P, cred.Signature.KeyshareP)
+	assert.True(t, cred.Signature.Verify(testPubK, cred.Attributes))
+
+	disclosure, err := cred.CreateDisclosureProofBuilder([]int{1, 2}, nil, false)
+	require.NoError(t, err)
+	proofs := keyshareProofs(ProofBuilderList{disclosure}, refreshedServerSecret)
+	assert.True(t, proofs.Verify(keys, context, nonce1, false, nil))
+
+	// The leaked share of the server is useless
+	disclosure, err = cred.CreateDisclosureProofBuilder([]int{1, 2}, nil, false)
+	require.NoError(t, err)
+	proofs = keyshareProofs(ProofBuilderList{disclosure}, serverSecret)
+	assert.False(t, proofs.Verify(keys, context, nonce1, false, nil))
+}
+
+func TestKeyshareRefreshIndependence(t *testing.T) {
+	// Given the same randomness of both parties, the refreshed share of the keyshare server does not
+	// depend on its previous share, so that its distribution is the same for any previous share
+	lm := gabikeys.DefaultSystemParameters[1024].Lm
+	maximum := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), lm-1), big.NewInt(1))
+	var refreshed []*big.Int
+	for _, previous := range []*big.Int{big.NewInt(0), big.NewInt(12345), maximum} {
+		serverShift, err := NewKeyshareServerShiftWithRand(seededRand(t, 1), previous)
+		require.NoError(t, err)
+		userShift, err := NewKeyshareClientShiftWithRand(seededRand(t, 2))
+		require.NoError(t, err)
+		share := RefreshKeyshareSecret(previous, serverShift, userShift)
+		assert.True(t, share.Sign() >= 0 && uint(share.BitLen()) <= lm-1, "refreshed share out of range")
+		refreshed = append(refreshed, share)
+	}
+	assert.Equal(t, refreshed[0], refreshed[1])
+	assert.Equal(t, refreshed[0], refreshed[2])
+
+	_, err := NewKeyshareServerShift(big.NewInt(-1))
+	assert.Error(t, err)
+}
+
+func TestKeyshareSession(t *testing.T) {
+	context, err := common.RandomBigInt(testPubK.Params.Lh)
+	require.NoError(t, err)
+	nonce1, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	nonce2, err := common.RandomBigInt(testPubK.Params.Lstatzk)
+	require.NoError(t, err)
+	userSecret, err := NewKeyshareSecret()
+	require.NoError(t, err)
+	serverSecret, err := NewKeyshareSecret()
+	require.NoError(t, err)
+	keys := []*gabikeys.PublicKey{testPubK}
+
+	session, err := NewKeyshareSession(serverSecret, keys, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, session.Expired())
+	commitments := session.Commitments()
+	require.Len(t, commitments, 1)
+
+	cb, err := NewCredentialBuilder(testPubK, context, userSecret, nonce2, nil)
+	require.NoError(t, err)
+	builders := ProofBuilderList{cb}
+	cb.MergeProofPCommitment(commitments[0])
+	challenge, err := builders.Challenge(context, nonce1, false)
+	require.NoError(t, err)
+
+	responses, err := session.Response(challenge)
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	proofP := responses[0]
+	assert.True(t, proofP.Verify(testPubK, challenge))
+	assert.Equal(t, commitments[0].P, proofP.P)
+	assert.Equal(t, commitments[0].Pcommit, proofP.Pcommit)
+	assert.False(t, proofP.Verify(testPubK, new(big.Int).Add(challenge, big.NewInt(1))))
+	tampered := *proofP
+	tampered.SResponse = new(big.Int).Add(proofP.SResponse, big.NewInt(1))
+	assert.False(t, tampered.Verify(testPubK, challenge))
+	assert.False(t, KeyshareResponse(serverSecret, big.NewInt(1), challenge, testPubK).Verify(testPubK, challenge))
+
+	// The commitment can only be used for one challenge
+	again, err := session.Response(challenge)
+	require.NoError(t, err)
+	assert.Equal(t, responses, again)
+	_, err = session.Response(new(big.Int).Add(challenge, big.NewInt(1)))
+	assert.True(t, stderrors.Is(err, ErrKeyshareCommitmentReused), err)
+
+	// The contribution of the keyshare server, once checked, is merged into the proofs
+	proofs, err := builders.BuildDistributedProofList(challenge, responses)
+	require.NoError(t, err)
+	assert.True(t, proofs.Verify(keys, context, nonce1, false, nil))
+	sigMsg, err := NewIssuer(testPrivK, testPubK, context).IssueSignature(proofs[0].(*ProofU).U, testAttributes1, nil, nonce2, nil)
+	require.NoError(t, err)
+	cred, err := cb.ConstructCredential(sigMsg, testAttributes1)
+	require.NoError(t, err)
+	assert.True(t, cred.Signature.Verify(testPubK, cred.Attributes))
+
+	// Sessions of one of multiple keyshare servers use smaller randomizers, so that their sum fits
+	// in the size of a single randomizer
+	multiSession, err := NewMultiKeyshareSession(2, serverSecret, keys, time.Minute)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, multiSession.randomizer.BitLen(), int(gabikeys.DefaultSystemParameters[1024].Lm+
+		gabikeys.DefaultSystemParameters[1024].Lh+gabikeys.DefaultSystemParameters[2048].Lstatzk-1))
+	_, err = NewMultiKeyshareSession(0, serverSecret, keys, time.Minute)
+	assert.Error(t, err)
+
+	// Expired sessions do not respond
+	session, err = NewKeyshareSession(serverSecret, keys, 0)
+	require.NoError(t, err)
+	assert.True(t, session.Expired())
+	_, err = session.Response(challenge)
+	assert.True(t, stderrors.Is(err, ErrKeyshareSessionExpired), err)
+}
+
 // TODO: tests to add:
 // - Reading/writing key files
 // - Tests with expiration dates?
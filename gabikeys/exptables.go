@@ -0,0 +1,124 @@
+package gabikeys
+
+import (
+	"sync"
+
+	"github.com/bwesterb/go-exptable"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/internal/common"
+)
+
+// expTableWindow is the window width of the fixed-base exponentiation tables. Each table takes
+// about Ln/w * (2^w-1) * Ln bits of memory, i.e. 2 MB for w = 4 and a 2048 bits modulus.
+const expTableWindow = 4
+
+type (
+	// expTables holds fixed-base exponentiation tables for the bases of a public key. The map is
+	// populated once by EnableExpTables() and only read afterwards, so it needs no locking; the
+	// tables themselves are built lazily under the lock of each fixedBaseTable.
+	expTables struct {
+		tables map[*big.Int]*fixedBaseTable
+	}
+
+	// fixedBaseTable speeds up exponentiations of a fixed base. A single exptable.Table only
+	// supports exponents up to the size of the modulus, so larger exponents are split in chunks
+	// of chunkSize bits, the j-th of which is exponentiated using a table for base^(2^(j*chunkSize)).
+	fixedBaseTable struct {
+		sync.Mutex
+		base      *big.Int
+		modulus   *big.Int
+		chunkSize uint
+		chunks    []*exptable.Table
+	}
+)
+
+// EnableExpTables enables the use of precomputed tables to speed up exponentiations of the bases
+// Z, S, G, H and R_i of the public key modulo N, in PublicKey.Exp() and PublicKey.ModPow(). The
+// tables are built lazily, when a base is first exponentiated. As building the table of a base
+// costs a few hundred exponentiations and takes a few megabytes of memory per base, this only pays
+// off for long-running processes that reuse the public key, such as verifiers and issuers. The
+// bases of the public key must not be modified afterwards.
+func (pubk *PublicKey) EnableExpTables() {
+	if pubk.expTables != nil {
+		return
+	}
+	t := &expTables{tables: make(map[*big.Int]*fixedBaseTable)}
+	chunkSize := uint((pubk.N.BitLen()-1)/expTableWindow+1) * expTableWindow
+	for _, base := range append([]*big.Int{pubk.Z, pubk.S, pubk.G, pubk.H}, pubk.R...) {
+		if base != nil {
+			t.tables[base] = &fixedBaseTable{base: base, modulus: pubk.N, chunkSize: chunkSize}
+		}
+	}
+	pubk.expTables = t
+}
+
+// table returns the fixed-base table of the specified base if tables are enabled and it is one of
+// the bases of the public key.
+func (pubk *PublicKey) table(base *big.Int) *fixedBaseTable {
+	if pubk.expTables == nil {
+		return nil
+	}
+	return pubk.expTables.tables[base]
+}
+
+// ModPow computes base^exp mod N. The exponent can be negative, in which case the modular inverse
+// is used (see common.ModPow()). If the base is one of the bases of the public key and
+// EnableExpTables() has been called, a precomputed table is used.
+func (pubk *PublicKey) ModPow(base, exp *big.Int) (*big.Int, error) {
+	t := pubk.table(base)
+	if t == nil {
+		return common.ModPow(base, exp, pubk.N)
+	}
+	if exp.Sign() >= 0 {
+		return t.exp(new(big.Int), exp), nil
+	}
+	result := t.exp(new(big.Int), new(big.Int).Neg(exp))
+	if result.ModInverse(result, pubk.N) == nil {
+		return nil, common.ErrNoModInverse
+	}
+	return result, nil
+}
+
+// ExpModN computes base^exp mod N like big.Int.Exp(). If the base is one of the bases of the
+// public key, the exponent is nonnegative, and EnableExpTables() has been called, a precomputed
+// table is used.
+func (pubk *PublicKey) ExpModN(base, exp *big.Int) *big.Int {
+	if t := pubk.table(base); t != nil && exp.Sign() >= 0 {
+		return t.exp(new(big.Int), exp)
+	}
+	return new(big.Int).Exp(base, exp, pubk.N)
+}
+
+// exp sets ret to base^exp mod modulus for nonnegative exp, and returns ret.
+func (t *fixedBaseTable) exp(ret, exp *big.Int) *big.Int {
+	count := (exp.BitLen() + int(t.chunkSize) - 1) / int(t.chunkSize)
+	chunks := t.chunkTables(count)
+
+	ret.SetInt64(1)
+	mask := new(big.Int).Lsh(big.NewInt(1), t.chunkSize)
+	mask.Sub(mask, big.NewInt(1))
+	rest, chunk, tmp := new(big.Int).Set(exp), new(big.Int), new(big.Int)
+	for j := 0; j < count; j++ {
+		chunk.And(rest, mask)
+		rest.Rsh(rest, t.chunkSize)
+		chunks[j].Exp(tmp.Go(), chunk.Go())
+		ret.Mul(ret, tmp).Mod(ret, t.modulus)
+	}
+	return ret
+}
+
+// chunkTables returns at least the specified amount of chunk tables, computing them if necessary.
+func (t *fixedBaseTable) chunkTables(count int) []*exptable.Table {
+	t.Lock()
+	defer t.Unlock()
+	for len(t.chunks) < count {
+		base := t.base
+		if j := len(t.chunks); j > 0 {
+			base = new(big.Int).Exp(t.base, new(big.Int).Lsh(big.NewInt(1), uint(j)*t.chunkSize), t.modulus)
+		}
+		table := &exptable.Table{}
+		table.Compute(base.Go(), t.modulus.Go(), expTableWindow)
+		t.chunks = append(t.chunks, table)
+	}
+	return t.chunks
+}
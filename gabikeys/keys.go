@@ -1,6 +1,7 @@
 package gabikeys
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/base64"
 	"encoding/xml"
@@ -37,6 +38,8 @@ type (
 		ECDSA  *ecdsa.PublicKey  `xml:"-"`
 		Params *SystemParameters `xml:"-"`
 		Issuer string            `xml:"-"`
+
+		expTables *expTables // see EnableExpTables()
 	}
 
 	// PrivateKey represents an issuer's private key.
@@ -208,6 +211,13 @@ func (privk *PrivateKey) RevocationSupported() bool {
 }
 
 func GenerateRevocationKeypair(privk *PrivateKey, pubk *PublicKey) error {
+	return GenerateRevocationKeypairWithRand(nil, privk, pubk)
+}
+
+// GenerateRevocationKeypairWithRand is like GenerateRevocationKeypair, generating the bases G and H
+// using the specified source of randomness (if nil, the default is used). The ECDSA key is always
+// generated using crypto/rand.
+func GenerateRevocationKeypairWithRand(random io.Reader, privk *PrivateKey, pubk *PublicKey) error {
 	if pubk.RevocationSupported() || privk.RevocationSupported() {
 		return errors.New("revocation parameters already present")
 	}
@@ -229,8 +239,8 @@ func GenerateRevocationKeypair(privk *PrivateKey, pubk *PublicKey) error {
 	privk.ECDSA = key
 	pubk.ECDSAString = base64.StdEncoding.EncodeToString(pubdsabts)
 	pubk.ECDSA = &key.PublicKey
-	pubk.G = common.RandomQR(pubk.N)
-	pubk.H = common.RandomQR(pubk.N)
+	pubk.G = common.RandomQRFrom(random, pubk.N)
+	pubk.H = common.RandomQRFrom(random, pubk.N)
 
 	return nil
 }
@@ -383,49 +393,84 @@ func findMatch(safeprimes []*big.Int, param *SystemParameters, p *big.Int,
 	return nil
 }
 
-func generateSafePrimePair(param *SystemParameters) (*big.Int, *big.Int, error) {
+func generateSafePrimePair(ctx context.Context, random io.Reader, param *SystemParameters) (*big.Int, *big.Int, error) {
 	primeSize := param.Ln / 2
 
 	// Declare and allocate all vars outside the loop and outside the helper function above
-	stop := make(chan struct{})
 	safeprimes := make([]*big.Int, 0, 10) // store all generated safeprimes until we find a suitable pair
 	pPrime, pPrimeMod8, pMod8, qMod8, n := new(big.Int), new(big.Int), new(big.Int), new(big.Int), new(big.Int)
-	var p, q *big.Int
-	var err error
+
+	// match returns a safe prime forming a suitable pair with the candidate safe prime p, if any
+	// of the earlier candidates does.
+	match := func(p *big.Int) *big.Int {
+		pPrimeMod8.Mod(pPrime.Rsh(p, 1), big.NewInt(8))
+		// p is our candidate safeprime, set p' = (p-1)/2. Check that p' mod 8 != 1
+		if pPrimeMod8.Cmp(big.NewInt(1)) == 0 {
+			return nil
+		}
+		// If we have earlier found other candidates, see if any pair of them fits all requirements
+		q := findMatch(safeprimes, param, p, n, pMod8, qMod8)
+		if q == nil {
+			safeprimes = append(safeprimes, p) // include p as it might match with future safe primes
+		}
+		return q
+	}
+
+	// With a custom source of randomness, generate safe primes one after another so that they
+	// only depend on the output of the source.
+	if random != nil {
+		for {
+			p, err := safeprime.GenerateWithRand(ctx, random, int(primeSize))
+			if err != nil {
+				return nil, nil, err
+			}
+			if q := match(p); q != nil {
+				return p, q, nil
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stop safeprime.GenerateConcurrentContext() when we return
 
 	// Start generating safeprimes
-	ints, errs := safeprime.GenerateConcurrent(int(primeSize), stop)
+	ints, errs := safeprime.GenerateConcurrentContext(ctx, int(primeSize))
 
 	// Receive safeprime results in a loop, until we have a suitable pair of safeprimes.
-loop: // we need this label to continue the for loop from within the select below
 	for {
 		select { // wait for and then handle an incoming bigint or error, whichever comes first
 
-		case p = <-ints:
-			pPrimeMod8.Mod(pPrime.Rsh(p, 1), big.NewInt(8))
-			// p is our candidate safeprime, set p' = (p-1)/2. Check that p' mod 8 != 1
-			if pPrimeMod8.Cmp(big.NewInt(1)) == 0 {
-				continue loop
-			}
-			// If we have earlier found other candidates, see if any pair of them fits all requirements
-			if q = findMatch(safeprimes, param, p, n, pMod8, qMod8); len(safeprimes) == 0 || q == nil {
-				safeprimes = append(safeprimes, p) // include p as it might match with future safe primes
-				continue loop
+		case p := <-ints:
+			if q := match(p); q != nil {
+				return p, q, nil
 			}
-			close(stop) // We have enough, stop safeprime.GenerateConcurrent()
-			return p, q, nil
 
-		case err = <-errs:
-			close(stop) // Something went wrong during safeprime generation, abort
-			return nil, nil, err
+		case err := <-errs:
+			return nil, nil, err // Something went wrong during safeprime generation, abort
 
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
 		}
 	}
 }
 
 // GenerateKeyPair generates a private/public keypair for an Issuer
 func GenerateKeyPair(param *SystemParameters, numAttributes int, counter uint, expiryDate time.Time) (*PrivateKey, *PublicKey, error) {
-	p, q, err := generateSafePrimePair(param)
+	return GenerateKeyPairContext(context.Background(), param, numAttributes, counter, expiryDate)
+}
+
+// GenerateKeyPairContext generates a private/public keypair for an Issuer like GenerateKeyPair(),
+// returning ctx.Err() if ctx is done before the safe primes of the keypair have been found.
+func GenerateKeyPairContext(ctx context.Context, param *SystemParameters, numAttributes int, counter uint, expiryDate time.Time) (*PrivateKey, *PublicKey, error) {
+	return GenerateKeyPairWithRand(ctx, nil, param, numAttributes, counter, expiryDate)
+}
+
+// GenerateKeyPairWithRand generates a private/public keypair for an Issuer like
+// GenerateKeyPairContext(), using the specified source of randomness (if nil, crypto/rand is used).
+// With a custom source the safe primes are generated sequentially instead of concurrently, so that
+// the keypair (except for its ECDSA revocation key) only depends on the output of the source.
+func GenerateKeyPairWithRand(ctx context.Context, random io.Reader, param *SystemParameters, numAttributes int, counter uint, expiryDate time.Time) (*PrivateKey, *PublicKey, error) {
+	p, q, err := generateSafePrimePair(ctx, random, param)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -458,7 +503,7 @@ func GenerateKeyPair(param *SystemParameters, numAttributes int, counter uint, e
 
 	var s *big.Int
 	for {
-		s, err = common.RandomBigInt(param.Ln)
+		s, err = common.RandomBigIntFrom(random, param.Ln)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -477,7 +522,7 @@ func GenerateKeyPair(param *SystemParameters, numAttributes int, counter uint, e
 	primeSize := param.Ln / 2
 	var x *big.Int
 	for {
-		x, err = common.RandomBigInt(primeSize)
+		x, err = common.RandomBigIntFrom(random, primeSize)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -496,7 +541,7 @@ func GenerateKeyPair(param *SystemParameters, numAttributes int, counter uint, e
 
 		var x *big.Int
 		for {
-			x, err = common.RandomBigInt(primeSize)
+			x, err = common.RandomBigIntFrom(random, primeSize)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -508,7 +553,7 @@ func GenerateKeyPair(param *SystemParameters, numAttributes int, counter uint, e
 		pubk.R[i].Exp(pubk.S, x, pubk.N)
 	}
 
-	if err = GenerateRevocationKeypair(priv, pubk); err != nil {
+	if err = GenerateRevocationKeypairWithRand(random, priv, pubk); err != nil {
 		return nil, nil, err
 	}
 
@@ -541,6 +586,10 @@ func (pubk *PublicKey) Exp(ret *big.Int, name string, exp, n *big.Int) bool {
 	if base == nil {
 		return false
 	}
+	if t := pubk.table(base); t != nil && exp.Sign() >= 0 && n.Cmp(pubk.N) == 0 {
+		t.exp(ret, exp)
+		return true
+	}
 	ret.Exp(base, exp, n)
 	return true
 }
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"sync/atomic"
 
 	"github.com/privacybydesign/gabi/big"
@@ -84,7 +85,16 @@ func (c *CPRNG) Read(buf []byte) (n int, err error) {
 // Derives a random number uniformly chosen below the given limit
 // from a random 256 bit seed generated when the application starts.
 func FastRandomBigInt(limit *big.Int) *big.Int {
-	res, err := big.RandInt(globalCprng, limit)
+	return FastRandomBigIntFrom(nil, limit)
+}
+
+// FastRandomBigIntFrom returns a random number uniformly chosen below the given limit, read from
+// the specified source of randomness, or like FastRandomBigInt() if it is nil.
+func FastRandomBigIntFrom(random io.Reader, limit *big.Int) *big.Int {
+	if random == nil {
+		random = globalCprng
+	}
+	res, err := big.RandInt(random, limit)
 	if err != nil {
 		panic(fmt.Sprintf("big.RandInt failed: %v", err))
 	}
@@ -92,10 +102,16 @@ func FastRandomBigInt(limit *big.Int) *big.Int {
 }
 
 func RandomQR(n *big.Int) *big.Int {
+	return RandomQRFrom(nil, n)
+}
+
+// RandomQRFrom returns a random quadratic residue modulo n, using the specified source of
+// randomness (see FastRandomBigIntFrom()).
+func RandomQRFrom(random io.Reader, n *big.Int) *big.Int {
 	var r *big.Int
 	var tmp big.Int
 	for {
-		r = FastRandomBigInt(n)
+		r = FastRandomBigIntFrom(random, n)
 		// if GCD(r, n) == 1 then r is in (Z/nZ)*; return its square
 		if tmp.GCD(nil, nil, r, n).Cmp(big.NewInt(1)) == 0 {
 			return r.Mul(r, r).Mod(r, n)
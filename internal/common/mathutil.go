@@ -6,6 +6,7 @@ package common
 
 import (
 	"crypto/rand"
+	"io"
 	mathRand "math/rand"
 
 	"github.com/go-errors/errors"
@@ -92,8 +93,22 @@ func RepresentToBases(bases, exps []*big.Int, modulus *big.Int, maxMessageLength
 // RandomBigInt returns a random big integer value in the range
 // [0,(2^numBits)-1], inclusive.
 func RandomBigInt(numBits uint) (*big.Int, error) {
+	return RandomBigIntFrom(nil, numBits)
+}
+
+// RandomBigIntFrom returns a random big integer value in the range [0,(2^numBits)-1], inclusive,
+// read from the specified source of randomness (see RandReader()).
+func RandomBigIntFrom(random io.Reader, numBits uint) (*big.Int, error) {
 	t := new(big.Int).Lsh(bigONE, numBits)
-	return big.RandInt(rand.Reader, t)
+	return big.RandInt(RandReader(random), t)
+}
+
+// RandReader returns the specified source of randomness, or crypto/rand.Reader if it is nil.
+func RandReader(random io.Reader) io.Reader {
+	if random == nil {
+		return rand.Reader
+	}
+	return random
 }
 
 // legendreSymbol calculates the Legendre symbol (a/p).
@@ -5,7 +5,7 @@
 package gabi
 
 import (
-	"crypto/rand"
+	"io"
 
 	"github.com/go-errors/errors"
 
@@ -20,6 +20,9 @@ type Issuer struct {
 	Sk      *gabikeys.PrivateKey
 	Pk      *gabikeys.PublicKey
 	Context *big.Int
+
+	// Rand is the source of randomness used for issuing signatures. If nil, crypto/rand is used.
+	Rand io.Reader
 }
 
 // NewIssuer creates a new credential issuer.
@@ -32,7 +35,34 @@ func NewIssuer(sk *gabikeys.PrivateKey, pk *gabikeys.PublicKey, context *big.Int
 // the proofs containted in the IssueCommitmentMessage! That needs to be done at
 // a higher level!
 func (i *Issuer) IssueSignature(U *big.Int, attributes []*big.Int, witness *revocation.Witness, nonce2 *big.Int, blind []int) (*IssueSignatureMessage, error) {
-	signature, mIssuer, err := i.signCommitmentAndAttributes(U, attributes, blind)
+	return i.issueSignature(U, attributes, witness, nonce2, blind, nil)
+}
+
+// IssueSignatureWithCarriedAttributes produces an IssueSignatureMessage like IssueSignature(), in
+// which the attributes at the indices in carried are carried over from a credential of the user,
+// who has included them in U (see CredentialBuilder.CarryOverAttribute()). These attributes must be
+// nil, and the indices must be exactly those of ProofU.CarriedAttributes. As with IssueSignature(),
+// the proofs are not checked; the issuer should also check that ProofU.CarriedAttributes refers to
+// the intended attributes.
+func (i *Issuer) IssueSignatureWithCarriedAttributes(
+	proofu *ProofU, attributes []*big.Int, witness *revocation.Witness, nonce2 *big.Int, blind, carried []int,
+) (*IssueSignatureMessage, error) {
+	if len(carried) != len(proofu.CarriedAttributes) {
+		return nil, errors.New("carried over attributes do not match ProofU")
+	}
+	for _, j := range carried {
+		// ProofU.CarriedAttributes includes the secret key in its indices
+		if _, ok := proofu.CarriedAttributes[j+1]; !ok {
+			return nil, errors.Errorf("attribute %d not carried over in ProofU", j)
+		}
+	}
+	return i.issueSignature(proofu.U, attributes, witness, nonce2, blind, carried)
+}
+
+func (i *Issuer) issueSignature(
+	U *big.Int, attributes []*big.Int, witness *revocation.Witness, nonce2 *big.Int, blind, carried []int,
+) (*IssueSignatureMessage, error) {
+	signature, mIssuer, err := i.signCommitmentAndAttributes(U, attributes, blind, carried)
 	if err != nil {
 		return nil, err
 	}
@@ -45,18 +75,42 @@ func (i *Issuer) IssueSignature(U *big.Int, attributes []*big.Int, witness *revo
 
 // signCommitmentAndAttributes produces a (partial) signature on the commitment
 // and the attributes (some of which might be unknown to the issuer).
-// Arg "blind" is a list of indices representing the random blind attributes.
+// Arg "blind" is a list of indices representing the random blind attributes,
+// and "carried" of the attributes carried over in U.
 // The signature does not verify (yet) due to blinding factors present.
-func (i *Issuer) signCommitmentAndAttributes(U *big.Int, attributes []*big.Int, blind []int) (*CLSignature, map[int]*big.Int, error) {
+func (i *Issuer) signCommitmentAndAttributes(U *big.Int, attributes []*big.Int, blind, carried []int) (*CLSignature, map[int]*big.Int, error) {
+	ms, mIssuer, err := issuerMessageBlock(i.Rand, i.Pk, attributes, blind, carried)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cl, err := signMessageBlockAndCommitment(i.Rand, i.Sk, i.Pk, U, ms)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cl, mIssuer, nil
+}
+
+// issuerMessageBlock returns the message block signed by the issuer for the attributes, in which
+// the secret key, the carried over attributes (which are contained in U) and the random blind
+// attributes are replaced by 0 and the issuer's shares of the latter, respectively. The issuer's
+// shares of the random blind attributes are returned as well. All other attributes must be set.
+func issuerMessageBlock(
+	random io.Reader, pk *gabikeys.PublicKey, attributes []*big.Int, blind, carried []int,
+) ([]*big.Int, map[int]*big.Int, error) {
 	mIssuer := make(map[int]*big.Int)
 	ms := append([]*big.Int{big.NewInt(0)}, attributes...)
 
 	for _, j := range blind {
+		if j < 0 || j >= len(attributes) {
+			return nil, nil, errors.New("random blind index out of range")
+		}
 		if attributes[j] != nil {
 			return nil, nil, errors.New("attribute at random blind index should be nil before issuance")
 		}
 		// Replace attribute value with issuer's share
-		r, err := common.RandomBigInt(i.Pk.Params.Lm - 1)
+		r, err := common.RandomBigIntFrom(random, pk.Params.Lm-1)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -64,24 +118,35 @@ func (i *Issuer) signCommitmentAndAttributes(U *big.Int, attributes []*big.Int,
 		ms[j+1] = r
 	}
 
-	cl, err := signMessageBlockAndCommitment(i.Sk, i.Pk, U, ms)
-	if err != nil {
-		return nil, nil, err
+	// Carried over attributes are contained in U
+	for _, j := range carried {
+		if j < 0 || j >= len(attributes) {
+			return nil, nil, errors.New("carried over attribute index out of range")
+		}
+		if ms[j+1] != nil {
+			return nil, nil, errors.New("carried over attribute should be nil before issuance")
+		}
+		ms[j+1] = big.NewInt(0)
 	}
 
-	return cl, mIssuer, nil
+	for j, m := range ms {
+		if m == nil {
+			return nil, nil, errors.Errorf("attribute %d is nil but neither random blind nor carried over", j-1)
+		}
+	}
+	return ms, mIssuer, nil
 }
 
 // randomElementMultiplicativeGroup returns a random element in the
-// multiplicative group Z_{modulus}^*.
-func randomElementMultiplicativeGroup(modulus *big.Int) (*big.Int, error) {
+// multiplicative group Z_{modulus}^*, read from the specified source of randomness.
+func randomElementMultiplicativeGroup(random io.Reader, modulus *big.Int) (*big.Int, error) {
 	r := big.NewInt(0)
 	t := new(big.Int)
 	var err error
 	for r.Sign() <= 0 || t.GCD(nil, nil, r, modulus).Cmp(big.NewInt(1)) != 0 {
 		// TODO: for memory/cpu efficiency re-use r's memory. See Go's
 		// implementation for finding a random prime.
-		r, err = big.RandInt(rand.Reader, modulus)
+		r, err = big.RandInt(common.RandReader(random), modulus)
 		if err != nil {
 			return nil, err
 		}
@@ -98,7 +163,7 @@ func (i *Issuer) proveSignature(signature *CLSignature, nonce2 *big.Int) (*Proof
 		return nil, common.ErrNoModInverse
 	}
 
-	eCommit, err := randomElementMultiplicativeGroup(groupModulus)
+	eCommit, err := randomElementMultiplicativeGroup(i.Rand, groupModulus)
 	if err != nil {
 		return nil, err
 	}
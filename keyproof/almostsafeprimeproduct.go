@@ -1,6 +1,9 @@
 package keyproof
 
 import (
+	"context"
+	"io"
+
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/internal/common"
 )
@@ -19,7 +22,7 @@ type (
 	}
 )
 
-func almostSafePrimeProductBuildCommitments(list []*big.Int, Pprime *big.Int, Qprime *big.Int) ([]*big.Int, almostSafePrimeProductCommit) {
+func almostSafePrimeProductBuildCommitments(ctx context.Context, random io.Reader, list []*big.Int, Pprime *big.Int, Qprime *big.Int) ([]*big.Int, almostSafePrimeProductCommit, error) {
 	// Setup proof structure
 	var commit almostSafePrimeProductCommit
 
@@ -29,9 +32,12 @@ func almostSafePrimeProductBuildCommitments(list []*big.Int, Pprime *big.Int, Qp
 
 	// Generate nonce
 	nonceMax := new(big.Int).Lsh(big.NewInt(1), almostSafePrimeProductNonceSize)
-	commit.nonce = common.FastRandomBigInt(nonceMax)
+	commit.nonce = common.FastRandomBigIntFrom(random, nonceMax)
 
 	for i := 0; i < almostSafePrimeProductIters; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, almostSafePrimeProductCommit{}, err
+		}
 		// Calculate base from nonce
 		curc := common.GetHashNumber(commit.nonce, nil, i, uint(N.BitLen()))
 		curc.Mod(curc, N)
@@ -40,17 +46,17 @@ func almostSafePrimeProductBuildCommitments(list []*big.Int, Pprime *big.Int, Qp
 			panic("Generated number not in Z_N")
 		}
 
-		log := common.FastRandomBigInt(phiN)
+		log := common.FastRandomBigIntFrom(random, phiN)
 		com := new(big.Int).Exp(curc, log, N)
 		list = append(list, com)
 		commit.commitments = append(commit.commitments, com)
 		commit.logs = append(commit.logs, log)
 	}
 
-	return list, commit
+	return list, commit, nil
 }
 
-func almostSafePrimeProductBuildProof(Pprime *big.Int, Qprime *big.Int, challenge *big.Int, index *big.Int, commit almostSafePrimeProductCommit) AlmostSafePrimeProductProof {
+func almostSafePrimeProductBuildProof(ctx context.Context, Pprime *big.Int, Qprime *big.Int, challenge *big.Int, index *big.Int, commit almostSafePrimeProductCommit) (AlmostSafePrimeProductProof, error) {
 	// Setup proof structure
 	proof := AlmostSafePrimeProductProof{
 		Nonce:       commit.nonce,
@@ -68,6 +74,9 @@ func almostSafePrimeProductBuildProof(Pprime *big.Int, Qprime *big.Int, challeng
 
 	// Calculate responses
 	for i := 0; i < almostSafePrimeProductIters; i++ {
+		if err := ctx.Err(); err != nil {
+			return AlmostSafePrimeProductProof{}, err
+		}
 		// Derive challenge
 		curc := common.GetHashNumber(challenge, index, i, uint(2*N.BitLen()))
 
@@ -98,7 +107,7 @@ func almostSafePrimeProductBuildProof(Pprime *big.Int, Qprime *big.Int, challeng
 		}
 	}
 
-	return proof
+	return proof, nil
 }
 
 func almostSafePrimeProductVerifyStructure(proof AlmostSafePrimeProductProof) bool {
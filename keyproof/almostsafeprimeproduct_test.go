@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"testing"
 
 	"github.com/privacybydesign/gabi/big"
@@ -9,8 +10,10 @@ import (
 )
 
 func TestAlmostSafePrimeProductCycle(t *testing.T) {
-	listBefore, commit := almostSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
-	proof := almostSafePrimeProductBuildProof(testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	listBefore, commit, err := almostSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
+	proof, err := almostSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	require.NoError(t, err)
 	require.True(t, almostSafePrimeProductVerifyStructure(proof), "Proof structure rejected")
 
 	listAfter := almostSafePrimeProductExtractCommitments([]*big.Int{}, proof)
@@ -21,8 +24,10 @@ func TestAlmostSafePrimeProductCycle(t *testing.T) {
 }
 
 func TestAlmostSafePrimeProductCycleIncorrectNonce(t *testing.T) {
-	_, commit := almostSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
-	proof := almostSafePrimeProductBuildProof(testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	_, commit, err := almostSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
+	proof, err := almostSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	require.NoError(t, err)
 	proof.Nonce.Sub(proof.Nonce, big.NewInt(1))
 	assert.False(t,
 		almostSafePrimeProductVerifyProof(testN, big.NewInt(12345), big.NewInt(3), proof),
@@ -30,8 +35,10 @@ func TestAlmostSafePrimeProductCycleIncorrectNonce(t *testing.T) {
 }
 
 func TestAlmostSafePrimeProductCycleIncorrectCommitment(t *testing.T) {
-	_, commit := almostSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
-	proof := almostSafePrimeProductBuildProof(testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	_, commit, err := almostSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
+	proof, err := almostSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	require.NoError(t, err)
 	proof.Commitments[0].Add(proof.Commitments[0], big.NewInt(1))
 	assert.False(t,
 		almostSafePrimeProductVerifyProof(testN, big.NewInt(12345), big.NewInt(3), proof),
@@ -39,8 +46,10 @@ func TestAlmostSafePrimeProductCycleIncorrectCommitment(t *testing.T) {
 }
 
 func TestAlmostSafePrimeProductCycleIncorrectResponse(t *testing.T) {
-	_, commit := almostSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
-	proof := almostSafePrimeProductBuildProof(testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	_, commit, err := almostSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
+	proof, err := almostSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	require.NoError(t, err)
 	proof.Responses[0].Add(proof.Responses[0], big.NewInt(1))
 	assert.False(t,
 		almostSafePrimeProductVerifyProof(testN, big.NewInt(12345), big.NewInt(3), proof),
@@ -48,8 +57,10 @@ func TestAlmostSafePrimeProductCycleIncorrectResponse(t *testing.T) {
 }
 
 func TestAlmostSafePrimeProductVerifyStructure(t *testing.T) {
-	_, commit := almostSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
-	proof := almostSafePrimeProductBuildProof(testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	_, commit, err := almostSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
+	proof, err := almostSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, big.NewInt(12345), big.NewInt(3), commit)
+	require.NoError(t, err)
 
 	listBackup := proof.Commitments
 	proof.Commitments = proof.Commitments[:len(proof.Commitments)-1]
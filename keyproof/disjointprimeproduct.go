@@ -1,6 +1,8 @@
 package keyproof
 
 import (
+	"context"
+
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/internal/common"
 )
@@ -9,7 +11,7 @@ type DisjointPrimeProductProof struct {
 	Responses []*big.Int
 }
 
-func disjointPrimeProductBuildProof(P *big.Int, Q *big.Int, challenge *big.Int, index *big.Int) DisjointPrimeProductProof {
+func disjointPrimeProductBuildProof(ctx context.Context, P *big.Int, Q *big.Int, challenge *big.Int, index *big.Int) (DisjointPrimeProductProof, error) {
 	// Precalculate values for response
 	N := new(big.Int).Mul(P, Q)
 	phiN := new(big.Int).Mul(new(big.Int).Sub(P, big.NewInt(1)), new(big.Int).Sub(Q, big.NewInt(1)))
@@ -25,6 +27,9 @@ func disjointPrimeProductBuildProof(P *big.Int, Q *big.Int, challenge *big.Int,
 	// Generate the challenges and responses
 	var proof DisjointPrimeProductProof
 	for i := 0; i < squareFreeIters; i++ {
+		if err := ctx.Err(); err != nil {
+			return DisjointPrimeProductProof{}, err
+		}
 		// Generate the challenge
 		curc := common.GetHashNumber(challenge, index, i, uint(N.BitLen()))
 		curc.Mod(curc, N)
@@ -37,7 +42,7 @@ func disjointPrimeProductBuildProof(P *big.Int, Q *big.Int, challenge *big.Int,
 		proof.Responses = append(proof.Responses, new(big.Int).Exp(curc, oddNInv, N))
 	}
 
-	return proof
+	return proof, nil
 }
 
 func disjointPrimeProductVerifyStructure(proof DisjointPrimeProductProof) bool {
@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"testing"
 
 	"github.com/privacybydesign/gabi/big"
@@ -11,7 +12,8 @@ import (
 func TestDisjointPrimeProductCycle(t *testing.T) {
 	const p = 2063
 	const q = 1187
-	proof := disjointPrimeProductBuildProof(big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	proof, err := disjointPrimeProductBuildProof(context.Background(), big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	require.NoError(t, err)
 	require.True(t, disjointPrimeProductVerifyStructure(proof), "Proof structure rejected")
 	assert.True(t,
 		disjointPrimeProductVerifyProof(big.NewInt(p*q), big.NewInt(12345), big.NewInt(2), proof),
@@ -21,7 +23,8 @@ func TestDisjointPrimeProductCycle(t *testing.T) {
 func TestDisjointPrimeProductCycleIncorrect(t *testing.T) {
 	const p = 2063
 	const q = 1187
-	proof := disjointPrimeProductBuildProof(big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	proof, err := disjointPrimeProductBuildProof(context.Background(), big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	require.NoError(t, err)
 	proof.Responses[0].Add(proof.Responses[0], big.NewInt(1))
 	assert.False(t,
 		disjointPrimeProductVerifyProof(big.NewInt(p*q), big.NewInt(12345), big.NewInt(2), proof),
@@ -31,7 +34,8 @@ func TestDisjointPrimeProductCycleIncorrect(t *testing.T) {
 func TestDisjointPrimeProductWrongChallenge(t *testing.T) {
 	const p = 2063
 	const q = 1187
-	proof := disjointPrimeProductBuildProof(big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	proof, err := disjointPrimeProductBuildProof(context.Background(), big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	require.NoError(t, err)
 	assert.False(t,
 		disjointPrimeProductVerifyProof(big.NewInt(p*q), big.NewInt(12346), big.NewInt(2), proof),
 		"Incorrect DisjointPrimeProductProof accepted.")
@@ -40,7 +44,8 @@ func TestDisjointPrimeProductWrongChallenge(t *testing.T) {
 func TestDisjointPrimeProductWrongIndex(t *testing.T) {
 	const p = 2063
 	const q = 1187
-	proof := disjointPrimeProductBuildProof(big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	proof, err := disjointPrimeProductBuildProof(context.Background(), big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	require.NoError(t, err)
 	assert.False(t,
 		disjointPrimeProductVerifyProof(big.NewInt(p*q), big.NewInt(12345), big.NewInt(3), proof),
 		"Incorrect DisjointPrimeProductProof accepted.")
@@ -49,7 +54,8 @@ func TestDisjointPrimeProductWrongIndex(t *testing.T) {
 func TestDisjointPrimeProductVerifyStructure(t *testing.T) {
 	const p = 2063
 	const q = 1187
-	proof := disjointPrimeProductBuildProof(big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	proof, err := disjointPrimeProductBuildProof(context.Background(), big.NewInt(p), big.NewInt(q), big.NewInt(12345), big.NewInt(2))
+	require.NoError(t, err)
 
 	listBackup := proof.Responses
 	proof.Responses = proof.Responses[:len(proof.Responses)-1]
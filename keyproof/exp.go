@@ -4,6 +4,7 @@ import (
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/zkproof"
 
+	"context"
 	"fmt"
 	"runtime"
 	"strings"
@@ -212,7 +213,7 @@ func newExpProofStructure(base, exponent, mod, result string, bitlen uint) expPr
 	return structure
 }
 
-func (s *expProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*big.Int, bases zkproof.BaseLookup, secretdata zkproof.SecretLookup) ([]*big.Int, expProofCommit) {
+func (s *expProofStructure) commitmentsFromSecrets(ctx context.Context, g zkproof.Group, list []*big.Int, bases zkproof.BaseLookup, secretdata zkproof.SecretLookup) ([]*big.Int, expProofCommit, error) {
 	var commit expProofCommit
 	var todo []func([]*big.Int)
 	todoOffset := new(uint32)
@@ -361,12 +362,17 @@ func (s *expProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*big.
 		})
 	}
 
+	// With a custom source of randomness, the commitments are computed sequentially so that they
+	// are reproducible
 	workerCount := runtime.NumCPU()
+	if g.Rand != nil {
+		workerCount = 1
+	}
 	wg := sync.WaitGroup{}
 	wg.Add(workerCount)
 	for worker := 0; worker < workerCount; worker++ {
 		go func() {
-			for {
+			for ctx.Err() == nil {
 				offset := int(atomic.AddUint32(todoOffset, 1))
 				if offset > len(todo) {
 					break
@@ -378,11 +384,14 @@ func (s *expProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*big.
 	}
 
 	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, expProofCommit{}, err
+	}
 
-	return list, commit
+	return list, commit, nil
 }
 
-func (s *expProofStructure) buildProof(g zkproof.Group, challenge *big.Int, commit expProofCommit, secretdata zkproof.SecretLookup) ExpProof {
+func (s *expProofStructure) buildProof(ctx context.Context, g zkproof.Group, challenge *big.Int, commit expProofCommit, secretdata zkproof.SecretLookup) (ExpProof, error) {
 	var proof ExpProof
 
 	// inner secret data
@@ -413,11 +422,17 @@ func (s *expProofStructure) buildProof(g zkproof.Group, challenge *big.Int, comm
 		proof.BasePowProofs[i] = s.basePows[i].buildProof(g, challenge, commit.basePows[i])
 	}
 	for i := range commit.basePowRangeCommit {
+		if err := ctx.Err(); err != nil {
+			return ExpProof{}, err
+		}
 		proof.BasePowRangeProofs = append(
 			proof.BasePowRangeProofs,
 			s.basePowRange[i].buildProof(g, challenge, commit.basePowRangeCommit[i], &innerSecrets))
 	}
 	for i := range commit.basePowRelCommit {
+		if err := ctx.Err(); err != nil {
+			return ExpProof{}, err
+		}
 		proof.BasePowRelProofs = append(
 			proof.BasePowRelProofs,
 			s.basePowRels[i].buildProof(g, challenge, commit.basePowRelCommit[i], &innerSecrets))
@@ -432,6 +447,9 @@ func (s *expProofStructure) buildProof(g zkproof.Group, challenge *big.Int, comm
 		proof.InterResProofs[i] = s.interRess[i].buildProof(g, challenge, commit.interRess[i])
 	}
 	for i := range commit.interResRangeCommit {
+		if err := ctx.Err(); err != nil {
+			return ExpProof{}, err
+		}
 		proof.InterResRangeProofs = append(
 			proof.InterResRangeProofs,
 			s.interResRange[i].buildProof(g, challenge, commit.interResRangeCommit[i], &innerSecrets))
@@ -439,6 +457,9 @@ func (s *expProofStructure) buildProof(g zkproof.Group, challenge *big.Int, comm
 
 	// step proofs
 	for i := range commit.interStepsCommit {
+		if err := ctx.Err(); err != nil {
+			return ExpProof{}, err
+		}
 		proof.InterStepsProofs = append(
 			proof.InterStepsProofs,
 			s.interSteps[i].buildProof(g, challenge, commit.interStepsCommit[i], &innerSecrets))
@@ -447,7 +468,7 @@ func (s *expProofStructure) buildProof(g zkproof.Group, challenge *big.Int, comm
 	// Calculate our segments of the proof
 	proof.ExpBitEqHider = commit.expBitEqHider.buildProof(g, challenge)
 
-	return proof
+	return proof, nil
 }
 
 func (s *expProofStructure) fakeProof(g zkproof.Group, challenge *big.Int) ExpProof {
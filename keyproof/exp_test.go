@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -38,13 +39,15 @@ func TestExpProofFlow(t *testing.T) {
 
 	assert.True(t, s.isTrue(&secrets), "proof premise deemed false")
 
-	listSecrets, commit := s.commitmentsFromSecrets(g, []*big.Int{}, &bases, &secrets)
+	listSecrets, commit, err := s.commitmentsFromSecrets(context.Background(), g, []*big.Int{}, &bases, &secrets)
+	require.NoError(t, err)
 
 	assert.Equal(t, len(listSecrets), s.numCommitments(), "NumCommitments is off")
 	assert.Equal(t, int(Follower.(*TestFollower).count), s.numRangeProofs(), "Logging is off GenerateCommitmentsFromSecrets")
 	Follower.(*TestFollower).count = 0
 
-	proof := s.buildProof(g, big.NewInt(12345), commit, &secrets)
+	proof, err := s.buildProof(context.Background(), g, big.NewInt(12345), commit, &secrets)
+	require.NoError(t, err)
 
 	require.True(t, s.verifyProofStructure(big.NewInt(12345), proof), "proof structure rejected")
 
@@ -52,14 +52,14 @@ func (s *expStepStructure) commitmentsFromSecrets(g zkproof.Group, list []*big.I
 		list, commit.acommit = s.stepa.commitmentsFromSecrets(g, list, bases, secretdata)
 
 		// fake b
-		commit.bchallenge = common.FastRandomBigInt(new(big.Int).Lsh(big.NewInt(1), 256))
+		commit.bchallenge = common.FastRandomBigIntFrom(g.Rand, new(big.Int).Lsh(big.NewInt(1), 256))
 		commit.bproof = s.stepb.fakeProof(g)
 		list = s.stepb.commitmentsFromProof(g, list, commit.bchallenge, bases, commit.bproof)
 	} else {
 		commit.isTypeA = false
 
 		// fake a
-		commit.achallenge = common.FastRandomBigInt(new(big.Int).Lsh(big.NewInt(1), 256))
+		commit.achallenge = common.FastRandomBigIntFrom(g.Rand, new(big.Int).Lsh(big.NewInt(1), 256))
 		commit.aproof = s.stepa.fakeProof(g)
 		list = s.stepa.commitmentsFromProof(g, list, commit.achallenge, bases, commit.aproof)
 
@@ -97,7 +97,7 @@ func (s *expStepStructure) buildProof(g zkproof.Group, challenge *big.Int, commi
 func (s *expStepStructure) fakeProof(g zkproof.Group, challenge *big.Int) ExpStepProof {
 	var proof ExpStepProof
 
-	proof.Achallenge = common.FastRandomBigInt(new(big.Int).Lsh(big.NewInt(1), 256))
+	proof.Achallenge = common.FastRandomBigIntFrom(g.Rand, new(big.Int).Lsh(big.NewInt(1), 256))
 	proof.Bchallenge = new(big.Int).Xor(challenge, proof.Achallenge)
 	proof.Aproof = s.stepa.fakeProof(g)
 	proof.Bproof = s.stepb.fakeProof(g)
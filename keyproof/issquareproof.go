@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -110,7 +111,7 @@ func newIsSquareProofStructure(N *big.Int, Squares []*big.Int) isSquareProofStru
 	return result
 }
 
-func (s *isSquareProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*big.Int, P *big.Int, Q *big.Int) ([]*big.Int, isSquareProofCommit) {
+func (s *isSquareProofStructure) commitmentsFromSecrets(ctx context.Context, g zkproof.Group, list []*big.Int, P *big.Int, Q *big.Int) ([]*big.Int, isSquareProofCommit, error) {
 	// Setup commit structure
 	commit := isSquareProofCommit{
 		squares:         make([]pedersenCommit, len(s.squares)),
@@ -159,16 +160,22 @@ func (s *isSquareProofStructure) commitmentsFromSecrets(g zkproof.Group, list []
 		list = s.squaresRep[i].CommitmentsFromSecrets(g, list, &bases, &secrets)
 	}
 	for i := range s.rootsRange {
+		if err := ctx.Err(); err != nil {
+			return nil, isSquareProofCommit{}, err
+		}
 		list, commit.rootRangeCommit[i] = s.rootsRange[i].commitmentsFromSecrets(g, list, &bases, &secrets)
 	}
 	for i := range s.rootsValid {
+		if err := ctx.Err(); err != nil {
+			return nil, isSquareProofCommit{}, err
+		}
 		list, commit.rootValidCommit[i] = s.rootsValid[i].commitmentsFromSecrets(g, list, &bases, &secrets)
 	}
 
-	return list, commit
+	return list, commit, nil
 }
 
-func (s *isSquareProofStructure) buildProof(g zkproof.Group, challenge *big.Int, commit isSquareProofCommit) IsSquareProof {
+func (s *isSquareProofStructure) buildProof(ctx context.Context, g zkproof.Group, challenge *big.Int, commit isSquareProofCommit) (IsSquareProof, error) {
 	// Build up secrets (this is ugly code, hopefully go2 will make this better someday)
 	var secretList []zkproof.SecretLookup
 	for i := range commit.squares {
@@ -195,13 +202,19 @@ func (s *isSquareProofStructure) buildProof(g zkproof.Group, challenge *big.Int,
 		proof.RootsProof[i] = s.rootsRep[i].buildProof(g, challenge, commit.roots[i])
 	}
 	for i := range s.rootsRange {
+		if err := ctx.Err(); err != nil {
+			return IsSquareProof{}, err
+		}
 		proof.RootsRangeProof[i] = s.rootsRange[i].buildProof(g, challenge, commit.rootRangeCommit[i], &secrets)
 	}
 	for i := range s.rootsValid {
+		if err := ctx.Err(); err != nil {
+			return IsSquareProof{}, err
+		}
 		proof.RootsValidProof[i] = s.rootsValid[i].buildProof(g, challenge, commit.rootValidCommit[i], &secrets)
 	}
 
-	return proof
+	return proof, nil
 }
 
 func (s *isSquareProofStructure) verifyProofStructure(proof IsSquareProof) bool {
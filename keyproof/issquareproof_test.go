@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"testing"
 
 	"github.com/privacybydesign/gabi/big"
@@ -22,13 +23,15 @@ func TestIsSquareProof(t *testing.T) {
 
 	s := newIsSquareProofStructure(big.NewInt(p*q), []*big.Int{big.NewInt(a), big.NewInt(b)})
 
-	listSecret, commit := s.commitmentsFromSecrets(g, []*big.Int{}, big.NewInt(p), big.NewInt(q))
+	listSecret, commit, err := s.commitmentsFromSecrets(context.Background(), g, []*big.Int{}, big.NewInt(p), big.NewInt(q))
+	require.NoError(t, err)
 
 	assert.Equal(t, len(listSecret), s.numCommitments(), "NumCommitments is off")
 	assert.Equal(t, int(Follower.(*TestFollower).count), s.numRangeProofs(), "Logging is off GenerateCommitmentsFromSecrets")
 	Follower.(*TestFollower).count = 0
 
-	proof := s.buildProof(g, big.NewInt(12345), commit)
+	proof, err := s.buildProof(context.Background(), g, big.NewInt(12345), commit)
+	require.NoError(t, err)
 
 	assert.True(t, s.verifyProofStructure(proof), "Proof structure rejected")
 
@@ -48,8 +51,10 @@ func TestIsSquareProofStructure(t *testing.T) {
 	require.True(t, gok, "Failed to setup group for Range proof testing")
 
 	s := newIsSquareProofStructure(big.NewInt(p*q), []*big.Int{big.NewInt(a), big.NewInt(b)})
-	_, commit := s.commitmentsFromSecrets(g, []*big.Int{}, big.NewInt(p), big.NewInt(q))
-	proof := s.buildProof(g, big.NewInt(12345), commit)
+	_, commit, err := s.commitmentsFromSecrets(context.Background(), g, []*big.Int{}, big.NewInt(p), big.NewInt(q))
+	require.NoError(t, err)
+	proof, err := s.buildProof(context.Background(), g, big.NewInt(12345), commit)
+	require.NoError(t, err)
 
 	backup := proof.NProof.Commit
 	proof.NProof.Commit = nil
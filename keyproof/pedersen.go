@@ -76,7 +76,7 @@ func (s *pedersenStructure) commitmentsFromSecrets(g zkproof.Group, list []*big.
 	result := pedersenCommit{
 		name:    s.name,
 		secretv: newSecret(g, s.name, value),
-		hider:   newSecret(g, strings.Join([]string{s.name, "hider"}, "_"), common.FastRandomBigInt(g.Order)),
+		hider:   newSecret(g, strings.Join([]string{s.name, "hider"}, "_"), common.FastRandomBigIntFrom(g.Rand, g.Order)),
 		g:       &g,
 		commit:  new(big.Int),
 	}
@@ -112,8 +112,8 @@ func (s *pedersenStructure) buildProof(g zkproof.Group, challenge *big.Int, comm
 
 func (s *pedersenStructure) fakeProof(g zkproof.Group) PedersenProof {
 	var gCommit, hCommit big.Int
-	g.Exp(&gCommit, "g", common.FastRandomBigInt(g.Order), g.P)
-	g.Exp(&hCommit, "h", common.FastRandomBigInt(g.Order), g.P)
+	g.Exp(&gCommit, "g", common.FastRandomBigIntFrom(g.Rand, g.Order), g.P)
+	g.Exp(&hCommit, "h", common.FastRandomBigIntFrom(g.Rand, g.Order), g.P)
 	var Commit big.Int
 	Commit.Mul(&gCommit, &hCommit)
 	Commit.Mod(&Commit, g.P)
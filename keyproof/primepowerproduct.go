@@ -1,6 +1,8 @@
 package keyproof
 
 import (
+	"context"
+
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/internal/common"
 )
@@ -9,7 +11,7 @@ type PrimePowerProductProof struct {
 	Responses []*big.Int
 }
 
-func primePowerProductBuildProof(P *big.Int, Q *big.Int, challenge *big.Int, index *big.Int) PrimePowerProductProof {
+func primePowerProductBuildProof(ctx context.Context, P *big.Int, Q *big.Int, challenge *big.Int, index *big.Int) (PrimePowerProductProof, error) {
 	N := new(big.Int).Mul(P, Q)
 
 	// And for response generation
@@ -21,6 +23,9 @@ func primePowerProductBuildProof(P *big.Int, Q *big.Int, challenge *big.Int, ind
 	// Generate the challenges and responses
 	var proof PrimePowerProductProof
 	for i := 0; i < primePowerProductIters; i++ {
+		if err := ctx.Err(); err != nil {
+			return PrimePowerProductProof{}, err
+		}
 		// Generate the challenge
 		curc := common.GetHashNumber(challenge, index, i, uint(N.BitLen()))
 		curc.Mod(curc, N)
@@ -48,7 +53,7 @@ func primePowerProductBuildProof(P *big.Int, Q *big.Int, challenge *big.Int, ind
 		}
 	}
 
-	return proof
+	return proof, nil
 }
 
 func primePowerProductVerifyStructure(proof PrimePowerProductProof) bool {
@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"testing"
 
 	"github.com/privacybydesign/gabi/big"
@@ -11,7 +12,8 @@ import (
 func TestPrimePowerProductCycle(t *testing.T) {
 	const p = 1031
 	const q = 1061
-	proof := primePowerProductBuildProof(big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	proof, err := primePowerProductBuildProof(context.Background(), big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	require.NoError(t, err)
 	require.True(t, primePowerProductVerifyStructure(proof), "Proof structure rejected")
 	ok := primePowerProductVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12345), big.NewInt(1), proof)
 	assert.True(t, ok, "PrimePowerProductProof rejected")
@@ -20,7 +22,8 @@ func TestPrimePowerProductCycle(t *testing.T) {
 func TestPrimePowerProductCycleIncorrect(t *testing.T) {
 	const p = 1031
 	const q = 1061
-	proof := primePowerProductBuildProof(big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	proof, err := primePowerProductBuildProof(context.Background(), big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	require.NoError(t, err)
 	proof.Responses[0].Add(proof.Responses[0], big.NewInt(1))
 	ok := primePowerProductVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12345), big.NewInt(1), proof)
 	assert.False(t, ok, "Incorrect PrimePowerProductProof accepted")
@@ -29,7 +32,8 @@ func TestPrimePowerProductCycleIncorrect(t *testing.T) {
 func TestPrimePowerProductCycleWrongChallenge(t *testing.T) {
 	const p = 1031
 	const q = 1061
-	proof := primePowerProductBuildProof(big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	proof, err := primePowerProductBuildProof(context.Background(), big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	require.NoError(t, err)
 	ok := primePowerProductVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12346), big.NewInt(1), proof)
 	assert.False(t, ok, "Incorrect PrimePowerProductProof accepted")
 }
@@ -37,7 +41,8 @@ func TestPrimePowerProductCycleWrongChallenge(t *testing.T) {
 func TestPrimePowerProductCycleWrongIndex(t *testing.T) {
 	const p = 1031
 	const q = 1061
-	proof := primePowerProductBuildProof(big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	proof, err := primePowerProductBuildProof(context.Background(), big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	require.NoError(t, err)
 	ok := primePowerProductVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12345), big.NewInt(2), proof)
 	assert.False(t, ok, "Incorrect PrimePowerProductProof accepted")
 }
@@ -45,7 +50,8 @@ func TestPrimePowerProductCycleWrongIndex(t *testing.T) {
 func TestPrimePowerProductVerifyStructure(t *testing.T) {
 	const p = 1031
 	const q = 1061
-	proof := primePowerProductBuildProof(big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	proof, err := primePowerProductBuildProof(context.Background(), big.NewInt(int64(p)), big.NewInt(int64(q)), big.NewInt(12345), big.NewInt(1))
+	require.NoError(t, err)
 
 	listBackup := proof.Responses
 	proof.Responses = proof.Responses[:len(proof.Responses)-1]
@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"strings"
 
 	"github.com/privacybydesign/gabi/big"
@@ -162,11 +163,11 @@ func newPrimeProofStructure(name string, bitlen uint) primeProofStructure {
 	return structure
 }
 
-func (s *primeProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*big.Int, bases zkproof.BaseLookup, secretdata zkproof.SecretLookup) ([]*big.Int, primeProofCommit) {
+func (s *primeProofStructure) commitmentsFromSecrets(ctx context.Context, g zkproof.Group, list []*big.Int, bases zkproof.BaseLookup, secretdata zkproof.SecretLookup) ([]*big.Int, primeProofCommit, error) {
 	var commit primeProofCommit
 
 	// Build prea
-	list, commit.prea = s.prea.commitmentsFromSecrets(g, list, common.FastRandomBigInt(secretdata.Secret(s.primeName)))
+	list, commit.prea = s.prea.commitmentsFromSecrets(g, list, common.FastRandomBigIntFrom(g.Rand, secretdata.Secret(s.primeName)))
 
 	// Calculate aAdd, a, and d
 	aAdd := common.GetHashNumber(commit.prea.commit, nil, 0, s.bitlen)
@@ -197,10 +198,13 @@ func (s *primeProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*bi
 			g.Order))
 
 	// Find aneg
-	aneg := common.FastRandomBigInt(secretdata.Secret(s.primeName))
+	aneg := common.FastRandomBigIntFrom(g.Rand, secretdata.Secret(s.primeName))
 	anegPow := new(big.Int).Exp(aneg, new(big.Int).Rsh(secretdata.Secret(s.primeName), 1), secretdata.Secret(s.primeName))
 	for anegPow.Cmp(new(big.Int).Sub(secretdata.Secret(s.primeName), big.NewInt(1))) != 0 {
-		aneg.Set(common.FastRandomBigInt(secretdata.Secret(s.primeName)))
+		if err := ctx.Err(); err != nil {
+			return nil, primeProofCommit{}, err
+		}
+		aneg.Set(common.FastRandomBigIntFrom(g.Rand, secretdata.Secret(s.primeName)))
 		anegPow.Exp(aneg, new(big.Int).Rsh(secretdata.Secret(s.primeName), 1), secretdata.Secret(s.primeName))
 	}
 
@@ -217,7 +221,7 @@ func (s *primeProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*bi
 	list, commit.aRes = s.aRes.commitmentsFromSecrets(g, list, aRes)
 	list, commit.anegRes = s.anegRes.commitmentsFromSecrets(g, list, anegRes)
 	commit.aInvalid = fakeProof(g)
-	commit.aInvalidChallenge = common.FastRandomBigInt(g.Order)
+	commit.aInvalidChallenge = common.FastRandomBigIntFrom(g.Rand, g.Order)
 	if aRes.Cmp(big.NewInt(1)) == 0 {
 		commit.aValid = newSecret(g, strings.Join([]string{s.myname, "aresplus1hider"}, "_"), commit.aRes.hider.secretv)
 		commit.aInvalid.setName(strings.Join([]string{s.myname, "aresmin1hider"}, "_"))
@@ -289,13 +293,18 @@ func (s *primeProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*bi
 		list = s.aPlus1ResRep.CommitmentsFromProof(g, list, commit.aInvalidChallenge, &innerBases, &commit.aInvalid)
 		list = s.aMin1ResRep.CommitmentsFromSecrets(g, list, &innerBases, &secrets)
 	}
-	list, commit.aExpCommit = s.aExp.commitmentsFromSecrets(g, list, &innerBases, &secrets)
-	list, commit.anegExpCommit = s.anegExp.commitmentsFromSecrets(g, list, &innerBases, &secrets)
+	var err error
+	if list, commit.aExpCommit, err = s.aExp.commitmentsFromSecrets(ctx, g, list, &innerBases, &secrets); err != nil {
+		return nil, primeProofCommit{}, err
+	}
+	if list, commit.anegExpCommit, err = s.anegExp.commitmentsFromSecrets(ctx, g, list, &innerBases, &secrets); err != nil {
+		return nil, primeProofCommit{}, err
+	}
 
-	return list, commit
+	return list, commit, nil
 }
 
-func (s *primeProofStructure) buildProof(g zkproof.Group, challenge *big.Int, commit primeProofCommit, secretdata zkproof.SecretLookup) PrimeProof {
+func (s *primeProofStructure) buildProof(ctx context.Context, g zkproof.Group, challenge *big.Int, commit primeProofCommit, secretdata zkproof.SecretLookup) (PrimeProof, error) {
 	var proof PrimeProof
 
 	// Rebuild structure for the a generation proofs
@@ -357,10 +366,15 @@ func (s *primeProofStructure) buildProof(g zkproof.Group, challenge *big.Int, co
 		proof.AMin1 = commit.aValid.buildProof(g, proof.AMin1Challenge)
 	}
 
-	proof.AExpProof = s.aExp.buildProof(g, challenge, commit.aExpCommit, &secrets)
-	proof.AnegExpProof = s.anegExp.buildProof(g, challenge, commit.anegExpCommit, &secrets)
+	var err error
+	if proof.AExpProof, err = s.aExp.buildProof(ctx, g, challenge, commit.aExpCommit, &secrets); err != nil {
+		return PrimeProof{}, err
+	}
+	if proof.AnegExpProof, err = s.anegExp.buildProof(ctx, g, challenge, commit.anegExpCommit, &secrets); err != nil {
+		return PrimeProof{}, err
+	}
 
-	return proof
+	return proof, nil
 }
 
 func (s *primeProofStructure) fakeProof(g zkproof.Group, challenge *big.Int) PrimeProof {
@@ -405,7 +419,7 @@ func (s *primeProofStructure) fakeProof(g zkproof.Group, challenge *big.Int) Pri
 	proof.PreaHider = fakeProof(g)
 	proof.APlus1 = fakeProof(g)
 	proof.AMin1 = fakeProof(g)
-	proof.APlus1Challenge = common.FastRandomBigInt(new(big.Int).Lsh(big.NewInt(1), 256))
+	proof.APlus1Challenge = common.FastRandomBigIntFrom(g.Rand, new(big.Int).Lsh(big.NewInt(1), 256))
 	proof.AMin1Challenge = new(big.Int).Xor(challenge, proof.APlus1Challenge)
 
 	proof.AExpProof = s.aExp.fakeProof(g, challenge)
@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -26,13 +27,15 @@ func TestPrimeProofFlow(t *testing.T) {
 	_, pCommit := pCommits.commitmentsFromSecrets(g, nil, p)
 	bases := zkproof.NewBaseMerge(&g, &pCommit)
 
-	listSecrets, commit := s.commitmentsFromSecrets(g, []*big.Int{}, &bases, &pCommit)
+	listSecrets, commit, err := s.commitmentsFromSecrets(context.Background(), g, []*big.Int{}, &bases, &pCommit)
+	require.NoError(t, err)
 
 	require.Equal(t, len(listSecrets), s.numCommitments(), "NumCommitments is off")
 	require.Equal(t, int(Follower.(*TestFollower).count), s.numRangeProofs(), "Logging is off GenerateCommitmentsFromSecrets")
 	Follower.(*TestFollower).count = 0
 
-	proof := s.buildProof(g, big.NewInt(12345), commit, &pCommit)
+	proof, err := s.buildProof(context.Background(), g, big.NewInt(12345), commit, &pCommit)
+	require.NoError(t, err)
 	pProof := pCommits.buildProof(g, big.NewInt(12345), pCommit)
 	pProof.setName("p")
 
@@ -46,6 +49,30 @@ func TestPrimeProofFlow(t *testing.T) {
 	assert.Equal(t, listSecrets, listProof, "Commitment lists differ.")
 }
 
+func TestPrimeProofCancelled(t *testing.T) {
+	g, gok := zkproof.BuildGroup(testP)
+	require.True(t, gok, "Failed to setup group for Prime proof testing")
+
+	s := newPrimeProofStructure("p", uint(testP.BitLen())-2)
+
+	p, err := safeprime.Generate(testP.BitLen()-2, nil)
+	require.NoError(t, err)
+
+	pCommits := newPedersenStructure("p")
+	_, pCommit := pCommits.commitmentsFromSecrets(g, nil, p)
+	bases := zkproof.NewBaseMerge(&g, &pCommit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = s.commitmentsFromSecrets(ctx, g, []*big.Int{}, &bases, &pCommit)
+	assert.Equal(t, context.Canceled, err)
+
+	_, commit, err := s.commitmentsFromSecrets(context.Background(), g, []*big.Int{}, &bases, &pCommit)
+	require.NoError(t, err)
+	_, err = s.buildProof(ctx, g, big.NewInt(12345), commit, &pCommit)
+	assert.Equal(t, context.Canceled, err)
+}
+
 func TestPrimeProofFake(t *testing.T) {
 	g, gok := zkproof.BuildGroup(big.NewInt(47))
 	require.True(t, gok, "Failed to setup group for Prime proof testing")
@@ -1,6 +1,11 @@
 package keyproof
 
-import "github.com/privacybydesign/gabi/big"
+import (
+	"context"
+	"io"
+
+	"github.com/privacybydesign/gabi/big"
+)
 
 type (
 	quasiSafePrimeProductCommit struct {
@@ -15,13 +20,14 @@ type (
 	}
 )
 
-func quasiSafePrimeProductBuildCommitments(list []*big.Int, Pprime *big.Int, Qprime *big.Int) ([]*big.Int, quasiSafePrimeProductCommit) {
+func quasiSafePrimeProductBuildCommitments(ctx context.Context, random io.Reader, list []*big.Int, Pprime *big.Int, Qprime *big.Int) ([]*big.Int, quasiSafePrimeProductCommit, error) {
 	var commit quasiSafePrimeProductCommit
-	list, commit.asppCommit = almostSafePrimeProductBuildCommitments(list, Pprime, Qprime)
-	return list, commit
+	var err error
+	list, commit.asppCommit, err = almostSafePrimeProductBuildCommitments(ctx, random, list, Pprime, Qprime)
+	return list, commit, err
 }
 
-func quasiSafePrimeProductBuildProof(Pprime *big.Int, Qprime *big.Int, challenge *big.Int, commit quasiSafePrimeProductCommit) QuasiSafePrimeProductProof {
+func quasiSafePrimeProductBuildProof(ctx context.Context, Pprime *big.Int, Qprime *big.Int, challenge *big.Int, commit quasiSafePrimeProductCommit) (QuasiSafePrimeProductProof, error) {
 	// Calculate useful intermediaries
 	P := new(big.Int).Add(new(big.Int).Lsh(Pprime, 1), big.NewInt(1))
 	Q := new(big.Int).Add(new(big.Int).Lsh(Qprime, 1), big.NewInt(1))
@@ -30,12 +36,21 @@ func quasiSafePrimeProductBuildProof(Pprime *big.Int, Qprime *big.Int, challenge
 
 	// Build the actual proofs
 	var proof QuasiSafePrimeProductProof
-	proof.SFproof = squareFreeBuildProof(N, phiN, challenge, big.NewInt(0))
-	proof.PPPproof = primePowerProductBuildProof(P, Q, challenge, big.NewInt(1))
-	proof.DPPproof = disjointPrimeProductBuildProof(P, Q, challenge, big.NewInt(2))
-	proof.ASPPproof = almostSafePrimeProductBuildProof(Pprime, Qprime, challenge, big.NewInt(3), commit.asppCommit)
+	var err error
+	if proof.SFproof, err = squareFreeBuildProof(ctx, N, phiN, challenge, big.NewInt(0)); err != nil {
+		return QuasiSafePrimeProductProof{}, err
+	}
+	if proof.PPPproof, err = primePowerProductBuildProof(ctx, P, Q, challenge, big.NewInt(1)); err != nil {
+		return QuasiSafePrimeProductProof{}, err
+	}
+	if proof.DPPproof, err = disjointPrimeProductBuildProof(ctx, P, Q, challenge, big.NewInt(2)); err != nil {
+		return QuasiSafePrimeProductProof{}, err
+	}
+	if proof.ASPPproof, err = almostSafePrimeProductBuildProof(ctx, Pprime, Qprime, challenge, big.NewInt(3), commit.asppCommit); err != nil {
+		return QuasiSafePrimeProductProof{}, err
+	}
 
-	return proof
+	return proof, nil
 }
 
 func quasiSafePrimeProductVerifyStructure(proof QuasiSafePrimeProductProof) bool {
@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -12,8 +13,10 @@ import (
 )
 
 func TestQuasiSafePrimeProductCycle(t *testing.T) {
-	listBefore, commit := quasiSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
-	proof := quasiSafePrimeProductBuildProof(testPPrime, testQPrime, big.NewInt(12345), commit)
+	listBefore, commit, err := quasiSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
+	proof, err := quasiSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, big.NewInt(12345), commit)
+	require.NoError(t, err)
 	assert.True(t, quasiSafePrimeProductVerifyStructure(proof), "Proof structure rejected")
 	listAfter := quasiSafePrimeProductExtractCommitments([]*big.Int{}, proof)
 	ok := quasiSafePrimeProductVerifyProof(testN, big.NewInt(12345), proof)
@@ -23,9 +26,11 @@ func TestQuasiSafePrimeProductCycle(t *testing.T) {
 
 func TestQuasiSafePrimeProductFullCycle(t *testing.T) {
 	// Build proof
-	listBefore, commit := quasiSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
+	listBefore, commit, err := quasiSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
 	challengeBefore := common.HashCommit(listBefore, false)
-	proofBefore := quasiSafePrimeProductBuildProof(testPPrime, testQPrime, challengeBefore, commit)
+	proofBefore, err := quasiSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, challengeBefore, commit)
+	require.NoError(t, err)
 	proofJSON, err := json.Marshal(proofBefore)
 	require.NoError(t, err, "error during json marshal")
 
@@ -40,8 +45,10 @@ func TestQuasiSafePrimeProductFullCycle(t *testing.T) {
 }
 
 func TestQuasiSafePrimeProductVerifyStructure(t *testing.T) {
-	_, commit := quasiSafePrimeProductBuildCommitments([]*big.Int{}, testPPrime, testQPrime)
-	proof := quasiSafePrimeProductBuildProof(testPPrime, testQPrime, big.NewInt(12345), commit)
+	_, commit, err := quasiSafePrimeProductBuildCommitments(context.Background(), nil, []*big.Int{}, testPPrime, testQPrime)
+	require.NoError(t, err)
+	proof, err := quasiSafePrimeProductBuildProof(context.Background(), testPPrime, testQPrime, big.NewInt(12345), commit)
+	require.NoError(t, err)
 
 	valBackup := proof.SFproof.Responses[2]
 	proof.SFproof.Responses[2] = nil
@@ -33,7 +33,11 @@ func (s *rangeProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*bi
 
 	// Build up commit datastructure
 	commit.commits = map[string][]*big.Int{}
+	var names []string // in order of first occurrence, to generate the randomizers in a fixed order
 	for _, curRhs := range s.Rhs {
+		if _, ok := commit.commits[curRhs.Secret]; !ok {
+			names = append(names, curRhs.Secret)
+		}
 		commit.commits[curRhs.Secret] = []*big.Int{}
 	}
 
@@ -43,13 +47,14 @@ func (s *rangeProofStructure) commitmentsFromSecrets(g zkproof.Group, list []*bi
 
 	// Build up the range proof randomizers
 	for i := 0; i < rangeProofIters; i++ {
-		for name, clist := range commit.commits {
+		for _, name := range names {
+			clist := commit.commits[name]
 			var rval *big.Int
 			if name == s.rangeSecret {
-				rval = common.FastRandomBigInt(genLimit)
+				rval = common.FastRandomBigIntFrom(g.Rand, genLimit)
 				rval.Sub(rval, genOffset)
 			} else {
-				rval = common.FastRandomBigInt(g.Order)
+				rval = common.FastRandomBigIntFrom(g.Rand, g.Order)
 			}
 			commit.commits[name] = append(clist, rval)
 		}
@@ -115,13 +120,13 @@ func (s *rangeProofStructure) fakeProof(g zkproof.Group) RangeProof {
 		if curRhs.Secret == s.rangeSecret {
 			rlist := []*big.Int{}
 			for i := 0; i < rangeProofIters; i++ {
-				rlist = append(rlist, common.FastRandomBigInt(genLimit))
+				rlist = append(rlist, common.FastRandomBigIntFrom(g.Rand, genLimit))
 			}
 			proof.Results[curRhs.Secret] = rlist
 		} else {
 			rlist := []*big.Int{}
 			for i := 0; i < rangeProofIters; i++ {
-				rlist = append(rlist, common.FastRandomBigInt(g.Order))
+				rlist = append(rlist, common.FastRandomBigIntFrom(g.Rand, g.Order))
 			}
 			proof.Results[curRhs.Secret] = rlist
 		}
@@ -1,6 +1,9 @@
 package keyproof
 
 import (
+	"context"
+	"io"
+
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/safeprime"
 )
@@ -51,19 +54,24 @@ func findConvenientPrime(size int) *big.Int {
 	return nil
 }
 
-func findSafePrime(size int) *big.Int {
-	result := findConvenientPrime(size)
-	if result == nil {
-		var err error
-		stop := make(chan struct{})
-		resultChan, errChan := safeprime.GenerateConcurrent(size, stop)
-		select {
-		case result = <-resultChan:
-			stop <- struct{}{}
-			break
-		case err = <-errChan:
-			panic(err.Error())
-		}
+// findSafePrime returns a convenient safe prime of about the given size if there is one, and
+// otherwise generates one, sequentially from the specified source of randomness if it is not nil.
+func findSafePrime(ctx context.Context, random io.Reader, size int) (*big.Int, error) {
+	if result := findConvenientPrime(size); result != nil {
+		return result, nil
+	}
+	if random != nil {
+		return safeprime.GenerateWithRand(ctx, random, size)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stop safeprime.GenerateConcurrentContext() when we return
+	resultChan, errChan := safeprime.GenerateConcurrentContext(ctx, size)
+	select {
+	case result := <-resultChan:
+		return result, nil
+	case err := <-errChan:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return result
 }
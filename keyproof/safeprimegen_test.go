@@ -1,6 +1,7 @@
 package keyproof
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,8 +22,16 @@ var testcases = []int{
 
 func TestFindSafePrime(t *testing.T) {
 	for _, tc := range testcases {
-		result := findSafePrime(tc)
+		result, err := findSafePrime(context.Background(), nil, tc)
+		require.NoError(t, err)
 		require.NotNilf(t, result, "Missing result for %d", tc)
 		assert.GreaterOrEqualf(t, result.BitLen(), tc, "Generated prime too short for %d", tc)
 	}
 }
+
+func TestFindSafePrimeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := findSafePrime(ctx, nil, 3000)
+	require.Equal(t, context.Canceled, err)
+}
@@ -23,7 +23,7 @@ func newSecret(g zkproof.Group, name string, value *big.Int) secret {
 	return secret{
 		name,
 		new(big.Int).Set(value),
-		common.FastRandomBigInt(g.Order),
+		common.FastRandomBigIntFrom(g.Rand, g.Order),
 	}
 }
 
@@ -41,7 +41,7 @@ func (p *Proof) verifyStructure() bool {
 func fakeProof(g zkproof.Group) Proof {
 	return Proof{
 		"",
-		common.FastRandomBigInt(g.Order),
+		common.FastRandomBigIntFrom(g.Rand, g.Order),
 	}
 }
 
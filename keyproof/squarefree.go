@@ -1,6 +1,8 @@
 package keyproof
 
 import (
+	"context"
+
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/internal/common"
 )
@@ -9,7 +11,7 @@ type SquareFreeProof struct {
 	Responses []*big.Int
 }
 
-func squareFreeBuildProof(N *big.Int, phiN *big.Int, challenge *big.Int, index *big.Int) SquareFreeProof {
+func squareFreeBuildProof(ctx context.Context, N *big.Int, phiN *big.Int, challenge *big.Int, index *big.Int) (SquareFreeProof, error) {
 	// Precalculate the primary part of the response
 	M := new(big.Int).ModInverse(N, phiN)
 	if M == nil {
@@ -19,6 +21,9 @@ func squareFreeBuildProof(N *big.Int, phiN *big.Int, challenge *big.Int, index *
 	// Generate the challenges and responses
 	var proof SquareFreeProof
 	for i := 0; i < squareFreeIters; i++ {
+		if err := ctx.Err(); err != nil {
+			return SquareFreeProof{}, err
+		}
 		// Generate the challenge
 		curc := common.GetHashNumber(challenge, index, i, uint(N.BitLen()))
 		curc.Mod(curc, N)
@@ -31,7 +36,7 @@ func squareFreeBuildProof(N *big.Int, phiN *big.Int, challenge *big.Int, index *
 		proof.Responses = append(proof.Responses, new(big.Int).Exp(curc, M, N))
 	}
 
-	return proof
+	return proof, nil
 }
 
 func squareFreeVerifyStructure(proof SquareFreeProof) bool {
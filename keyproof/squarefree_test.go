@@ -1,16 +1,19 @@
 package keyproof
 
 import (
+	"context"
 	"testing"
 
 	"github.com/privacybydesign/gabi/big"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSquareFreeCycle(t *testing.T) {
 	const p = 1031
 	const q = 1063
-	proof := squareFreeBuildProof(big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	proof, err := squareFreeBuildProof(context.Background(), big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	require.NoError(t, err)
 	assert.True(t, squareFreeVerifyStructure(proof), "proof structure rejected")
 	ok := squareFreeVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12345), big.NewInt(0), proof)
 	assert.True(t, ok, "SquareFreeProof rejected.")
@@ -19,7 +22,8 @@ func TestSquareFreeCycle(t *testing.T) {
 func TestSquareFreeCycleIncorrect(t *testing.T) {
 	const p = 1031
 	const q = 1063
-	proof := squareFreeBuildProof(big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	proof, err := squareFreeBuildProof(context.Background(), big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	require.NoError(t, err)
 	proof.Responses[0].Add(proof.Responses[0], big.NewInt(1))
 	ok := squareFreeVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12345), big.NewInt(0), proof)
 	assert.False(t, ok, "Incorrect SquareFreeProof accepted.")
@@ -28,7 +32,8 @@ func TestSquareFreeCycleIncorrect(t *testing.T) {
 func TestSquareFreeCycleWrongChallenge(t *testing.T) {
 	const p = 1031
 	const q = 1063
-	proof := squareFreeBuildProof(big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	proof, err := squareFreeBuildProof(context.Background(), big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	require.NoError(t, err)
 	ok := squareFreeVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12346), big.NewInt(0), proof)
 	assert.False(t, ok, "Incorrect SquareFreeProof accepted.")
 }
@@ -36,7 +41,8 @@ func TestSquareFreeCycleWrongChallenge(t *testing.T) {
 func TestSquareFreeCycleWrongIndex(t *testing.T) {
 	const p = 1031
 	const q = 1063
-	proof := squareFreeBuildProof(big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	proof, err := squareFreeBuildProof(context.Background(), big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	require.NoError(t, err)
 	ok := squareFreeVerifyProof(big.NewInt(int64(p*q)), big.NewInt(12345), big.NewInt(1), proof)
 	assert.False(t, ok, "Incorrect SquareFreeProof accepted.")
 }
@@ -44,7 +50,8 @@ func TestSquareFreeCycleWrongIndex(t *testing.T) {
 func TestSquareFreeVerifyStructure(t *testing.T) {
 	const p = 1031
 	const q = 1063
-	proof := squareFreeBuildProof(big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	proof, err := squareFreeBuildProof(context.Background(), big.NewInt(int64(p*q)), big.NewInt(int64((p-1)*(q-1))), big.NewInt(12345), big.NewInt(0))
+	require.NoError(t, err)
 
 	listBackup := proof.Responses
 	proof.Responses = proof.Responses[:len(proof.Responses)-1]
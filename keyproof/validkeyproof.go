@@ -1,6 +1,9 @@
 package keyproof
 
 import (
+	"context"
+	"io"
+
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/internal/common"
 	"github.com/privacybydesign/gabi/safeprime"
@@ -113,15 +116,37 @@ func CanProve(Pprime *big.Int, Qprime *big.Int) bool {
 }
 
 func (s *ValidKeyProofStructure) BuildProof(Pprime *big.Int, Qprime *big.Int) ValidKeyProof {
+	proof, err := s.BuildProofContext(context.Background(), Pprime, Qprime)
+	if err != nil {
+		panic(err.Error())
+	}
+	return proof
+}
+
+// BuildProofContext builds the proof like BuildProof(). If ctx is done before the proof is
+// finished, the computation is aborted and ctx.Err() is returned.
+func (s *ValidKeyProofStructure) BuildProofContext(ctx context.Context, Pprime *big.Int, Qprime *big.Int) (ValidKeyProof, error) {
+	return s.BuildProofWithRand(ctx, nil, Pprime, Qprime)
+}
+
+// BuildProofWithRand builds the proof like BuildProofContext(), using the specified source of
+// randomness. If it is nil, a fast CPRNG seeded from crypto/rand is used; otherwise, the proof is
+// computed sequentially, so that it is reproducible given a deterministic source.
+func (s *ValidKeyProofStructure) BuildProofWithRand(ctx context.Context, random io.Reader, Pprime *big.Int, Qprime *big.Int) (ValidKeyProof, error) {
 	// Generate proof group
 	Follower.StepStart("Generating group prime", 0)
 	primeSize := s.n.BitLen() + 2*rangeProofEpsilon + 10
 
-	GroupPrime := findSafePrime(primeSize)
+	GroupPrime, err := findSafePrime(ctx, random, primeSize)
+	if err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
 	g, gok := zkproof.BuildGroup(GroupPrime)
 	if !gok {
 		panic("Safe prime generated by gabi was not a safe prime!?")
 	}
+	g.Rand = random
 	Follower.StepDone()
 
 	Follower.StepStart("Generating commitments", s.numRangeProofs())
@@ -152,10 +177,22 @@ func (s *ValidKeyProofStructure) BuildProof(Pprime *big.Int, Qprime *big.Int) Va
 	list = s.pPprimeRel.CommitmentsFromSecrets(g, list, &bases, &secrets)
 	list = s.qQprimeRel.CommitmentsFromSecrets(g, list, &bases, &secrets)
 	list = s.pQNRel.CommitmentsFromSecrets(g, list, &bases, &secrets)
-	list, PprimeIsPrimeCommit = s.pprimeIsPrime.commitmentsFromSecrets(g, list, &bases, &secrets)
-	list, QprimeIsPrimeCommit = s.qprimeIsPrime.commitmentsFromSecrets(g, list, &bases, &secrets)
-	list, QSPPcommit = quasiSafePrimeProductBuildCommitments(list, Pprime, Qprime)
-	list, BasesValidCommit = s.basesValid.commitmentsFromSecrets(g, list, P, Q)
+	if list, PprimeIsPrimeCommit, err = s.pprimeIsPrime.commitmentsFromSecrets(ctx, g, list, &bases, &secrets); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
+	if list, QprimeIsPrimeCommit, err = s.qprimeIsPrime.commitmentsFromSecrets(ctx, g, list, &bases, &secrets); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
+	if list, QSPPcommit, err = quasiSafePrimeProductBuildCommitments(ctx, g.Rand, list, Pprime, Qprime); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
+	if list, BasesValidCommit, err = s.basesValid.commitmentsFromSecrets(ctx, g, list, P, Q); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
 	Follower.StepDone()
 
 	Follower.StepStart("Generating proof", 0)
@@ -164,21 +201,33 @@ func (s *ValidKeyProofStructure) BuildProof(Pprime *big.Int, Qprime *big.Int) Va
 
 	// Calculate proofs
 	proof := ValidKeyProof{
-		GroupPrime:         GroupPrime,
-		PQNRel:             PQNRel.buildProof(g, challenge),
-		PProof:             s.p.buildProof(g, challenge, PSecret),
-		QProof:             s.q.buildProof(g, challenge, QSecret),
-		PprimeProof:        s.pprime.buildProof(g, challenge, PprimeSecret),
-		QprimeProof:        s.qprime.buildProof(g, challenge, QprimeSecret),
-		Challenge:          challenge,
-		PprimeIsPrimeProof: s.pprimeIsPrime.buildProof(g, challenge, PprimeIsPrimeCommit, &secrets),
-		QprimeIsPrimeProof: s.qprimeIsPrime.buildProof(g, challenge, QprimeIsPrimeCommit, &secrets),
-		QSPPproof:          quasiSafePrimeProductBuildProof(Pprime, Qprime, challenge, QSPPcommit),
-		BasesValidProof:    s.basesValid.buildProof(g, challenge, BasesValidCommit),
+		GroupPrime:  GroupPrime,
+		PQNRel:      PQNRel.buildProof(g, challenge),
+		PProof:      s.p.buildProof(g, challenge, PSecret),
+		QProof:      s.q.buildProof(g, challenge, QSecret),
+		PprimeProof: s.pprime.buildProof(g, challenge, PprimeSecret),
+		QprimeProof: s.qprime.buildProof(g, challenge, QprimeSecret),
+		Challenge:   challenge,
+	}
+	if proof.PprimeIsPrimeProof, err = s.pprimeIsPrime.buildProof(ctx, g, challenge, PprimeIsPrimeCommit, &secrets); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
+	if proof.QprimeIsPrimeProof, err = s.qprimeIsPrime.buildProof(ctx, g, challenge, QprimeIsPrimeCommit, &secrets); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
+	if proof.QSPPproof, err = quasiSafePrimeProductBuildProof(ctx, Pprime, Qprime, challenge, QSPPcommit); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
+	}
+	if proof.BasesValidProof, err = s.basesValid.buildProof(ctx, g, challenge, BasesValidCommit); err != nil {
+		Follower.StepDone()
+		return ValidKeyProof{}, err
 	}
 	Follower.StepDone()
 
-	return proof
+	return proof, nil
 }
 
 func (s *ValidKeyProofStructure) VerifyProof(proof ValidKeyProof) bool {
@@ -1,10 +1,12 @@
 package keyproof
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
 	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/internal/common"
 	"github.com/privacybydesign/gabi/safeprime"
 	"github.com/stretchr/testify/assert"
 )
@@ -139,3 +141,30 @@ func TestValidKeyProof(t *testing.T) {
 		assert.True(t, s.VerifyProof(proofAfter), "Proof rejected.")
 	})
 }
+
+func TestValidKeyProofCancelled(t *testing.T) {
+	s := NewValidKeyProofStructure(testN, []*big.Int{big.NewInt(36)})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.BuildProofContext(ctx, testPPrime, testQPrime)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestValidKeyProofWithRand(t *testing.T) {
+	s := NewValidKeyProofStructure(testN, []*big.Int{big.NewInt(36)})
+	build := func() ValidKeyProof {
+		random, err := common.NewCPRNG(&[32]byte{1})
+		assert.NoError(t, err)
+		proof, err := s.BuildProofWithRand(context.Background(), random, testPPrime, testQPrime)
+		assert.NoError(t, err)
+		return proof
+	}
+
+	proof := build()
+	assert.True(t, s.VerifyProof(proof))
+	proofJSON, err := json.Marshal(proof)
+	assert.NoError(t, err)
+	otherJSON, err := json.Marshal(build())
+	assert.NoError(t, err)
+	assert.True(t, string(proofJSON) == string(otherJSON), "proofs from the same source of randomness differ")
+}
@@ -1,6 +1,13 @@
 package gabi
 
 import (
+	"io"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/gabikeys"
 	"github.com/privacybydesign/gabi/internal/common"
@@ -8,24 +15,79 @@ import (
 
 // Generate keyshare secret
 func NewKeyshareSecret() (*big.Int, error) {
+	return NewKeyshareSecretWithRand(nil)
+}
+
+// Generate keyshare secret from the specified source of randomness (crypto/rand if nil)
+func NewKeyshareSecretWithRand(random io.Reader) (*big.Int, error) {
 	// This value should be 1 bit less than indicated by Lm, as it is combined with an equal-length value
 	// from the client, resulting in a combined value that should fit in Lm bits.
-	return common.RandomBigInt(gabikeys.DefaultSystemParameters[1024].Lm - 1)
+	return common.RandomBigIntFrom(random, gabikeys.DefaultSystemParameters[1024].Lm-1)
+}
+
+// Generate the secret of one of the given amount of keyshare servers that share the secret key
+// with the client
+func NewMultiKeyshareSecret(servers int) (*big.Int, error) {
+	return NewMultiKeyshareSecretWithRand(nil, servers)
+}
+
+// Generate the secret of one of the given amount of keyshare servers that share the secret key
+// with the client, from the specified source of randomness (crypto/rand if nil)
+func NewMultiKeyshareSecretWithRand(random io.Reader, servers int) (*big.Int, error) {
+	shrink, err := keyshareShrink(servers)
+	if err != nil {
+		return nil, err
+	}
+	// As above, but now servers+1 values of this length are combined (the client's share should
+	// then be of this length as well), so these should all be shrunk enough for the combined value
+	// to fit in Lm bits.
+	return common.RandomBigIntFrom(random, gabikeys.DefaultSystemParameters[1024].Lm-shrink)
+}
+
+// keyshareShrink returns the amount of bits by which the shares of the secret key of the client
+// and the specified amount of keyshare servers must be smaller than Lm, such that their sum fits
+// in Lm bits.
+func keyshareShrink(servers int) (uint, error) {
+	if servers < 1 {
+		return 0, errors.New("at least one keyshare server required")
+	}
+	return uint(bits.Len(uint(servers))), nil
 }
 
 // Generate commitments for the keyshare server for given set of keys
 func NewKeyshareCommitments(secret *big.Int, keys []*gabikeys.PublicKey) (*big.Int, []*ProofPCommitment, error) {
-	// Generate randomizer value.
-	// Given that with this zero knowledge proof we are hiding a secret of length params[1024].Lm,
-	// normally we would use params[1024].LmCommit here. Generally LmCommit = Lm + Lh + Lstatzk,
-	// where Lstatzk is the level of security with which the proof hides the secret.
-	// However, params[1024].Lstatzk = 80 while everywhere else we use Lstatzk = 128.
-	// So instead of using params[1024].LmCommit we recompute it with the Lstatzk of keylength 2048.
-	randLength := gabikeys.DefaultSystemParameters[1024].Lm +
-		gabikeys.DefaultSystemParameters[1024].Lh +
-		gabikeys.DefaultSystemParameters[2048].Lstatzk
+	return NewKeyshareCommitmentsWithRand(nil, secret, keys)
+}
 
-	randomizer, err := common.RandomBigInt(randLength)
+// Generate commitments for the keyshare server for given set of keys, using the specified source
+// of randomness (crypto/rand if nil)
+func NewKeyshareCommitmentsWithRand(random io.Reader, secret *big.Int, keys []*gabikeys.PublicKey) (*big.Int, []*ProofPCommitment, error) {
+	return newKeyshareCommitments(random, 1, secret, keys)
+}
+
+// Generate commitments for one of the given amount of keyshare servers for given set of keys
+func NewMultiKeyshareCommitments(servers int, secret *big.Int, keys []*gabikeys.PublicKey) (*big.Int, []*ProofPCommitment, error) {
+	return NewMultiKeyshareCommitmentsWithRand(nil, servers, secret, keys)
+}
+
+// Generate commitments for one of the given amount of keyshare servers for given set of keys,
+// using the specified source of randomness (crypto/rand if nil)
+func NewMultiKeyshareCommitmentsWithRand(
+	random io.Reader, servers int, secret *big.Int, keys []*gabikeys.PublicKey,
+) (*big.Int, []*ProofPCommitment, error) {
+	return newKeyshareCommitments(random, servers, secret, keys)
+}
+
+func newKeyshareCommitments(
+	random io.Reader, servers int, secret *big.Int, keys []*gabikeys.PublicKey,
+) (*big.Int, []*ProofPCommitment, error) {
+	responseLength, err := keyshareResponseBitLen(servers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Generate randomizer value, 1 bit shorter than the response
+	randomizer, err := common.RandomBigIntFrom(random, responseLength-1)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -35,19 +97,154 @@ func NewKeyshareCommitments(secret *big.Int, keys []*gabikeys.PublicKey) (*big.I
 	for _, key := range keys {
 		exponentiatedCommitments = append(exponentiatedCommitments,
 			&ProofPCommitment{
-				P:       new(big.Int).Exp(key.R[0], secret, key.N),
-				Pcommit: new(big.Int).Exp(key.R[0], randomizer, key.N),
+				P:       key.ExpModN(key.R[0], secret),
+				Pcommit: key.ExpModN(key.R[0], randomizer),
 			})
 	}
 
 	return randomizer, exponentiatedCommitments, nil
 }
 
+// keyshareResponseBitLen returns the maximum bit length of the response of one of the given amount
+// of keyshare servers, its randomizer being 1 bit shorter.
+//
+// Given that with this zero knowledge proof we are hiding a secret of length params[1024].Lm,
+// normally we would use params[1024].LmCommit for the randomizer. Generally LmCommit = Lm + Lh +
+// Lstatzk, where Lstatzk is the level of security with which the proof hides the secret.
+// However, params[1024].Lstatzk = 80 while everywhere else we use Lstatzk = 128.
+// So instead of using params[1024].LmCommit we recompute it with the Lstatzk of keylength 2048.
+// When multiple keyshare servers merge their responses, their randomizers are added up. Each
+// of them is shrunk such that the sum does not exceed the size of a single randomizer by more
+// than 1 bit, trading a few bits of statistical hiding for that.
+func keyshareResponseBitLen(servers int) (uint, error) {
+	shrink, err := keyshareShrink(servers)
+	if err != nil {
+		return 0, err
+	}
+	return gabikeys.DefaultSystemParameters[1024].Lm +
+		gabikeys.DefaultSystemParameters[1024].Lh +
+		gabikeys.DefaultSystemParameters[2048].Lstatzk + 2 - shrink, nil
+}
+
 // Generate keyshare response for a given challenge and commit, given a secret
 func KeyshareResponse(secret, commit, challenge *big.Int, key *gabikeys.PublicKey) *ProofP {
 	return &ProofP{
-		P:         new(big.Int).Exp(key.R[0], secret, key.N),
+		P:         key.ExpModN(key.R[0], secret),
 		C:         new(big.Int).Set(challenge),
 		SResponse: new(big.Int).Add(commit, new(big.Int).Mul(challenge, secret)),
 	}
 }
+
+var (
+	// ErrKeyshareSessionExpired is returned when a KeyshareSession is used after it has expired.
+	ErrKeyshareSessionExpired = errors.New("keyshare session expired")
+	// ErrKeyshareCommitmentReused is returned when a KeyshareSession is asked to respond to a
+	// second challenge, which would leak the secret of the keyshare server.
+	ErrKeyshareCommitmentReused = errors.New("keyshare commitment already used for another challenge")
+)
+
+// KeyshareSession holds the state of a keyshare server during one run of the keyshare protocol,
+// i.e. its commitments for a set of keys and its response to one challenge. A session responds to
+// at most one challenge, as the responses to two different challenges using the same randomizer
+// would reveal the secret, and expires after the lifetime it was created with.
+type KeyshareSession struct {
+	secret      *big.Int
+	keys        []*gabikeys.PublicKey
+	randomizer  *big.Int
+	commitments []*ProofPCommitment
+	expiry      time.Time
+
+	mutex     sync.Mutex
+	challenge *big.Int
+	responses []*ProofP
+}
+
+// NewKeyshareSession creates a keyshare session committing to the secret for the given set of keys,
+// that expires after the specified lifetime.
+func NewKeyshareSession(secret *big.Int, keys []*gabikeys.PublicKey, lifetime time.Duration) (*KeyshareSession, error) {
+	return NewKeyshareSessionWithRand(nil, secret, keys, lifetime)
+}
+
+// NewKeyshareSessionWithRand creates a keyshare session like NewKeyshareSession(), using the
+// specified source of randomness (crypto/rand if nil).
+func NewKeyshareSessionWithRand(
+	random io.Reader, secret *big.Int, keys []*gabikeys.PublicKey, lifetime time.Duration,
+) (*KeyshareSession, error) {
+	return newKeyshareSession(random, 1, secret, keys, lifetime)
+}
+
+// NewMultiKeyshareSession creates a keyshare session like NewKeyshareSession() for one of the
+// given amount of keyshare servers that share the secret key with the client (c.f.
+// NewMultiKeyshareCommitments()).
+func NewMultiKeyshareSession(
+	servers int, secret *big.Int, keys []*gabikeys.PublicKey, lifetime time.Duration,
+) (*KeyshareSession, error) {
+	return NewMultiKeyshareSessionWithRand(nil, servers, secret, keys, lifetime)
+}
+
+// NewMultiKeyshareSessionWithRand creates a keyshare session like NewMultiKeyshareSession(), using
+// the specified source of randomness (crypto/rand if nil).
+func NewMultiKeyshareSessionWithRand(
+	random io.Reader, servers int, secret *big.Int, keys []*gabikeys.PublicKey, lifetime time.Duration,
+) (*KeyshareSession, error) {
+	return newKeyshareSession(random, servers, secret, keys, lifetime)
+}
+
+func newKeyshareSession(
+	random io.Reader, servers int, secret *big.Int, keys []*gabikeys.PublicKey, lifetime time.Duration,
+) (*KeyshareSession, error) {
+	randomizer, commitments, err := newKeyshareCommitments(random, servers, secret, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyshareSession{
+		secret:      secret,
+		keys:        keys,
+		randomizer:  randomizer,
+		commitments: commitments,
+		expiry:      time.Now().Add(lifetime),
+	}, nil
+}
+
+// Commitments returns the commitments of the session, one for each of its keys.
+func (s *KeyshareSession) Commitments() []*ProofPCommitment {
+	return s.commitments
+}
+
+// Expiry returns the time at which the session expires.
+func (s *KeyshareSession) Expiry() time.Time {
+	return s.expiry
+}
+
+// Expired returns whether the session has expired.
+func (s *KeyshareSession) Expired() bool {
+	return !time.Now().Before(s.expiry)
+}
+
+// Response returns the responses to the challenge, one for each of the keys of the session. If the
+// session has already responded to the same challenge, the same responses are returned again;
+// ErrKeyshareCommitmentReused is returned for any other challenge.
+func (s *KeyshareSession) Response(challenge *big.Int) ([]*ProofP, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.challenge != nil {
+		if s.challenge.Cmp(challenge) != 0 {
+			return nil, ErrKeyshareCommitmentReused
+		}
+		return s.responses, nil
+	}
+	if s.Expired() {
+		return nil, ErrKeyshareSessionExpired
+	}
+
+	s.challenge = new(big.Int).Set(challenge)
+	s.responses = make([]*ProofP, len(s.keys))
+	for i, key := range s.keys {
+		s.responses[i] = KeyshareResponse(s.secret, s.randomizer, s.challenge, key)
+		s.responses[i].Pcommit = s.commitments[i].Pcommit
+	}
+	// The randomizer is not needed anymore, so forget it along with the secret
+	s.randomizer, s.secret = nil, nil
+	return s.responses, nil
+}
@@ -0,0 +1,224 @@
+package gabi
+
+import (
+	"io"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+)
+
+// Proactive refresh of keyshare secrets.
+//
+// The secret key s of a client using a keyshare server is the sum s_user + s_server of the shares
+// of the client and the server. If the share of the server may have leaked, the client and server
+// can jointly shift their shares to s_user + δ and s_server − δ, after which the leaked share is
+// useless, without the credentials of the client having to be reissued:
+//
+//  1. The server keeps a random t_server of its share and shifts the rest s_server − t_server to
+//     the client (NewKeyshareServerShift()), while the client shifts a random t_client to the
+//     server (NewKeyshareClientShift()). Both send their shift to the other party.
+//  2. Both parties compute their refreshed share with RefreshKeyshareSecret(). The refreshed share
+//     t_server + t_client of the server is independent of its previous share, even if the latter
+//     or t_server leaked, and like the shares generated by NewKeyshareSecret() it is nonnegative
+//     and smaller than 2^(Lm-1). The refreshed share s - t_server - t_client of the client absorbs
+//     the difference, and may be negative.
+//  3. Both parties send a KeyshareRefreshProof to the other party, containing for each public key
+//     the commitments R_0^share to their share before and after the refresh, and a proof of
+//     knowledge of the latter. Each party verifies the proof of the other using its own share
+//     before and after the refresh, which checks that the refreshed shares are consistent with
+//     R_0^s, i.e. that their sum still equals the secret key.
+//  4. The client updates its credentials using Credential.RefreshKeyshare(), so that their
+//     signatures verify against the refreshed share of the server.
+
+var (
+	// ErrInconsistentKeyshareRefresh is returned when the refreshed shares of the secret key of the
+	// client and the keyshare server do not add up to the secret key.
+	ErrInconsistentKeyshareRefresh = errors.New("refreshed keyshare secrets inconsistent with secret key")
+	// ErrIncorrectKeyshareRefreshProof is returned when the proof of knowledge of a refreshed share
+	// of the secret key does not verify.
+	ErrIncorrectKeyshareRefreshProof = errors.New("proof of refreshed keyshare secret does not verify")
+)
+
+// KeyshareRefreshProof proves that the sender, being either the client or the keyshare server,
+// knows its refreshed share of the secret key, and commits to its shares before and after the
+// refresh. Index i of both slices concerns the i'th of the public keys for which it was created.
+type KeyshareRefreshProof struct {
+	P         []*big.Int `json:"P"`         // R_0^share before the refresh
+	Refreshed []*ProofP  `json:"refreshed"` // R_0^share after the refresh and its proof of knowledge
+}
+
+// Generate the amount that the keyshare server shifts from its share of the secret key to the
+// client, being all of its share except for a random remainder
+func NewKeyshareServerShift(share *big.Int) (*big.Int, error) {
+	return NewKeyshareServerShiftWithRand(nil, share)
+}
+
+// Generate the amount that the keyshare server shifts from its share of the secret key to the
+// client, using the specified source of randomness (crypto/rand if nil)
+func NewKeyshareServerShiftWithRand(random io.Reader, share *big.Int) (*big.Int, error) {
+	if share.Sign() < 0 {
+		return nil, errors.New("keyshare secret must not be negative")
+	}
+	remainder, err := newKeyshareRefreshRandom(random)
+	if err != nil {
+		return nil, err
+	}
+	return remainder.Sub(share, remainder), nil
+}
+
+// Generate the amount that the client shifts from its share of the secret key to the keyshare
+// server
+func NewKeyshareClientShift() (*big.Int, error) {
+	return NewKeyshareClientShiftWithRand(nil)
+}
+
+// Generate the amount that the client shifts from its share of the secret key to the keyshare
+// server, using the specified source of randomness (crypto/rand if nil)
+func NewKeyshareClientShiftWithRand(random io.Reader) (*big.Int, error) {
+	return newKeyshareRefreshRandom(random)
+}
+
+// newKeyshareRefreshRandom returns a random t_server or t_client, one bit shorter than the shares
+// generated by NewKeyshareSecret(), so that their sum is of the same size as those.
+func newKeyshareRefreshRandom(random io.Reader) (*big.Int, error) {
+	return common.RandomBigIntFrom(random, gabikeys.DefaultSystemParameters[1024].Lm-2)
+}
+
+// RefreshKeyshareSecret computes the refreshed share of a party of the secret key, given its
+// current share, the amount it shifts to the other party, and the amount shifted to it by the
+// other party.
+func RefreshKeyshareSecret(share, shift, received *big.Int) *big.Int {
+	refreshed := new(big.Int).Sub(share, shift)
+	return refreshed.Add(refreshed, received)
+}
+
+// NewKeyshareRefreshProof creates a proof of the refresh of the specified share of the secret key
+// for the given set of keys.
+func NewKeyshareRefreshProof(share, refreshed *big.Int, keys []*gabikeys.PublicKey) (*KeyshareRefreshProof, error) {
+	return NewKeyshareRefreshProofWithRand(nil, share, refreshed, keys)
+}
+
+// NewKeyshareRefreshProofWithRand creates a proof of the refresh of the specified share of the
+// secret key for the given set of keys, using the specified source of randomness (crypto/rand if
+// nil).
+func NewKeyshareRefreshProofWithRand(
+	random io.Reader, share, refreshed *big.Int, keys []*gabikeys.PublicKey,
+) (*KeyshareRefreshProof, error) {
+	// The refreshed share of the client may be negative, but both are smaller than 2^Lm in absolute value
+	if uint(refreshed.BitLen()) > gabikeys.DefaultSystemParameters[1024].Lm {
+		return nil, errors.New("refreshed keyshare secret out of range")
+	}
+
+	randomizer, commitments, err := NewKeyshareCommitmentsWithRand(random, refreshed, keys)
+	if err != nil {
+		return nil, err
+	}
+	proof := &KeyshareRefreshProof{
+		P:         make([]*big.Int, len(keys)),
+		Refreshed: make([]*ProofP, len(keys)),
+	}
+	refreshedPs := make([]*big.Int, len(keys))
+	pcommits := make([]*big.Int, len(keys))
+	for i, key := range keys {
+		proof.P[i] = key.ExpModN(key.R[0], share)
+		refreshedPs[i] = commitments[i].P
+		pcommits[i] = commitments[i].Pcommit
+	}
+
+	// As the randomizer is shared by all keys, so must the challenge be
+	challenge := keyshareRefreshChallenge(keys, proof.P, refreshedPs, pcommits)
+	for i, key := range keys {
+		proof.Refreshed[i] = KeyshareResponse(refreshed, randomizer, challenge, key)
+	}
+	return proof, nil
+}
+
+// Verify verifies the proof of the other party, given the share of the secret key of the verifier
+// before and after the refresh.
+func (p *KeyshareRefreshProof) Verify(keys []*gabikeys.PublicKey, share, refreshed *big.Int) error {
+	if len(p.P) != len(keys) || len(p.Refreshed) != len(keys) {
+		return errors.New("amount of public keys does not match refresh proof")
+	}
+
+	refreshedPs := make([]*big.Int, len(keys))
+	pcommits := make([]*big.Int, len(keys))
+	for i, key := range keys {
+		proofP := p.Refreshed[i]
+		if p.P[i] == nil || proofP == nil || proofP.P == nil || proofP.C == nil || proofP.SResponse == nil {
+			return errors.New("malformed refresh proof")
+		}
+		if proofP.C.Cmp(p.Refreshed[0].C) != 0 {
+			return ErrIncorrectKeyshareRefreshProof
+		}
+
+		// The shares of both parties should add up to the secret key s, before and after the refresh
+		joint := new(big.Int).Mul(p.P[i], key.ExpModN(key.R[0], share))
+		joint.Mod(joint, key.N)
+		refreshedJoint := new(big.Int).Mul(proofP.P, key.ExpModN(key.R[0], refreshed))
+		if refreshedJoint.Mod(refreshedJoint, key.N).Cmp(joint) != 0 {
+			return ErrInconsistentKeyshareRefresh
+		}
+
+		// Reconstruct Pcommit = R_0^SResponse * P^-C
+		pc, err := key.ModPow(proofP.P, new(big.Int).Neg(proofP.C))
+		if err != nil {
+			return err
+		}
+		refreshedPs[i] = proofP.P
+		pcommits[i] = pc.Mul(pc, key.ExpModN(key.R[0], proofP.SResponse)).Mod(pc, key.N)
+	}
+
+	if len(keys) > 0 && keyshareRefreshChallenge(keys, p.P, refreshedPs, pcommits).Cmp(p.Refreshed[0].C) != 0 {
+		return ErrIncorrectKeyshareRefreshProof
+	}
+	return nil
+}
+
+// keyshareRefreshChallenge computes the challenge of the proof of knowledge of the refreshed share,
+// given per key the commitments to the share before and after the refresh and the commitment to
+// the randomizer.
+func keyshareRefreshChallenge(keys []*gabikeys.PublicKey, previous, refreshed, pcommits []*big.Int) *big.Int {
+	values := make([]*big.Int, 0, 4*len(keys))
+	for i, key := range keys {
+		values = append(values, key.R[0], previous[i], refreshed[i], pcommits[i])
+	}
+	return common.HashCommit(values, false)
+}
+
+// RefreshKeyshareP updates KeyshareP after the keyshare server has refreshed its share of the
+// secret key, given the commitments R_0^share to the share of the server before and after the
+// refresh (c.f. KeyshareRefreshProof). If the secret key is shared with multiple keyshare servers,
+// only the contribution of the refreshing server is replaced.
+func (s *CLSignature) RefreshKeyshareP(pk *gabikeys.PublicKey, previous, refreshed *big.Int) error {
+	if s.KeyshareP == nil {
+		return errors.New("signature has no keyshare server")
+	}
+	inverse, ok := common.ModInverse(previous, pk.N)
+	if !ok {
+		return common.ErrNoModInverse
+	}
+	keyshareP := new(big.Int).Mul(s.KeyshareP, inverse)
+	keyshareP.Mul(keyshareP, refreshed).Mod(keyshareP, pk.N)
+	s.KeyshareP = keyshareP
+	return nil
+}
+
+// RefreshKeyshare updates the credential after the client and the keyshare server have refreshed
+// their shares of the secret key, given the refreshed share of the client and the commitments
+// R_0^share to the share of the server before and after the refresh. The credential is left
+// untouched if its signature does not verify afterwards.
+func (ic *Credential) RefreshKeyshare(refreshedSecret, previousP, refreshedP *big.Int) error {
+	signature := &CLSignature{A: ic.Signature.A, E: ic.Signature.E, V: ic.Signature.V, KeyshareP: ic.Signature.KeyshareP}
+	if err := signature.RefreshKeyshareP(ic.Pk, previousP, refreshedP); err != nil {
+		return err
+	}
+	attributes := append([]*big.Int{refreshedSecret}, ic.Attributes[1:]...)
+	if !signature.Verify(ic.Pk, attributes) {
+		return ErrInconsistentKeyshareRefresh
+	}
+	ic.Signature.KeyshareP = signature.KeyshareP
+	ic.Attributes[0] = refreshedSecret
+	return nil
+}
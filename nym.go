@@ -0,0 +1,183 @@
+package gabi
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+)
+
+// nymGroupPrime is the 2048-bit MODP group prime from RFC 3526, which is a safe prime p = 2q+1.
+// Domain pseudonyms live in its subgroup of quadratic residues, which has prime order q.
+var nymGroupPrime, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510"+
+		"15728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+
+// nymParams are the system parameters determining the size of the secret key (response).
+var nymParams = gabikeys.DefaultSystemParameters[1024]
+
+// ScopeGenerator deterministically derives the generator g_scope of the domain pseudonym group
+// for the specified scope, by hashing the scope into the group.
+func ScopeGenerator(scope string) (*big.Int, error) {
+	if scope == "" {
+		return nil, errors.New("scope must not be empty")
+	}
+	h := common.GetHashNumber(common.IntHashSha256([]byte(scope)), nil, 0, uint(nymGroupPrime.BitLen())+128)
+	return nymGroupElement(h)
+}
+
+// nymGroupElement maps the hash into the subgroup of quadratic residues, returning an error if it
+// does not map to a generator.
+func nymGroupElement(h *big.Int) (*big.Int, error) {
+	h.Mod(h, nymGroupPrime)
+	g := h.Exp(h, big.NewInt(2), nymGroupPrime)
+	if g.Cmp(big.NewInt(1)) <= 0 {
+		return nil, errors.New("scope does not map to a generator")
+	}
+	return g, nil
+}
+
+// inNymGroup reports whether x is an element of the subgroup of quadratic residues other than 1.
+func inNymGroup(x *big.Int) bool {
+	return x.Cmp(big.NewInt(1)) > 0 && x.Cmp(nymGroupPrime) < 0 && big.Jacobi(x, nymGroupPrime) == 1
+}
+
+// DomainPseudonymBuilder is a ProofBuilder producing a domain pseudonym nym = g_scope^secretkey,
+// along with a proof that its exponent is the secret key of the other proofs in the
+// ProofBuilderList. For a given secret key and scope the pseudonym is always the same, while
+// pseudonyms for distinct scopes are unlinkable.
+//
+// The pseudonym is not bound to an issuer public key, so PublicKey() returns nil; verifiers should
+// also pass nil as the public key of the resulting ProofNym to ProofList.Verify(). Domain
+// pseudonyms of secret keys that are shared with a keyshare server are not supported.
+type DomainPseudonymBuilder struct {
+	scope      string
+	generator  *big.Int
+	secret     *big.Int
+	randomizer *big.Int
+	nym        *big.Int
+}
+
+// ProofNym represents a domain pseudonym with a proof of knowledge of its exponent.
+type ProofNym struct {
+	Scope     string   `json:"scope"`
+	Nym       *big.Int `json:"nym"`
+	C         *big.Int `json:"c"`
+	SResponse *big.Int `json:"s_response"`
+}
+
+// NewDomainPseudonymBuilder creates a builder for the domain pseudonym of the specified secret key
+// within the specified scope.
+func NewDomainPseudonymBuilder(scope string, secret *big.Int) (*DomainPseudonymBuilder, error) {
+	generator, err := ScopeGenerator(scope)
+	if err != nil {
+		return nil, err
+	}
+	return &DomainPseudonymBuilder{
+		scope:     scope,
+		generator: generator,
+		secret:    secret,
+		nym:       new(big.Int).Exp(generator, secret, nymGroupPrime),
+	}, nil
+}
+
+// Nym returns the domain pseudonym.
+func (b *DomainPseudonymBuilder) Nym() *big.Int {
+	return new(big.Int).Set(b.nym)
+}
+
+// Commit commits to the secret key using the provided randomizer.
+func (b *DomainPseudonymBuilder) Commit(randomizers map[string]*big.Int) ([]*big.Int, error) {
+	b.randomizer = randomizers["secretkey"]
+	if b.randomizer == nil {
+		return nil, errors.New("no secret key randomizer")
+	}
+	return []*big.Int{
+		b.generator,
+		b.nym,
+		new(big.Int).Exp(b.generator, b.randomizer, nymGroupPrime),
+	}, nil
+}
+
+// CreateProof creates a domain pseudonym proof with the provided challenge.
+func (b *DomainPseudonymBuilder) CreateProof(challenge *big.Int) Proof {
+	response := new(big.Int).Mul(challenge, b.secret)
+	return &ProofNym{
+		Scope:     b.scope,
+		Nym:       new(big.Int).Set(b.nym),
+		C:         new(big.Int).Set(challenge),
+		SResponse: response.Add(b.randomizer, response),
+	}
+}
+
+// PublicKey returns nil, as domain pseudonyms are not bound to an issuer public key.
+func (b *DomainPseudonymBuilder) PublicKey() *gabikeys.PublicKey {
+	return nil
+}
+
+// MergeProofPCommitment does nothing, as domain pseudonyms do not support keyshare servers.
+func (b *DomainPseudonymBuilder) MergeProofPCommitment(*ProofPCommitment) {}
+
+// Verify verifies the proof against the given context and nonce.
+func (p *ProofNym) Verify(context, nonce *big.Int, issig bool) bool {
+	contrib, err := p.ChallengeContribution(nil)
+	if err != nil {
+		return false
+	}
+	return p.VerifyWithChallenge(nil, createChallenge(context, nonce, contrib, issig))
+}
+
+// VerifyWithChallenge verifies whether the proof is correct. The public key is ignored.
+func (p *ProofNym) VerifyWithChallenge(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) bool {
+	return p.verifyWithChallenge(pk, reconstructedChallenge) == nil
+}
+
+func (p *ProofNym) verifyWithChallenge(_ *gabikeys.PublicKey, reconstructedChallenge *big.Int) error {
+	if p.C == nil || p.SResponse == nil {
+		return verificationError(ErrMalformedProof, errors.New("incomplete domain pseudonym proof"))
+	}
+	if p.SResponse.Sign() < 0 || uint(p.SResponse.BitLen()) > nymParams.LmCommit+1 {
+		return verificationError(ErrResponseSize, nil)
+	}
+	if p.C.Cmp(reconstructedChallenge) != 0 {
+		return verificationError(ErrChallenge, nil)
+	}
+	return nil
+}
+
+// ChallengeContribution returns the contribution of this proof to the challenge. The public key
+// is ignored.
+func (p *ProofNym) ChallengeContribution(_ *gabikeys.PublicKey) ([]*big.Int, error) {
+	if p.Nym == nil || p.C == nil || p.SResponse == nil {
+		return nil, errors.New("incomplete domain pseudonym proof")
+	}
+	if !inNymGroup(p.Nym) {
+		return nil, errors.New("domain pseudonym not in group")
+	}
+	generator, err := ScopeGenerator(p.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// commit = g_scope^s * nym^-c
+	nymc := new(big.Int).Exp(p.Nym, p.C, nymGroupPrime)
+	if nymc.ModInverse(nymc, nymGroupPrime) == nil {
+		return nil, common.ErrNoModInverse
+	}
+	commit := new(big.Int).Exp(generator, p.SResponse, nymGroupPrime)
+	commit.Mul(commit, nymc).Mod(commit, nymGroupPrime)
+
+	return []*big.Int{generator, p.Nym, commit}, nil
+}
+
+// SecretKeyResponse returns the secret key response (as part of Proof interface).
+func (p *ProofNym) SecretKeyResponse() *big.Int {
+	return p.SResponse
+}
+
+// MergeProofP does nothing, as domain pseudonyms do not support keyshare servers.
+func (p *ProofNym) MergeProofP(*ProofP, *gabikeys.PublicKey) {}
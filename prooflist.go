@@ -5,6 +5,13 @@
 package gabi
 
 import (
+	stdcontext "context"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
 	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/gabi/gabikeys"
@@ -26,6 +33,59 @@ type ProofList []Proof
 // ProofBuilderList is a list of proof builders, for calculating a list of bound proofs.
 type ProofBuilderList []ProofBuilder
 
+type (
+	// AttributeRef refers to an undisclosed attribute in one of the proofs of a ProofList.
+	AttributeRef struct {
+		Proof     int `json:"proof"`
+		Attribute int `json:"attribute"`
+	}
+
+	// AttributeLinks specifies per link name the attributes that should be proven to be equal. Each
+	// link must relate at least two attributes.
+	AttributeLinks map[string][]AttributeRef
+)
+
+// attributeLinker is implemented by proof builders that can link some of their attributes
+// to attributes of other builders, by sharing their randomizers.
+type attributeLinker interface {
+	linkedAttributes() map[int]string
+}
+
+// attributeResponder is implemented by proofs containing responses for undisclosed attributes.
+type attributeResponder interface {
+	attributeResponse(index int) *big.Int
+}
+
+// crossAttributeResolver is implemented by proof builders whose statements may relate to
+// attributes of other builders.
+type crossAttributeResolver interface {
+	resolveCrossAttributes(builders ProofBuilderList, randomizers map[string]*big.Int) error
+}
+
+// crossResponseUser is implemented by proofs whose statements may relate to attributes of other
+// proofs, which need the responses of those attributes for verification.
+type crossResponseUser interface {
+	setCrossResponses(pl ProofList) error
+}
+
+// detailedVerifier is implemented by proofs that can report which check of VerifyWithChallenge()
+// fails.
+type detailedVerifier interface {
+	verifyWithChallenge(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) error
+}
+
+// randomSourcer is implemented by proof builders that may have been created with a custom source
+// of randomness, from which the randomizers shared between the builders are then also read.
+type randomSourcer interface {
+	randomSource() io.Reader
+}
+
+// secretKeyless is implemented by proofs that do not involve the secret key, which are
+// therefore excluded from the check that the proofs share the same secret key.
+type secretKeyless interface {
+	withoutSecretKey()
+}
+
 var (
 	// ErrMissingProofU is returned when a ProofU proof is missing in a prooflist
 	// when this is expected.
@@ -53,44 +113,182 @@ func (pl ProofList) GetFirstProofU() (*ProofU, error) {
 }
 
 // challengeContributions collects and returns all the challenge contributions
-// of the proofs contained in the proof list.
-func (pl ProofList) challengeContributions(publicKeys []*gabikeys.PublicKey, context, nonce *big.Int) ([]*big.Int, error) {
-	contributions := make([]*big.Int, 0, len(pl)*2)
+// of the proofs contained in the proof list, using at most the specified amount of concurrent
+// workers. If batch is not nil, the commitments of ProofDs that include them are taken from the
+// proofs and added to batch to be checked later; in that case the contributions are computed
+// sequentially.
+func (pl ProofList) challengeContributions(
+	ctx stdcontext.Context, workers int, publicKeys []*gabikeys.PublicKey, batch batchEquations,
+) ([]*big.Int, error) {
 	for i, proof := range pl {
-		contrib, err := proof.ChallengeContribution(publicKeys[i])
-		if err != nil {
-			return nil, err
+		if user, ok := proof.(crossResponseUser); ok {
+			if err := user.setCrossResponses(pl); err != nil {
+				return nil, atProof(i, err)
+			}
+		}
+	}
+
+	results := make([][]*big.Int, len(pl))
+	contribute := func(i int) (err error) {
+		if proofd, ok := pl[i].(*ProofD); ok && batch != nil {
+			results[i], err = proofd.batchChallengeContribution(publicKeys[i], batch)
+		} else {
+			results[i], err = pl[i].ChallengeContribution(publicKeys[i])
+		}
+		return atProof(i, err)
+	}
+
+	var err error
+	if workers == 1 || batch != nil || len(pl) == 1 {
+		for i := range pl {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if err = contribute(i); err != nil {
+				break
+			}
 		}
+	} else {
+		err = parallelize(ctx, workers, len(pl), contribute)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contributions := make([]*big.Int, 0, len(pl)*2)
+	for _, contrib := range results {
 		contributions = append(contributions, contrib...)
 	}
 	return contributions, nil
 }
 
+// parallelize calls f(i) for i = 0, ..., count-1 using at most the specified amount of concurrent
+// workers (or GOMAXPROCS workers if it is not positive). No further calls are started once a call
+// has returned an error or the context is done; the first such error is returned.
+func parallelize(ctx stdcontext.Context, workers, count int, f func(i int) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > count {
+		workers = count
+	}
+	ctx, cancel := stdcontext.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		indices  = make(chan int)
+	)
+	fail := func(err error) {
+		once.Do(func() { firstErr = err })
+		cancel()
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if err := f(i); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < count; i++ {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
 // Verify returns true when all the proofs inside verify.
 // The keyshareServers parameter is used to indicate which proofs should be
 // verified to share the same secret key: when two proofs share the same keyshare
 // server (or none), so that they should have the same secret key, they should have
 // identical entries (index-wise) in keyshareServers. Pass nil if all proofs should have
 // the same secret key (i.e. it should be verified that all proofs use either none,
-// or one and the same keyshare server).
+// or one and the same keyshare server). If the secret key of a proof is shared with multiple
+// keyshare servers, its entry should list all of them separated by commas, in any order.
 // An empty ProofList is not considered valid.
 func (pl ProofList) Verify(publicKeys []*gabikeys.PublicKey, context, nonce *big.Int, issig bool, keyshareServers []string) bool {
-	if len(pl) == 0 ||
-		len(pl) != len(publicKeys) ||
-		len(keyshareServers) > 0 && len(pl) != len(keyshareServers) {
-		return false
+	return pl.VerifyWithLinks(publicKeys, context, nonce, issig, keyshareServers, nil)
+}
+
+// VerifyWithLinks returns true when all the proofs inside verify (see Verify), and if for each
+// link in links, all attributes referred to by the link are equal
+// (c.f. DisclosureProofBuilder.LinkAttribute()).
+func (pl ProofList) VerifyWithLinks(
+	publicKeys []*gabikeys.PublicKey, context, nonce *big.Int, issig bool, keyshareServers []string, links AttributeLinks,
+) bool {
+	return pl.VerifyDetailed(publicKeys, context, nonce, issig, keyshareServers, links) == nil
+}
+
+// VerifyDetailed verifies the proofs like VerifyWithLinks, returning a *VerificationError
+// describing the failed check and the index of the invalid proof, if any, if they do not verify.
+func (pl ProofList) VerifyDetailed(
+	publicKeys []*gabikeys.PublicKey, context, nonce *big.Int, issig bool, keyshareServers []string, links AttributeLinks,
+) error {
+	return pl.verify(stdcontext.Background(), 1, publicKeys, context, nonce, issig, keyshareServers, links, nil)
+}
+
+// VerifyParallel returns the same result as VerifyWithLinks, but computes the challenge
+// contributions of the proofs concurrently, using at most the specified amount of workers (or
+// GOMAXPROCS workers if it is not positive). It stops as soon as a proof is found to be invalid,
+// or when ctx is done, in which case ctx.Err() is returned. Contributions that are being computed
+// when ctx is done are not interrupted.
+func (pl ProofList) VerifyParallel(
+	ctx stdcontext.Context, workers int,
+	publicKeys []*gabikeys.PublicKey, context, nonce *big.Int, issig bool, keyshareServers []string, links AttributeLinks,
+) (bool, error) {
+	err := pl.verify(ctx, workers, publicKeys, context, nonce, issig, keyshareServers, links, nil)
+	if _, invalid := err.(*VerificationError); invalid {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// verify implements VerifyDetailed() and VerifyParallel(), returning either a *VerificationError
+// or ctx.Err(). If batch is not nil, the commitments of ProofDs that include them are not
+// reconstructed but added to batch, in which case the proofs are only valid if batch.verify()
+// succeeds afterwards.
+func (pl ProofList) verify(
+	ctx stdcontext.Context, workers int,
+	publicKeys []*gabikeys.PublicKey, context, nonce *big.Int, issig bool, keyshareServers []string, links AttributeLinks,
+	batch batchEquations,
+) error {
+	if len(pl) == 0 {
+		return verificationError(ErrEmptyProofList, nil)
+	}
+	if len(pl) != len(publicKeys) || len(keyshareServers) > 0 && len(pl) != len(keyshareServers) {
+		return verificationError(ErrPublicKeyMismatch, nil)
 	}
 
 	// If the secret key comes from a credential whose scheme manager has a keyshare server,
 	// then the secretkey = userpart + keysharepart.
 	// So, we can only expect two secret key responses to be equal if their credentials
-	// are both associated to either no keyshare server, or the same keyshare server.
+	// are both associated to either no keyshare server, or the same (set of) keyshare server(s).
 	// During verification of the proofs we keep track of their secret key responses in this map.
 	secretkeyResponses := make(map[string]*big.Int)
 
-	contributions, err := pl.challengeContributions(publicKeys, context, nonce)
+	contributions, err := pl.challengeContributions(ctx, workers, publicKeys, batch)
 	if err != nil {
-		return false
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
 	}
 	expectedChallenge := createChallenge(context, nonce, contributions, issig)
 
@@ -99,11 +297,14 @@ func (pl ProofList) Verify(publicKeys []*gabikeys.PublicKey, context, nonce *big
 	kss := ""
 
 	for i, proof := range pl {
-		if !proof.VerifyWithChallenge(publicKeys[i], expectedChallenge) {
-			return false
+		if err = verifyWithChallenge(proof, publicKeys[i], expectedChallenge); err != nil {
+			return atProof(i, err)
+		}
+		if _, ok := proof.(secretKeyless); ok {
+			continue
 		}
 		if len(keyshareServers) > 0 {
-			kss = keyshareServers[i]
+			kss = keyshareServerSet(keyshareServers[i])
 		}
 		if response, contains := secretkeyResponses[kss]; !contains {
 			// First time we see this keyshare server
@@ -111,27 +312,102 @@ func (pl ProofList) Verify(publicKeys []*gabikeys.PublicKey, context, nonce *big
 		} else {
 			// We've already seen this keyshare server, secret key response should match earlier one
 			if response.Cmp(proof.SecretKeyResponse()) != 0 {
-				return false
+				return &VerificationError{Proof: i, Check: ErrSecretKeyMismatch}
 			}
 		}
 	}
 
-	return true
+	return pl.verifyLinks(links)
+}
+
+// keyshareServerSet normalizes an entry of the keyshareServers parameter of ProofList.Verify(),
+// so that it does not depend on the order in which multiple keyshare servers are listed.
+func keyshareServerSet(servers string) string {
+	if !strings.Contains(servers, ",") {
+		return servers
+	}
+	names := strings.Split(servers, ",")
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// verifyWithChallenge verifies the proof against the reconstructed challenge, returning a
+// *VerificationError if it is invalid.
+func verifyWithChallenge(proof Proof, pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) error {
+	if verifier, ok := proof.(detailedVerifier); ok {
+		return verifier.verifyWithChallenge(pk, reconstructedChallenge)
+	}
+	if !proof.VerifyWithChallenge(pk, reconstructedChallenge) {
+		return verificationError(ErrChallenge, nil)
+	}
+	return nil
+}
+
+// verifyLinks checks that the responses of all attributes within each link are equal. Since the
+// attributes of a link share their randomizer, this implies that the attributes are equal.
+func (pl ProofList) verifyLinks(links AttributeLinks) error {
+	for name, refs := range links {
+		if len(refs) < 2 {
+			return verificationError(ErrAttributeLink, errors.Errorf("link %s relates fewer than two attributes", name))
+		}
+		var expected *big.Int
+		for _, ref := range refs {
+			if ref.Proof < 0 || ref.Proof >= len(pl) {
+				return verificationError(ErrAttributeLink, errors.Errorf("link %s relates to nonexisting proof", name))
+			}
+			proof, ok := pl[ref.Proof].(attributeResponder)
+			if !ok {
+				return verificationError(ErrAttributeLink, errors.Errorf("link %s relates to proof without attributes", name))
+			}
+			response := proof.attributeResponse(ref.Attribute)
+			if response == nil {
+				return verificationError(ErrAttributeLink, errors.Errorf("link %s relates to disclosed or nonexisting attribute", name))
+			}
+			if expected == nil {
+				expected = response
+			} else if expected.Cmp(response) != 0 {
+				return verificationError(ErrAttributeLink, errors.Errorf("attributes of link %s differ", name))
+			}
+		}
+	}
+	return nil
 }
 
 func (builders ProofBuilderList) Challenge(context, nonce *big.Int, issig bool) (*big.Int, error) {
+	return builders.challenge(stdcontext.Background(), context, nonce, issig)
+}
+
+// challenge computes the challenge like Challenge(), returning ctx.Err() if ctx is done before
+// all builders have committed.
+func (builders ProofBuilderList) challenge(ctx stdcontext.Context, context, nonce *big.Int, issig bool) (*big.Int, error) {
 	// The secret key may be used across credentials supporting different attribute sizes.
 	// So we should take it, and hence also its commitment, to fit within the smallest size -
 	// otherwise it will be too big so that we cannot perform the range proof showing
 	// that it is not too big.
-	skCommitment, err := common.RandomBigInt(gabikeys.DefaultSystemParameters[1024].LmCommit)
+	random := builders.randomSource()
+	skCommitment, err := common.RandomBigIntFrom(random, gabikeys.DefaultSystemParameters[1024].LmCommit)
 	if err != nil {
 		return nil, err
 	}
 
+	randomizers := map[string]*big.Int{"secretkey": skCommitment}
+	if err = builders.linkRandomizers(random, randomizers); err != nil {
+		return nil, err
+	}
+	for _, pb := range builders {
+		if resolver, ok := pb.(crossAttributeResolver); ok {
+			if err = resolver.resolveCrossAttributes(builders, randomizers); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	commitmentValues := make([]*big.Int, 0, len(builders)*2)
 	for _, pb := range builders {
-		contributions, err := pb.Commit(map[string]*big.Int{"secretkey": skCommitment})
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		contributions, err := pb.Commit(randomizers)
 		if err != nil {
 			return nil, err
 		}
@@ -142,19 +418,97 @@ func (builders ProofBuilderList) Challenge(context, nonce *big.Int, issig bool)
 	return createChallenge(context, nonce, commitmentValues, issig), nil
 }
 
+// linkRandomizers adds a randomizer to the specified map for each attribute link declared
+// by the builders. As with the secret key, the randomizer is taken to fit within the smallest
+// attribute size of the public keys of the builders participating in the link.
+func (builders ProofBuilderList) linkRandomizers(random io.Reader, randomizers map[string]*big.Int) error {
+	sizes := make(map[string]uint)
+	for _, pb := range builders {
+		linker, ok := pb.(attributeLinker)
+		if !ok {
+			continue
+		}
+		size := pb.PublicKey().Params.LmCommit
+		for _, name := range linker.linkedAttributes() {
+			if current, seen := sizes[name]; !seen || size < current {
+				sizes[name] = size
+			}
+		}
+	}
+
+	// Iterate over the names in a fixed order, so that the randomizers only depend on the source
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var err error
+	for _, name := range names {
+		if randomizers[name], err = common.RandomBigIntFrom(random, sizes[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// randomSource returns the source of randomness of the first builder having a custom one, or nil
+// if there is none.
+func (builders ProofBuilderList) randomSource() io.Reader {
+	for _, pb := range builders {
+		if sourcer, ok := pb.(randomSourcer); ok {
+			if random := sourcer.randomSource(); random != nil {
+				return random
+			}
+		}
+	}
+	return nil
+}
+
 func (builders ProofBuilderList) BuildDistributedProofList(
 	challenge *big.Int, proofPs []*ProofP,
 ) (ProofList, error) {
 	if proofPs != nil && len(builders) != len(proofPs) {
 		return nil, errors.New("Not enough ProofP's given")
 	}
+	var merged [][]*ProofP
+	if proofPs != nil {
+		merged = make([][]*ProofP, len(proofPs))
+		for i, proofP := range proofPs {
+			merged[i] = []*ProofP{proofP}
+		}
+	}
+	return builders.buildDistributedProofList(stdcontext.Background(), challenge, merged)
+}
+
+// BuildMultiDistributedProofList is like BuildDistributedProofList, for secret keys that are
+// shared among the user and multiple keyshare servers: proofPs[i] contains the ProofP's of all
+// keyshare servers for the i'th builder, all of which are merged into its proof.
+func (builders ProofBuilderList) BuildMultiDistributedProofList(
+	challenge *big.Int, proofPs [][]*ProofP,
+) (ProofList, error) {
+	if proofPs != nil && len(builders) != len(proofPs) {
+		return nil, errors.New("Not enough ProofP's given")
+	}
+	return builders.buildDistributedProofList(stdcontext.Background(), challenge, proofPs)
+}
 
+func (builders ProofBuilderList) buildDistributedProofList(
+	ctx stdcontext.Context, challenge *big.Int, proofPs [][]*ProofP,
+) (ProofList, error) {
 	proofs := make([]Proof, len(builders))
 	// Now create proofs using this challenge
 	for i, v := range builders {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		proofs[i] = v.CreateProof(challenge)
-		if proofPs != nil && proofPs[i] != nil {
-			proofs[i].MergeProofP(proofPs[i], v.PublicKey())
+		if proofPs == nil {
+			continue
+		}
+		for _, proofP := range proofPs[i] {
+			if proofP != nil {
+				proofs[i].MergeProofP(proofP, v.PublicKey())
+			}
 		}
 	}
 	return proofs, nil
@@ -164,11 +518,17 @@ func (builders ProofBuilderList) BuildDistributedProofList(
 // of ProofBuilders. Examples of proof builders are CredentialBuilder and
 // DisclosureProofBuilder.
 func (builders ProofBuilderList) BuildProofList(context, nonce *big.Int, issig bool) (ProofList, error) {
-	challenge, err := builders.Challenge(context, nonce, issig)
+	return builders.BuildProofListContext(stdcontext.Background(), context, nonce, issig)
+}
+
+// BuildProofListContext builds a list of bounded proofs like BuildProofList(). If ctx is done
+// before all proofs have been built, ctx.Err() is returned.
+func (builders ProofBuilderList) BuildProofListContext(ctx stdcontext.Context, context, nonce *big.Int, issig bool) (ProofList, error) {
+	challenge, err := builders.challenge(ctx, context, nonce, issig)
 	if err != nil {
 		return nil, err
 	}
-	list, err := builders.BuildDistributedProofList(challenge, nil)
+	list, err := builders.buildDistributedProofList(ctx, challenge, nil)
 	if err != nil {
 		return nil, err
 	}
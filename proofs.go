@@ -10,6 +10,7 @@ import (
 	"github.com/privacybydesign/gabi/internal/common"
 	"github.com/privacybydesign/gabi/rangeproof"
 	"github.com/privacybydesign/gabi/revocation"
+	"github.com/privacybydesign/gabi/setmembership"
 
 	"github.com/go-errors/errors"
 )
@@ -41,6 +42,12 @@ type ProofU struct {
 	VPrimeResponse *big.Int         `json:"v_prime_response"`
 	SResponse      *big.Int         `json:"s_response"`
 	MUserResponses map[int]*big.Int `json:"m_user_responses,omitempty"`
+
+	// CarriedAttributes refers per attribute index to the attribute of a ProofD in the same
+	// ProofList that is carried over, hidden, into U (see CredentialBuilder.CarryOverAttribute()).
+	CarriedAttributes map[int]AttributeRef `json:"carried_attributes,omitempty"`
+
+	carriedResponses map[int]*big.Int
 }
 
 func (p *ProofU) MergeProofP(proofP *ProofP, pk *gabikeys.PublicKey) {
@@ -53,11 +60,17 @@ func (p *ProofU) MergeProofP(proofP *ProofP, pk *gabikeys.PublicKey) {
 
 // Verify verifies whether the proof is correct.
 func (p *ProofU) Verify(pk *gabikeys.PublicKey, context, nonce *big.Int) bool {
+	return p.VerifyDetailed(pk, context, nonce) == nil
+}
+
+// VerifyDetailed verifies the proof like Verify(), returning a *VerificationError describing
+// the failed check if the proof is invalid.
+func (p *ProofU) VerifyDetailed(pk *gabikeys.PublicKey, context, nonce *big.Int) error {
 	contrib, err := p.ChallengeContribution(pk)
 	if err != nil {
-		return false
+		return asVerificationError(err)
 	}
-	return p.VerifyWithChallenge(pk, createChallenge(context, nonce, contrib, false))
+	return p.verifyWithChallenge(pk, createChallenge(context, nonce, contrib, false))
 }
 
 // correctResponseSizes checks the sizes of the elements in the ProofU proof.
@@ -71,7 +84,17 @@ func (p *ProofU) correctResponseSizes(pk *gabikeys.PublicKey) bool {
 
 // VerifyWithChallenge verifies whether the proof is correct.
 func (p *ProofU) VerifyWithChallenge(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) bool {
-	return p.correctResponseSizes(pk) && p.C.Cmp(reconstructedChallenge) == 0
+	return p.verifyWithChallenge(pk, reconstructedChallenge) == nil
+}
+
+func (p *ProofU) verifyWithChallenge(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) error {
+	if !p.correctResponseSizes(pk) {
+		return verificationError(ErrResponseSize, nil)
+	}
+	if p.C.Cmp(reconstructedChallenge) != 0 {
+		return verificationError(ErrChallenge, nil)
+	}
+	return nil
 }
 
 // reconstructUcommit reconstructs U from the information in the proof and the
@@ -83,11 +106,11 @@ func (p *ProofU) reconstructUcommit(pk *gabikeys.PublicKey) (*big.Int, error) {
 	if err != nil {
 		return nil, err
 	}
-	Sv, err := common.ModPow(pk.S, p.VPrimeResponse, pk.N)
+	Sv, err := pk.ModPow(pk.S, p.VPrimeResponse)
 	if err != nil {
 		return nil, err
 	}
-	R0s, err := common.ModPow(pk.R[0], p.SResponse, pk.N)
+	R0s, err := pk.ModPow(pk.R[0], p.SResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +118,24 @@ func (p *ProofU) reconstructUcommit(pk *gabikeys.PublicKey) (*big.Int, error) {
 	Ucommit.Mul(Ucommit, R0s).Mod(Ucommit, pk.N)
 
 	for i, miUserResponse := range p.MUserResponses {
-		Rimi, err := common.ModPow(pk.R[i], miUserResponse, pk.N)
+		Rimi, err := pk.ModPow(pk.R[i], miUserResponse)
+		if err != nil {
+			return nil, err
+		}
+		Ucommit.Mul(Ucommit, Rimi).Mod(Ucommit, pk.N)
+	}
+
+	// Carried over attributes use the responses of the attributes in their ProofD, which are set
+	// by ProofList.Verify()
+	for i := range p.CarriedAttributes {
+		if i <= 0 || i >= len(pk.R) || p.MUserResponses[i] != nil {
+			return nil, errors.New("invalid carried over attribute index")
+		}
+		response := p.carriedResponses[i]
+		if response == nil {
+			return nil, errors.New("carried over attributes require ProofList verification")
+		}
+		Rimi, err := pk.ModPow(pk.R[i], response)
 		if err != nil {
 			return nil, err
 		}
@@ -126,6 +166,26 @@ func (p *ProofU) ChallengeContribution(pk *gabikeys.PublicKey) ([]*big.Int, erro
 	return []*big.Int{p.U, Ucommit}, nil
 }
 
+// setCrossResponses looks up the responses of the carried over attributes in the ProofDs they
+// refer to.
+func (p *ProofU) setCrossResponses(pl ProofList) error {
+	if len(p.CarriedAttributes) == 0 {
+		return nil
+	}
+	p.carriedResponses = make(map[int]*big.Int, len(p.CarriedAttributes))
+	for i, ref := range p.CarriedAttributes {
+		if ref.Proof < 0 || ref.Proof >= len(pl) {
+			return errors.New("carried over attribute relates to nonexisting proof")
+		}
+		other, ok := pl[ref.Proof].(*ProofD)
+		if !ok || ref.Attribute == 0 || other.attributeResponse(ref.Attribute) == nil {
+			return errors.New("carried over attribute relates to disclosed or nonexisting attribute")
+		}
+		p.carriedResponses[i] = new(big.Int).Set(other.attributeResponse(ref.Attribute))
+	}
+	return nil
+}
+
 // ProofS represents a proof.
 type ProofS struct {
 	C         *big.Int `json:"c"`
@@ -135,6 +195,12 @@ type ProofS struct {
 // Verify verifies the proof agains the given public key, signature, context,
 // and nonce.
 func (p *ProofS) Verify(pk *gabikeys.PublicKey, signature *CLSignature, context, nonce *big.Int) bool {
+	return p.VerifyDetailed(pk, signature, context, nonce) == nil
+}
+
+// VerifyDetailed verifies the proof like Verify(), returning a *VerificationError describing
+// the failed check if the proof is invalid.
+func (p *ProofS) VerifyDetailed(pk *gabikeys.PublicKey, signature *CLSignature, context, nonce *big.Int) error {
 	// Reconstruct A_commit
 	// ACommit = A^{C + EResponse * e}
 	exponent := new(big.Int).Mul(p.EResponse, signature.E)
@@ -147,21 +213,33 @@ func (p *ProofS) Verify(pk *gabikeys.PublicKey, signature *CLSignature, context,
 	// Recalculate hash
 	cPrime := common.HashCommit([]*big.Int{context, Q, signature.A, nonce, ACommit}, false)
 
-	return p.C.Cmp(cPrime) == 0
+	if p.C.Cmp(cPrime) != 0 {
+		return verificationError(ErrChallenge, nil)
+	}
+	return nil
 }
 
 // ProofD represents a proof in the showing protocol.
 type ProofD struct {
-	C                  *big.Int                    `json:"c"`
-	A                  *big.Int                    `json:"A"`
-	EResponse          *big.Int                    `json:"e_response"`
-	VResponse          *big.Int                    `json:"v_response"`
-	AResponses         map[int]*big.Int            `json:"a_responses"`
-	ADisclosed         map[int]*big.Int            `json:"a_disclosed"`
-	NonRevocationProof *revocation.Proof           `json:"nonrev_proof,omitempty"`
-	RangeProofs        map[int][]*rangeproof.Proof `json:"rangeproofs,omitempty"`
-
-	cachedRangeStructures map[int][]*rangeproof.ProofStructure
+	C                    *big.Int                       `json:"c"`
+	A                    *big.Int                       `json:"A"`
+	EResponse            *big.Int                       `json:"e_response"`
+	VResponse            *big.Int                       `json:"v_response"`
+	AResponses           map[int]*big.Int               `json:"a_responses"`
+	ADisclosed           map[int]*big.Int               `json:"a_disclosed"`
+	NonRevocationProof   *revocation.Proof              `json:"nonrev_proof,omitempty"`
+	RangeProofs          map[int][]*rangeproof.Proof    `json:"rangeproofs,omitempty"`
+	SetMembershipProofs  map[int][]*setmembership.Proof `json:"setmembershipproofs,omitempty"`
+	AttributeCommitments map[int]*AttributeCommitment   `json:"attribute_commitments,omitempty"`
+	ShowTag              *ShowTagProof                  `json:"show_tag,omitempty"`
+
+	// ZCommit is the commitment Z of the proof, which is not needed for verification but allows
+	// for batch verification (see BatchVerify()). It is only included if the builder was made
+	// batch verifiable (see DisclosureProofBuilder.BatchVerifiable()).
+	ZCommit *big.Int `json:"z_commit,omitempty"`
+
+	cachedRangeStructures         map[int][]*rangeproof.ProofStructure
+	cachedSetMembershipStructures map[int][]*setmembership.ProofStructure
 }
 
 func (p *ProofD) MergeProofP(proofP *ProofP, pk *gabikeys.PublicKey) {
@@ -183,6 +261,24 @@ func (p *ProofD) reconstructRangeProofStructures(pk *gabikeys.PublicKey) error {
 	return nil
 }
 
+func (p *ProofD) reconstructSetMembershipProofStructures(pk *gabikeys.PublicKey) error {
+	p.cachedSetMembershipStructures = make(map[int][]*setmembership.ProofStructure)
+	for index, proofs := range p.SetMembershipProofs {
+		if p.AResponses[index] == nil {
+			return errors.New("set membership proof on disclosed or nonexisting attribute")
+		}
+		p.cachedSetMembershipStructures[index] = []*setmembership.ProofStructure{}
+		for _, proof := range proofs {
+			s, err := proof.ExtractStructure(index, pk)
+			if err != nil {
+				return err
+			}
+			p.cachedSetMembershipStructures[index] = append(p.cachedSetMembershipStructures[index], s)
+		}
+	}
+	return nil
+}
+
 // correctResponseSizes checks the sizes of the elements in the ProofD proof.
 func (p *ProofD) correctResponseSizes(pk *gabikeys.PublicKey) bool {
 	// Check range on the AResponses
@@ -218,7 +314,7 @@ func (p *ProofD) reconstructZ(pk *gabikeys.PublicKey) (*big.Int, error) {
 		if exp.BitLen() > int(pk.Params.Lm) {
 			exp = common.IntHashSha256(exp.Bytes())
 		}
-		numerator.Mul(numerator, new(big.Int).Exp(pk.R[i], exp, pk.N))
+		numerator.Mul(numerator, pk.ExpModN(pk.R[i], exp))
 	}
 
 	known := new(big.Int).ModInverse(numerator, pk.N)
@@ -236,13 +332,13 @@ func (p *ProofD) reconstructZ(pk *gabikeys.PublicKey) (*big.Int, error) {
 	if err != nil {
 		return nil, err
 	}
-	Sv, err := common.ModPow(pk.S, p.VResponse, pk.N)
+	Sv, err := pk.ModPow(pk.S, p.VResponse)
 	if err != nil {
 		return nil, err
 	}
 	Rs := big.NewInt(1)
 	for i, response := range p.AResponses {
-		t, err := common.ModPow(pk.R[i], response, pk.N)
+		t, err := pk.ModPow(pk.R[i], response)
 		if err != nil {
 			return nil, err
 		}
@@ -256,11 +352,17 @@ func (p *ProofD) reconstructZ(pk *gabikeys.PublicKey) (*big.Int, error) {
 
 // Verify verifies the proof against the given public key, context, and nonce.
 func (p *ProofD) Verify(pk *gabikeys.PublicKey, context, nonce1 *big.Int, issig bool) bool {
+	return p.VerifyDetailed(pk, context, nonce1, issig) == nil
+}
+
+// VerifyDetailed verifies the proof like Verify(), returning a *VerificationError describing
+// the failed check if the proof is invalid.
+func (p *ProofD) VerifyDetailed(pk *gabikeys.PublicKey, context, nonce1 *big.Int, issig bool) error {
 	contrib, err := p.ChallengeContribution(pk)
 	if err != nil {
-		return false
+		return asVerificationError(err)
 	}
-	return p.VerifyWithChallenge(pk, createChallenge(context, nonce1, contrib, issig))
+	return p.verifyWithChallenge(pk, createChallenge(context, nonce1, contrib, issig))
 }
 
 func (p *ProofD) HasNonRevocationProof() bool {
@@ -270,22 +372,31 @@ func (p *ProofD) HasNonRevocationProof() bool {
 // Verify verifies the proof against the given public key and the provided
 // reconstruted challenge.
 func (p *ProofD) VerifyWithChallenge(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) bool {
-	var notrevoked bool
+	return p.verifyWithChallenge(pk, reconstructedChallenge) == nil
+}
+
+func (p *ProofD) verifyWithChallenge(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) error {
 	// Validate non-revocation
 	if p.HasNonRevocationProof() {
 		revIdx := p.revocationAttrIndex()
 		if revIdx < 0 || p.AResponses[revIdx] == nil {
-			return false
+			return verificationError(ErrNonRevocation, errors.New("no revocation response found"))
+		}
+		if err := p.NonRevocationProof.VerifyWithChallengeDetailed(pk, reconstructedChallenge); err != nil {
+			return verificationError(ErrNonRevocation, err)
+		}
+		if p.NonRevocationProof.Responses["alpha"].Cmp(p.AResponses[revIdx]) != 0 {
+			return verificationError(ErrNonRevocation, errors.New("revocation response mismatch"))
 		}
-		notrevoked = p.NonRevocationProof.VerifyWithChallenge(pk, reconstructedChallenge) &&
-			p.NonRevocationProof.Responses["alpha"].Cmp(p.AResponses[revIdx]) == 0
-	} else {
-		notrevoked = true
 	}
-	// Range proofs were already validated during challenge reconstruction
-	return notrevoked &&
-		p.correctResponseSizes(pk) &&
-		p.C.Cmp(reconstructedChallenge) == 0
+	// Range and set membership proofs, attribute commitments and show tags were already validated during challenge reconstruction
+	if !p.correctResponseSizes(pk) {
+		return verificationError(ErrResponseSize, nil)
+	}
+	if p.C.Cmp(reconstructedChallenge) != 0 {
+		return verificationError(ErrChallenge, nil)
+	}
+	return nil
 }
 
 // ChallengeContribution returns the contribution of this proof to the
@@ -295,15 +406,20 @@ func (p *ProofD) ChallengeContribution(pk *gabikeys.PublicKey) ([]*big.Int, erro
 	if err != nil {
 		return nil, errors.WrapPrefix(err, "Could not reconstruct Z", 0)
 	}
+	return p.challengeContribution(pk, z)
+}
 
+// challengeContribution returns the contribution of this proof to the challenge, given the
+// commitment Z.
+func (p *ProofD) challengeContribution(pk *gabikeys.PublicKey, z *big.Int) ([]*big.Int, error) {
 	l := []*big.Int{p.A, z}
 	if p.NonRevocationProof != nil {
 		revIdx := p.revocationAttrIndex()
 		if revIdx < 0 || p.AResponses[revIdx] == nil {
-			return nil, errors.New("no revocation response found")
+			return nil, verificationError(ErrNonRevocation, errors.New("no revocation response found"))
 		}
 		if err := p.NonRevocationProof.SetExpected(pk, p.C, p.AResponses[revIdx]); err != nil {
-			return nil, err
+			return nil, verificationError(ErrNonRevocation, err)
 		}
 		contrib := p.NonRevocationProof.ChallengeContributions(pk)
 		l = append(l, contrib...)
@@ -312,7 +428,7 @@ func (p *ProofD) ChallengeContribution(pk *gabikeys.PublicKey) ([]*big.Int, erro
 	if p.RangeProofs != nil {
 		if p.cachedRangeStructures == nil {
 			if err := p.reconstructRangeProofStructures(pk); err != nil {
-				return nil, err
+				return nil, verificationError(ErrRangeProof, err)
 			}
 		}
 		// need stable attribute order for rangeproof contributions, so determine max undisclosed attribute
@@ -329,14 +445,60 @@ func (p *ProofD) ChallengeContribution(pk *gabikeys.PublicKey) ([]*big.Int, erro
 			}
 			for i, s := range structures {
 				p.RangeProofs[index][i].MResponse = new(big.Int).Set(p.AResponses[index])
+				// The response of an attribute of another proof is set by ProofList.Verify()
+				if other := s.OtherAttribute(); other != nil && other.Proof == nil {
+					if p.AResponses[other.Index] == nil {
+						return nil, verificationError(ErrRangeProof, errors.New("Range proof relates to disclosed or nonexisting attribute"))
+					}
+					p.RangeProofs[index][i].OtherResponse = new(big.Int).Set(p.AResponses[other.Index])
+				}
 				if !s.VerifyProofStructure(pk, p.RangeProofs[index][i]) {
-					return nil, errors.New("Invalid range proof")
+					return nil, verificationError(ErrRangeProof, nil)
 				}
 				l = append(l, s.CommitmentsFromProof(pk, p.RangeProofs[index][i], p.C)...)
 			}
 		}
 	}
 
+	if p.SetMembershipProofs != nil {
+		if p.cachedSetMembershipStructures == nil {
+			if err := p.reconstructSetMembershipProofStructures(pk); err != nil {
+				return nil, verificationError(ErrSetMembershipProof, err)
+			}
+		}
+		maxAttribute := 0
+		for k := range p.AResponses {
+			if k > maxAttribute {
+				maxAttribute = k
+			}
+		}
+		for index := 0; index <= maxAttribute; index++ {
+			structures, ok := p.cachedSetMembershipStructures[index]
+			if !ok {
+				continue
+			}
+			for i, s := range structures {
+				p.SetMembershipProofs[index][i].MResponse = new(big.Int).Set(p.AResponses[index])
+				if !s.VerifyProofStructure(pk, p.SetMembershipProofs[index][i]) {
+					return nil, verificationError(ErrSetMembershipProof, nil)
+				}
+				l = append(l, s.CommitmentsFromProof(pk, p.SetMembershipProofs[index][i], p.C)...)
+			}
+		}
+	}
+
+	commitments, err := p.attributeCommitmentContributions(pk)
+	if err != nil {
+		return nil, verificationError(ErrAttributeCommitment, err)
+	}
+	l = append(l, commitments...)
+
+	showTag, err := p.showTagContributions()
+	if err != nil {
+		return nil, verificationError(ErrShowTag, err)
+	}
+	l = append(l, showTag...)
+
 	return l, nil
 }
 
@@ -346,6 +508,31 @@ func (p *ProofD) SecretKeyResponse() *big.Int {
 	return p.AResponses[0]
 }
 
+func (p *ProofD) attributeResponse(index int) *big.Int {
+	return p.AResponses[index]
+}
+
+// setCrossResponses provides the range proofs relating to attributes of other proofs in the
+// specified list with the responses of those attributes.
+func (p *ProofD) setCrossResponses(pl ProofList) error {
+	for _, proofs := range p.RangeProofs {
+		for _, proof := range proofs {
+			if proof.Other == nil || proof.Other.Proof == nil {
+				continue
+			}
+			if *proof.Other.Proof < 0 || *proof.Other.Proof >= len(pl) {
+				return verificationError(ErrRangeProof, errors.New("Range proof relates to nonexisting proof"))
+			}
+			other, ok := pl[*proof.Other.Proof].(attributeResponder)
+			if !ok || other.attributeResponse(proof.Other.Index) == nil {
+				return verificationError(ErrRangeProof, errors.New("Range proof relates to disclosed or nonexisting attribute"))
+			}
+			proof.OtherResponse = new(big.Int).Set(other.attributeResponse(proof.Other.Index))
+		}
+	}
+	return nil
+}
+
 func (p *ProofD) revocationAttrIndex() int {
 	params := revocation.Parameters
 	max := new(big.Int).Lsh(big.NewInt(1), params.AttributeSize+params.ChallengeLength+params.ZkStat+1)
@@ -367,6 +554,39 @@ type ProofP struct {
 	P         *big.Int `json:"P"`
 	C         *big.Int `json:"c"`
 	SResponse *big.Int `json:"s_response"`
+	// Pcommit is the commitment of the keyshare server (c.f. ProofPCommitment), which is required
+	// by Verify(). It is included by KeyshareSession.Response(), but not by KeyshareResponse().
+	Pcommit *big.Int `json:"Pcommit,omitempty"`
+}
+
+// Verify checks the proof of a keyshare server against the specified challenge, so that its
+// contribution can be checked before it is merged into a proof using MergeProofP(). As the
+// challenge binds the commitment of the keyshare server only if it was merged using
+// MergeProofPCommitment() before computing the challenge, the caller must also check that P and
+// Pcommit equal those of the ProofPCommitment that it merged.
+func (p *ProofP) Verify(pk *gabikeys.PublicKey, challenge *big.Int) bool {
+	if p.P == nil || p.C == nil || p.SResponse == nil || p.Pcommit == nil {
+		return false
+	}
+	if p.C.Cmp(challenge) != 0 {
+		return false
+	}
+
+	// The response of a single keyshare server is the largest, that of one of multiple servers
+	// being shrunk (see NewMultiKeyshareCommitments())
+	bitlen, err := keyshareResponseBitLen(1)
+	if err != nil {
+		return false
+	}
+	if p.SResponse.Sign() < 0 || uint(p.SResponse.BitLen()) > bitlen {
+		return false
+	}
+
+	// R_0^SResponse should equal Pcommit * P^C
+	lhs := pk.ExpModN(pk.R[0], p.SResponse)
+	rhs := pk.ExpModN(p.P, p.C)
+	rhs.Mul(rhs, p.Pcommit).Mod(rhs, pk.N)
+	return lhs.Cmp(rhs) == 0
 }
 
 // ProofPCommitment is a keyshare server's first message in its proof of knowledge
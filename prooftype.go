@@ -0,0 +1,277 @@
+package gabi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/fxamacker/cbor"
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+)
+
+// ProofType describes a Proof implementation, which once registered using RegisterProofType() can
+// be contained in (un)marshaled ProofLists.
+//
+// When marshaling a ProofList, each proof is encoded as usual, with an additional field "type"
+// containing the name of its type. When unmarshaling, this field determines into which Proof
+// implementation the proof is decoded. Proofs without this field, as encoded by previous versions
+// of gabi, are decoded into the first registered type whose Detect function accepts it.
+type ProofType struct {
+	// Name identifies the proof type in encoded ProofLists.
+	Name string
+	// New returns a new, empty instance of the Proof implementation.
+	New func() Proof
+	// Detect, if not nil, reports whether a proof without type name, decoded into an instance
+	// returned by New, is of this type.
+	Detect func(Proof) bool
+}
+
+// proofTypeField is the field containing the type name in encoded proofs.
+const proofTypeField = "type"
+
+var proofTypes = struct {
+	sync.RWMutex
+	byName map[string]*ProofType
+	byType map[reflect.Type]*ProofType
+	list   []*ProofType // in order of registration
+}{
+	byName: map[string]*ProofType{},
+	byType: map[reflect.Type]*ProofType{},
+}
+
+func init() {
+	RegisterProofType(ProofType{
+		Name:   "ProofD",
+		New:    func() Proof { return &ProofD{} },
+		Detect: func(p Proof) bool { return p.(*ProofD).A != nil },
+	})
+	RegisterProofType(ProofType{
+		Name:   "ProofU",
+		New:    func() Proof { return &ProofU{} },
+		Detect: func(p Proof) bool { return p.(*ProofU).U != nil },
+	})
+	RegisterProofType(ProofType{
+		Name:   "ProofNym",
+		New:    func() Proof { return &ProofNym{} },
+		Detect: func(p Proof) bool { return p.(*ProofNym).Nym != nil },
+	})
+	RegisterProofType(ProofType{
+		Name:   "ProofVerEnc",
+		New:    func() Proof { return &ProofVerEnc{} },
+		Detect: func(p Proof) bool { return p.(*ProofVerEnc).Encryption != nil },
+	})
+}
+
+// RegisterProofType registers a Proof implementation, so that it can be contained in
+// (un)marshaled ProofLists. The "type" field must not be used by the encoding of the proofs.
+// It panics if the name or the Go type returned by New is already registered.
+func RegisterProofType(t ProofType) {
+	if t.Name == "" || t.New == nil {
+		panic("gabi: proof type must have a name and a constructor")
+	}
+	typ := reflect.TypeOf(t.New())
+
+	proofTypes.Lock()
+	defer proofTypes.Unlock()
+	if _, ok := proofTypes.byName[t.Name]; ok {
+		panic("gabi: proof type " + t.Name + " registered twice")
+	}
+	if _, ok := proofTypes.byType[typ]; ok {
+		panic("gabi: Go type " + typ.String() + " registered twice as proof type")
+	}
+	proofTypes.byName[t.Name] = &t
+	proofTypes.byType[typ] = &t
+	proofTypes.list = append(proofTypes.list, &t)
+}
+
+// proofTypeOf returns the registered type name of the proof, if any.
+func proofTypeOf(proof Proof) (string, bool) {
+	proofTypes.RLock()
+	defer proofTypes.RUnlock()
+	t, ok := proofTypes.byType[reflect.TypeOf(proof)]
+	if !ok {
+		return "", false
+	}
+	return t.Name, true
+}
+
+// decodeProof decodes a proof using the specified unmarshaler, into the type with the specified
+// name, or if name is empty, into the first type detecting it.
+func decodeProof(name string, bts []byte, unmarshal func([]byte, interface{}) error) (Proof, error) {
+	proofTypes.RLock()
+	t, ok := proofTypes.byName[name]
+	list := proofTypes.list
+	proofTypes.RUnlock()
+
+	if name != "" {
+		if !ok {
+			return nil, errors.Errorf("unknown proof type %s found in ProofList", name)
+		}
+		proof := t.New()
+		if err := unmarshal(bts, proof); err != nil {
+			return nil, err
+		}
+		return proof, nil
+	}
+
+	for _, t := range list {
+		if t.Detect == nil {
+			continue
+		}
+		proof := t.New()
+		if err := unmarshal(bts, proof); err != nil {
+			return nil, err
+		}
+		if t.Detect(proof) {
+			return proof, nil
+		}
+	}
+	return nil, errors.New("Unknown proof type found in ProofList")
+}
+
+// MarshalJSON implements json.Marshaler, adding the type name of registered proof types to the
+// encoded proofs.
+func (pl ProofList) MarshalJSON() ([]byte, error) {
+	if pl == nil {
+		return []byte("null"), nil
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('[')
+	for i, proof := range pl {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		bts, err := json.Marshal(proof)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := proofTypeOf(proof)
+		if !ok || len(bts) < 2 || bts[0] != '{' {
+			buf.Write(bts)
+			continue
+		}
+		buf.WriteString(`{"` + proofTypeField + `":`)
+		typeBts, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(typeBts)
+		if len(bts) > 2 { // not an empty object
+			buf.WriteByte(',')
+		}
+		buf.Write(bts[1:])
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler (json's default unmarshaler
+// is unable to handle a list of interfaces).
+func (pl *ProofList) UnmarshalJSON(bts []byte) error {
+	temp := []json.RawMessage{}
+	if err := json.Unmarshal(bts, &temp); err != nil {
+		return err
+	}
+	proofs := make([]Proof, 0, len(temp))
+	for _, proofbytes := range temp {
+		var tagged struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(proofbytes, &tagged); err != nil {
+			return err
+		}
+		proof, err := decodeProof(tagged.Type, proofbytes, json.Unmarshal)
+		if err != nil {
+			return err
+		}
+		proofs = append(proofs, proof)
+	}
+	*pl = proofs
+	return nil
+}
+
+// MarshalCBOR implements cbor.Marshaler, like MarshalJSON().
+func (pl ProofList) MarshalCBOR() ([]byte, error) {
+	if pl == nil {
+		return []byte{cborNull}, nil
+	}
+	enc := big.AppendCBORHead(nil, cborArray, uint64(len(pl)))
+	for _, proof := range pl {
+		bts, err := cbor.Marshal(proof, cbor.EncOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := proofTypeOf(proof); ok {
+			if bts, err = cborWithTypeField(bts, name); err != nil {
+				return nil, err
+			}
+		}
+		enc = append(enc, bts...)
+	}
+	return enc, nil
+}
+
+// UnmarshalCBOR implements cbor.Unmarshaler, like UnmarshalJSON().
+func (pl *ProofList) UnmarshalCBOR(bts []byte) error {
+	temp := []rawCBOR{}
+	if err := cbor.Unmarshal(bts, &temp); err != nil {
+		return err
+	}
+	proofs := make([]Proof, 0, len(temp))
+	for _, proofbytes := range temp {
+		var tagged struct {
+			Type string `cbor:"type"`
+		}
+		if err := cbor.Unmarshal(proofbytes, &tagged); err != nil {
+			return err
+		}
+		proof, err := decodeProof(tagged.Type, proofbytes, cbor.Unmarshal)
+		if err != nil {
+			return err
+		}
+		proofs = append(proofs, proof)
+	}
+	*pl = proofs
+	return nil
+}
+
+// rawCBOR is an encoded CBOR data item, like json.RawMessage.
+type rawCBOR []byte
+
+// UnmarshalCBOR implements cbor.Unmarshaler, storing a copy of the data.
+func (r *rawCBOR) UnmarshalCBOR(data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+// CBOR major types and simple values (RFC 8949, section 3).
+const (
+	cborArray = 4
+	cborMap   = 5
+	cborNull  = 0xf6
+)
+
+// cborWithTypeField adds the type field with the specified name to the encoded CBOR map, if it
+// is one. Other data items are returned as is.
+func cborWithTypeField(item []byte, name string) ([]byte, error) {
+	if len(item) == 0 || item[0]>>5 != cborMap {
+		return item, nil
+	}
+	field, err := cbor.Marshal(map[string]string{proofTypeField: name}, cbor.EncOptions{})
+	if err != nil {
+		return nil, err
+	}
+	field = field[1:] // skip the head of the map, leaving its key and value
+
+	if item[0]&0x1f == 31 { // indefinite length map, whose head does not contain its size
+		return append(append([]byte{item[0]}, field...), item[1:]...), nil
+	}
+	_, size, rest, err := big.ParseCBORHead(item)
+	if err != nil {
+		return nil, err
+	}
+	enc := big.AppendCBORHead(make([]byte, 0, len(item)+len(field)+8), cborMap, size+1)
+	return append(append(enc, field...), rest...), nil
+}
@@ -2,6 +2,8 @@ package rangeproof
 
 import (
 	"fmt"
+	"io"
+	"math/bits"
 	"strconv"
 
 	"github.com/privacybydesign/gabi/big"
@@ -104,17 +106,54 @@ Notes:
   with E, the product of all used e_i's.
 - This proof nowhere uses that the amount of squares we use is three; hence it also works when using
   four squares.
+
+---
+
+The same representation also allows proving that a*m != k. Writing delta = a*m - k, the prover
+commits to delta and proves that delta times some integer equals 1 plus a sum of four squares, using
+delta itself for that integer and writing delta^2 - 1 as a sum of squares:
+
+    C_i = R^(d_i) S^(v_i)
+    C_delta R^k = R^(a*m) S^w
+    R = C_delta^(delta) S^(v_5) \product_i C_i^(-d_i)
+
+where w is a computational hider for delta and v_5 = \sum_i d_i * v_i - w * delta. Along the same
+lines as above, an adversary for which a*m = k would yield nonzero a = 1 + \sum_i (d_i)^2 and some b
+such that R^a = S^b, contradicting the strong RSA assumption. As delta and v_5 may be negative, their
+randomizers are offset such that all responses are nonnegative.
+
+---
+
+Finally, statements may relate the attribute m to a second attribute m' of the prover, replacing
+a*m by a*m - b*m' in all of the above, for a fixed positive constant b. The prover then also proves
+knowledge of m' in the substatements involving a*m, using the same response for m' as in the proof of
+knowledge of the signature on m'. The soundness arguments are unaffected.
 */
 
 type (
 	// Statement states that an attribute m satisfies Sign*(Factor*m-Bound) >= 0, and that
 	// Sign*(Factor*m-Bound) can be split into squares with the given Splitter. E.g. if Factor = 1
 	// then Factor*m >= Bound. Defaults to four square splitter when splitter is not specified.
+	// If Sign is 0, the statement is instead that Factor*m != Bound; the Splitter must then split
+	// into four squares. If Other is set, Factor*m is replaced by Factor*m - Other.Factor*m' in the
+	// above, with m' the attribute specified by Other.
 	Statement struct {
 		Sign     int
 		Factor   uint
 		Bound    *big.Int
 		Splitter SquareSplitter
+		Other    *OtherAttribute
+	}
+
+	// OtherAttribute specifies a second attribute m' to which the attribute of a Statement is
+	// related, and its factor. If Proof is nil, m' is an attribute of the same credential;
+	// otherwise, Proof is the index of the proof within the list of (bound) proofs that discloses
+	// the credential containing m'. In the latter case m' is only committed to in that proof, under
+	// the public key of its own issuer; its response is provided to this proof by the proof list.
+	OtherAttribute struct {
+		Index  int  `json:"index"`
+		Factor uint `json:"factor"`
+		Proof  *int `json:"proof,omitempty"`
 	}
 
 	StatementType int
@@ -122,11 +161,13 @@ type (
 	ProofStructure struct {
 		cRep     []zkproof.QrRepresentationProofStructure
 		mCorrect zkproof.QrRepresentationProofStructure
+		cDelta   *zkproof.QrRepresentationProofStructure
 
 		index int
 		sign  int
 		a     uint
 		k     *big.Int
+		other *OtherAttribute
 
 		splitter SquareSplitter
 		ld       uint
@@ -140,6 +181,15 @@ type (
 		V5Response *big.Int   `json:"v5"`
 		MResponse  *big.Int   `json:"-"`
 
+		// Only present in proofs of Sign 0 (not equal) statements
+		CDelta        *big.Int `json:"C_delta,omitempty"`
+		DeltaResponse *big.Int `json:"delta,omitempty"`
+		WResponse     *big.Int `json:"w,omitempty"`
+
+		// Only present in proofs of statements relating two attributes
+		Other         *OtherAttribute `json:"other,omitempty"`
+		OtherResponse *big.Int        `json:"-"`
+
 		// Proof structure description
 		Ld   uint     `json:"l_d"`
 		Sign int      `json:"sign"`
@@ -160,6 +210,14 @@ type (
 		v5Randomizer *big.Int
 		m            *big.Int
 		mRandomizer  *big.Int
+		m2           *big.Int
+		m2Randomizer *big.Int
+
+		cDelta          *big.Int
+		delta           *big.Int
+		deltaRandomizer *big.Int
+		w               *big.Int
+		wRandomizer     *big.Int
 	}
 
 	proof       Proof
@@ -169,11 +227,14 @@ type (
 const (
 	GreaterOrEqual StatementType = iota
 	LesserOrEqual
+	NotEqual
 )
 
 var (
 	ErrFalseStatement  = errors.New("requested inequality does not hold")
 	ErrUnsupportedSign = errors.New("unsupported sign: must be 1 or -1")
+
+	ErrUnsupportedSplitter = errors.New("unsupported splitter: not equal statements require four squares")
 )
 
 func NewStatement(typ StatementType, bound *big.Int) (*Statement, error) {
@@ -184,30 +245,65 @@ func NewStatement(typ StatementType, bound *big.Int) (*Statement, error) {
 	return &Statement{Sign: sign, Factor: 1, Bound: new(big.Int).Set(bound)}, nil
 }
 
-// Create a new proof structure for proving a statement of the form sign(factor*m - bound) >= 0.
+// NewRelationStatement returns a statement relating an attribute m to the attribute m' at
+// otherIndex, e.g. m - m' >= bound in case of GreaterOrEqual.
+func NewRelationStatement(typ StatementType, otherIndex int, bound *big.Int) (*Statement, error) {
+	statement, err := NewStatement(typ, bound)
+	if err != nil {
+		return nil, err
+	}
+	statement.Other = &OtherAttribute{Index: otherIndex, Factor: 1}
+	return statement, nil
+}
+
+// Create a new proof structure for proving a statement of the form sign(factor*m - bound) >= 0,
+// or factor*m != bound if sign is 0.
 //
 // index specifies the index of the attribute.
 // splitter describes the method used for splitting numbers into sum of squares.
 func NewProofStructure(index, sign int, factor uint, bound *big.Int, splitter SquareSplitter) (*ProofStructure, error) {
+	return NewRelationProofStructure(index, sign, factor, nil, bound, splitter)
+}
+
+// Create a new proof structure for proving a statement of the form
+// sign(factor*m - other.Factor*m' - bound) >= 0, or factor*m - other.Factor*m' != bound if sign is 0,
+// where m' is the attribute specified by other. If other is nil, the m' term is omitted.
+func NewRelationProofStructure(index, sign int, factor uint, other *OtherAttribute, bound *big.Int, splitter SquareSplitter) (*ProofStructure, error) {
 	if splitter == nil {
 		splitter = &FourSquaresSplitter{}
 	}
+	if other != nil {
+		if other.Factor == 0 || (other.Proof == nil && other.Index == index) {
+			return nil, errors.New("invalid other attribute")
+		}
+		other = other.copy() // ensure we dont overwrite callers copy
+	}
+
+	if sign == 0 {
+		if splitter.SquareCount() != 4 {
+			return nil, ErrUnsupportedSplitter
+		}
+		return newNotEqual(index, factor, other, bound, splitter)
+	}
 
 	if splitter.SquareCount() == 3 {
-		if factor != 1 {
+		if factor != 1 || (other != nil && other.Factor != 1) {
 			return nil, errors.New("factor must be 1")
 		}
 		// Not all numbers can be written as sum of 3 squares, but n for which n == 2 (mod 4) can
 		// so ensure that factor*m-bound falls into that category
 		factor *= 4
+		if other != nil {
+			other.Factor *= 4
+		}
 		bound = new(big.Int).Mul(bound, big.NewInt(4)) // ensure we dont overwrite callers copy of bound
 		bound.Sub(bound, big.NewInt(2))
 	}
 
-	return newWithParams(index, sign, factor, bound, splitter, splitter.SquareCount(), splitter.Ld())
+	return newWithParams(index, sign, factor, other, bound, splitter, splitter.SquareCount(), splitter.Ld())
 }
 
-func newWithParams(index, sign int, a uint, k *big.Int, split SquareSplitter, nSplit int, ld uint) (*ProofStructure, error) {
+func newWithParams(index, sign int, a uint, other *OtherAttribute, k *big.Int, split SquareSplitter, nSplit int, ld uint) (*ProofStructure, error) {
 	if nSplit > 4 {
 		return nil, errors.New("no support for range proofs with delta split in more than 4 squares")
 	}
@@ -236,11 +332,20 @@ func newWithParams(index, sign int, a uint, k *big.Int, split SquareSplitter, nS
 		sign:  sign,
 		a:     a,
 		k:     new(big.Int).Set(k),
+		other: other,
 
 		splitter: split,
 		ld:       ld,
 	}
 
+	if other != nil {
+		result.mCorrect.Rhs = append(result.mCorrect.Rhs, zkproof.RhsContribution{
+			Base:   fmt.Sprintf("R%d", index),
+			Secret: "m2",
+			Power:  int64(other.Factor) * int64(sign),
+		})
+	}
+
 	for i := 0; i < nSplit; i++ {
 		result.cRep = append(result.cRep, zkproof.QrRepresentationProofStructure{
 			Lhs: []zkproof.LhsContribution{
@@ -262,8 +367,123 @@ func newWithParams(index, sign int, a uint, k *big.Int, split SquareSplitter, nS
 	return result, nil
 }
 
+func newNotEqual(index int, a uint, other *OtherAttribute, k *big.Int, split SquareSplitter) (*ProofStructure, error) {
+	if a == 0 {
+		return nil, errors.New("factor must be positive")
+	}
+
+	result := &ProofStructure{
+		mCorrect: zkproof.QrRepresentationProofStructure{
+			Lhs: []zkproof.LhsContribution{
+				{Base: fmt.Sprintf("R%d", index), Power: big.NewInt(1)},
+			},
+			Rhs: []zkproof.RhsContribution{
+				{Base: "Cdelta", Secret: "delta", Power: 1},
+				{Base: "S", Secret: "v5", Power: 1},
+			},
+		},
+		cDelta: &zkproof.QrRepresentationProofStructure{
+			Lhs: []zkproof.LhsContribution{
+				{Base: "Cdelta", Power: big.NewInt(1)},
+				{Base: fmt.Sprintf("R%d", index), Power: new(big.Int).Set(k)},
+			},
+			Rhs: []zkproof.RhsContribution{
+				{Base: fmt.Sprintf("R%d", index), Secret: "m", Power: int64(a)},
+				{Base: "S", Secret: "w", Power: 1},
+			},
+		},
+
+		index: index,
+		sign:  0,
+		a:     a,
+		k:     new(big.Int).Set(k),
+		other: other,
+
+		splitter: split,
+	}
+
+	if other != nil {
+		result.cDelta.Rhs = append(result.cDelta.Rhs, zkproof.RhsContribution{
+			Base:   fmt.Sprintf("R%d", index),
+			Secret: "m2",
+			Power:  -int64(other.Factor),
+		})
+	}
+
+	for i := 0; i < 4; i++ {
+		result.cRep = append(result.cRep, zkproof.QrRepresentationProofStructure{
+			Lhs: []zkproof.LhsContribution{
+				{Base: fmt.Sprintf("C%d", i), Power: big.NewInt(1)},
+			},
+			Rhs: []zkproof.RhsContribution{
+				{Base: fmt.Sprintf("R%d", index), Secret: fmt.Sprintf("d%d", i), Power: 1},
+				{Base: "S", Secret: fmt.Sprintf("v%d", i), Power: 1},
+			},
+		})
+
+		result.mCorrect.Rhs = append(result.mCorrect.Rhs, zkproof.RhsContribution{
+			Base:   fmt.Sprintf("C%d", i),
+			Secret: fmt.Sprintf("d%d", i),
+			Power:  -1,
+		})
+	}
+
+	return result, nil
+}
+
+// deltaBitLen returns an upper bound on the bitsize of a*m - b*m' - k in a not equal statement,
+// which is also an upper bound on the bitsize of the d_i.
+func (s *ProofStructure) deltaBitLen(g *gabikeys.PublicKey) uint {
+	l := g.Params.Lm + uint(bits.Len(s.a))
+	if s.other != nil && g.Params.Lm+uint(bits.Len(s.other.Factor)) > l {
+		l = g.Params.Lm + uint(bits.Len(s.other.Factor))
+	}
+	if uint(s.k.BitLen()) > l {
+		l = uint(s.k.BitLen())
+	}
+	return l + 2
+}
+
 func (statement *Statement) ProofStructure(index int) (*ProofStructure, error) {
-	return NewProofStructure(index, statement.Sign, statement.Factor, statement.Bound, statement.Splitter)
+	return NewRelationProofStructure(index, statement.Sign, statement.Factor, statement.Other, statement.Bound, statement.Splitter)
+}
+
+// OtherAttribute returns the second attribute to which the statement of this structure relates the
+// attribute, or nil if there is none.
+func (s *ProofStructure) OtherAttribute() *OtherAttribute {
+	if s.other == nil {
+		return nil
+	}
+	return s.other.copy()
+}
+
+func (o *OtherAttribute) copy() *OtherAttribute {
+	result := &OtherAttribute{Index: o.Index, Factor: o.Factor}
+	if o.Proof != nil {
+		proof := *o.Proof
+		result.Proof = &proof
+	}
+	return result
+}
+
+// Equals returns whether o and other refer to the same attribute with the same factor.
+func (o *OtherAttribute) Equals(other *OtherAttribute) bool {
+	if o == nil || other == nil {
+		return o == other
+	}
+	if (o.Proof == nil) != (other.Proof == nil) || (o.Proof != nil && *o.Proof != *other.Proof) {
+		return false
+	}
+	return o.Index == other.Index && o.Factor == other.Factor
+}
+
+// delta computes a*m - b*m2 - k.
+func (s *ProofStructure) delta(m, m2 *big.Int) *big.Int {
+	d := new(big.Int).Mul(m, big.NewInt(int64(s.a)))
+	if s.other != nil {
+		d.Sub(d, new(big.Int).Mul(m2, big.NewInt(int64(s.other.Factor))))
+	}
+	return d.Sub(d, s.k)
 }
 
 func (typ StatementType) Sign() (int, error) {
@@ -272,16 +492,36 @@ func (typ StatementType) Sign() (int, error) {
 		return 1, nil
 	case LesserOrEqual:
 		return -1, nil
+	case NotEqual:
+		return 0, nil
 	default:
 		return 0, ErrUnsupportedSign
 	}
 }
 
 func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRandomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
+	return s.CommitmentsFromSecretsWithOther(g, m, mRandomizer, nil, nil)
+}
+
+// CommitmentsFromSecretsWithOther is like CommitmentsFromSecrets, additionally taking the value and
+// randomizer of the other attribute for structures that relate two attributes.
+func (s *ProofStructure) CommitmentsFromSecretsWithOther(g *gabikeys.PublicKey, m, mRandomizer, m2, m2Randomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
+	return s.CommitmentsFromSecretsWithRand(nil, g, m, mRandomizer, m2, m2Randomizer)
+}
+
+// CommitmentsFromSecretsWithRand is like CommitmentsFromSecretsWithOther, reading the randomness
+// of the commitments from the specified source (if nil, crypto/rand is used).
+func (s *ProofStructure) CommitmentsFromSecretsWithRand(random io.Reader, g *gabikeys.PublicKey, m, mRandomizer, m2, m2Randomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
+	if (s.other == nil) != (m2 == nil) || (m2 == nil) != (m2Randomizer == nil) {
+		return nil, nil, errors.New("other attribute must be specified iff the statement relates two attributes")
+	}
+	if s.sign == 0 {
+		return s.notEqualCommitmentsFromSecrets(random, g, m, mRandomizer, m2, m2Randomizer)
+	}
+
 	var err error
 
-	d := new(big.Int).Mul(m, big.NewInt(int64(s.a)))
-	d.Sub(d, s.k)
+	d := s.delta(m, m2)
 	if s.sign == -1 {
 		d.Neg(d)
 	}
@@ -291,8 +531,10 @@ func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRando
 	}
 
 	commit := &proofCommit{
-		m:           m,
-		mRandomizer: mRandomizer,
+		m:            m,
+		mRandomizer:  mRandomizer,
+		m2:           m2,
+		m2Randomizer: m2Randomizer,
 	}
 
 	commit.d, err = s.splitter.Split(d)
@@ -309,7 +551,7 @@ func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRando
 		if v.BitLen() > int(s.ld) {
 			return nil, nil, errors.New("split function returned oversized d")
 		}
-		commit.dRandomizers[i], err = common.RandomBigInt(s.ld + g.Params.Lh + g.Params.Lstatzk)
+		commit.dRandomizers[i], err = common.RandomBigIntFrom(random, s.ld+g.Params.Lh+g.Params.Lstatzk)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -319,11 +561,11 @@ func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRando
 	commit.v = make([]*big.Int, len(commit.d))
 	commit.vRandomizers = make([]*big.Int, len(commit.d))
 	for i := range commit.d {
-		commit.v[i], err = common.RandomBigInt(g.Params.Lm)
+		commit.v[i], err = common.RandomBigIntFrom(random, g.Params.Lm)
 		if err != nil {
 			return nil, nil, err
 		}
-		commit.vRandomizers[i], err = common.RandomBigInt(g.Params.Lm + g.Params.Lh + g.Params.Lstatzk)
+		commit.vRandomizers[i], err = common.RandomBigIntFrom(random, g.Params.Lm+g.Params.Lh+g.Params.Lstatzk)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -335,7 +577,100 @@ func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRando
 		contrib := new(big.Int).Mul(commit.d[i], commit.v[i])
 		commit.v5.Add(commit.v5, contrib)
 	}
-	commit.v5Randomizer, err = common.RandomBigInt(g.Params.Lm + s.ld + 2 + g.Params.Lh + g.Params.Lstatzk)
+	commit.v5Randomizer, err = common.RandomBigIntFrom(random, g.Params.Lm+s.ld+2+g.Params.Lh+g.Params.Lstatzk)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Calculate the bases
+	commit.c = make([]*big.Int, len(commit.d))
+	for i := range commit.d {
+		commit.c[i] = g.ExpModN(g.R[s.index], commit.d[i])
+		commit.c[i].Mul(commit.c[i], g.ExpModN(g.S, commit.v[i]))
+		commit.c[i].Mod(commit.c[i], g.N)
+	}
+
+	bases := zkproof.NewBaseMerge(g, commit)
+
+	var contributions []*big.Int
+	contributions = s.mCorrect.CommitmentsFromSecrets(g, contributions, &bases, commit)
+	for i := range commit.d {
+		contributions = s.cRep[i].CommitmentsFromSecrets(g, contributions, &bases, commit)
+	}
+
+	return contributions, (*ProofCommit)(commit), nil
+}
+
+func (s *ProofStructure) notEqualCommitmentsFromSecrets(random io.Reader, g *gabikeys.PublicKey, m, mRandomizer, m2, m2Randomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
+	var err error
+
+	delta := s.delta(m, m2)
+	if delta.Sign() == 0 {
+		return nil, nil, ErrFalseStatement
+	}
+
+	ld := s.deltaBitLen(g)
+	commit := &proofCommit{
+		m:            m,
+		mRandomizer:  mRandomizer,
+		m2:           m2,
+		m2Randomizer: m2Randomizer,
+		delta:        delta,
+	}
+
+	// Split delta^2 - 1 into squares and generate randomizers for them
+	square := new(big.Int).Mul(delta, delta)
+	commit.d, err = s.splitter.Split(square.Sub(square, big.NewInt(1)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(commit.d) != len(s.cRep) {
+		return nil, nil, errors.New("split function returned wrong number of results")
+	}
+	commit.dRandomizers = make([]*big.Int, len(commit.d))
+	for i, v := range commit.d {
+		if v.Sign() < 0 || uint(v.BitLen()) > ld {
+			return nil, nil, errors.New("split function returned invalid d")
+		}
+		commit.dRandomizers[i], err = common.RandomBigIntFrom(random, ld+g.Params.Lh+g.Params.Lstatzk)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Generate the hiders and their randomizers
+	commit.v = make([]*big.Int, len(commit.d))
+	commit.vRandomizers = make([]*big.Int, len(commit.d))
+	for i := range commit.d {
+		commit.v[i], err = common.RandomBigIntFrom(random, g.Params.Lm)
+		if err != nil {
+			return nil, nil, err
+		}
+		commit.vRandomizers[i], err = common.RandomBigIntFrom(random, g.Params.Lm+g.Params.Lh+g.Params.Lstatzk)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	commit.w, err = common.RandomBigIntFrom(random, g.Params.Lm)
+	if err != nil {
+		return nil, nil, err
+	}
+	commit.wRandomizer, err = common.RandomBigIntFrom(random, g.Params.Lm+g.Params.Lh+g.Params.Lstatzk)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Generate v5, and offset randomizers for delta and v5 as these may be negative
+	commit.v5 = new(big.Int).Mul(commit.w, delta)
+	commit.v5.Neg(commit.v5)
+	for i := range commit.d {
+		commit.v5.Add(commit.v5, new(big.Int).Mul(commit.d[i], commit.v[i]))
+	}
+	commit.deltaRandomizer, err = offsetRandomizer(random, g, ld)
+	if err != nil {
+		return nil, nil, err
+	}
+	commit.v5Randomizer, err = offsetRandomizer(random, g, g.Params.Lm+ld+3)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -343,10 +678,13 @@ func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRando
 	// Calculate the bases
 	commit.c = make([]*big.Int, len(commit.d))
 	for i := range commit.d {
-		commit.c[i] = new(big.Int).Exp(g.R[s.index], commit.d[i], g.N)
-		commit.c[i].Mul(commit.c[i], new(big.Int).Exp(g.S, commit.v[i], g.N))
+		commit.c[i] = g.ExpModN(g.R[s.index], commit.d[i])
+		commit.c[i].Mul(commit.c[i], g.ExpModN(g.S, commit.v[i]))
 		commit.c[i].Mod(commit.c[i], g.N)
 	}
+	commit.cDelta = g.ExpModN(g.R[s.index], delta)
+	commit.cDelta.Mul(commit.cDelta, g.ExpModN(g.S, commit.w))
+	commit.cDelta.Mod(commit.cDelta, g.N)
 
 	bases := zkproof.NewBaseMerge(g, commit)
 
@@ -355,10 +693,21 @@ func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRando
 	for i := range commit.d {
 		contributions = s.cRep[i].CommitmentsFromSecrets(g, contributions, &bases, commit)
 	}
+	contributions = s.cDelta.CommitmentsFromSecrets(g, contributions, &bases, commit)
 
 	return contributions, (*ProofCommit)(commit), nil
 }
 
+// offsetRandomizer returns a randomizer for a secret of at most l bits that may be negative,
+// such that the response is nonnegative.
+func offsetRandomizer(random io.Reader, g *gabikeys.PublicKey, l uint) (*big.Int, error) {
+	r, err := common.RandomBigIntFrom(random, l+g.Params.Lh+g.Params.Lstatzk)
+	if err != nil {
+		return nil, err
+	}
+	return r.Add(r, new(big.Int).Lsh(big.NewInt(1), l+g.Params.Lh)), nil
+}
+
 func (s *ProofStructure) BuildProof(commit *ProofCommit, challenge *big.Int) *Proof {
 	result := &Proof{
 		Cs:         make([]*big.Int, len(commit.c)),
@@ -383,10 +732,31 @@ func (s *ProofStructure) BuildProof(commit *ProofCommit, challenge *big.Int) *Pr
 		result.VResponses[i] = new(big.Int).Add(new(big.Int).Mul(challenge, commit.v[i]), commit.vRandomizers[i])
 	}
 
+	if s.other != nil {
+		result.Other = s.OtherAttribute()
+		result.OtherResponse = new(big.Int).Add(new(big.Int).Mul(challenge, commit.m2), commit.m2Randomizer)
+	}
+
+	if s.sign == 0 {
+		result.CDelta = new(big.Int).Set(commit.cDelta)
+		result.DeltaResponse = new(big.Int).Add(new(big.Int).Mul(challenge, commit.delta), commit.deltaRandomizer)
+		result.WResponse = new(big.Int).Add(new(big.Int).Mul(challenge, commit.w), commit.wRandomizer)
+	}
+
 	return result
 }
 
 func (s *ProofStructure) VerifyProofStructure(g *gabikeys.PublicKey, p *Proof) bool {
+	// The size of the response of the other attribute is checked by the proof of knowledge of
+	// the other attribute, which may use another public key
+	if s.other != nil && p.OtherResponse == nil {
+		return false
+	}
+
+	if s.sign == 0 {
+		return s.verifyNotEqualProofStructure(g, p)
+	}
+
 	if len(s.cRep) != len(p.Cs) || len(s.cRep) != len(p.DResponses) || len(s.cRep) != len(p.VResponses) {
 		return false
 	}
@@ -415,6 +785,40 @@ func (s *ProofStructure) VerifyProofStructure(g *gabikeys.PublicKey, p *Proof) b
 	return true
 }
 
+func (s *ProofStructure) verifyNotEqualProofStructure(g *gabikeys.PublicKey, p *Proof) bool {
+	if len(s.cRep) != len(p.Cs) || len(s.cRep) != len(p.DResponses) || len(s.cRep) != len(p.VResponses) {
+		return false
+	}
+
+	if p.V5Response == nil || p.MResponse == nil || p.CDelta == nil || p.DeltaResponse == nil || p.WResponse == nil {
+		return false
+	}
+
+	ld := s.deltaBitLen(g)
+	if p.V5Response.Sign() < 0 || p.DeltaResponse.Sign() < 0 || p.WResponse.Sign() < 0 ||
+		p.CDelta.BitLen() > g.N.BitLen() ||
+		uint(p.V5Response.BitLen()) > g.Params.Lm+ld+3+g.Params.Lh+g.Params.Lstatzk+1 ||
+		uint(p.DeltaResponse.BitLen()) > ld+g.Params.Lh+g.Params.Lstatzk+1 ||
+		uint(p.WResponse.BitLen()) > g.Params.Lm+g.Params.Lh+g.Params.Lstatzk+1 ||
+		uint(p.MResponse.BitLen()) > g.Params.Lm+g.Params.Lh+g.Params.Lstatzk+1 {
+		return false
+	}
+
+	for i := range s.cRep {
+		if p.Cs[i] == nil || p.DResponses[i] == nil || p.VResponses[i] == nil {
+			return false
+		}
+
+		if p.Cs[i].BitLen() > g.N.BitLen() ||
+			uint(p.DResponses[i].BitLen()) > ld+g.Params.Lh+g.Params.Lstatzk+1 ||
+			uint(p.VResponses[i].BitLen()) > g.Params.Lm+g.Params.Lh+g.Params.Lstatzk+1 {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *ProofStructure) CommitmentsFromProof(g *gabikeys.PublicKey, p *Proof, challenge *big.Int) []*big.Int {
 	bases := zkproof.NewBaseMerge(g, (*proof)(p))
 
@@ -423,12 +827,28 @@ func (s *ProofStructure) CommitmentsFromProof(g *gabikeys.PublicKey, p *Proof, c
 	for i := range s.cRep {
 		contributions = s.cRep[i].CommitmentsFromProof(g, contributions, challenge, &bases, (*proof)(p))
 	}
+	if s.cDelta != nil {
+		contributions = s.cDelta.CommitmentsFromProof(g, contributions, challenge, &bases, (*proof)(p))
+	}
 
 	return contributions
 }
 
 // ProvesStatement returns whether the Proof proves or implies the specified statement.
+//
+// Proofs of statements relating two attributes never prove a statement specified by this function;
+// use Proves for those.
 func (p *Proof) ProvesStatement(sign int, factor uint, bound *big.Int) bool {
+	if p.Other != nil {
+		return false
+	}
+	return p.provesStatement(sign, factor, bound)
+}
+
+func (p *Proof) provesStatement(sign int, factor uint, bound *big.Int) bool {
+	if sign == 0 {
+		return p.Sign == 0 && p.A == factor && p.K.Cmp(bound) == 0
+	}
 	if sign != 1 && sign != -1 {
 		return false
 	}
@@ -443,12 +863,34 @@ func (p *Proof) ProvesStatement(sign int, factor uint, bound *big.Int) bool {
 
 // Proves returns whether the Proof proves or implies the specified statement.
 func (p *Proof) Proves(statement *Statement) bool {
-	return p.ProvesStatement(statement.Sign, statement.Factor, statement.Bound)
+	if statement.Other == nil {
+		return p.ProvesStatement(statement.Sign, statement.Factor, statement.Bound)
+	}
+	return p.ProvenOtherAttribute().Equals(statement.Other) &&
+		p.provesStatement(statement.Sign, statement.Factor, statement.Bound)
+}
+
+// ProvenOtherAttribute returns the second attribute to which the proven statement relates the
+// attribute, or nil if there is none.
+//
+// NB: this method does not verify the proof. Do not trust the output unless proof.Verify() has been
+// invoked first.
+func (p *Proof) ProvenOtherAttribute() *OtherAttribute {
+	if p.Other == nil {
+		return nil
+	}
+	other := p.Other.copy()
+	if len(p.Cs) == 3 {
+		other.Factor >>= 2
+	}
+	return other
 }
 
 // ProvenStatement returns the statement that this proof proves. Calling the second and third return
 // parameters "factor" and "bound" respectively, then
-//    factor*attribute - bound >= 0  or  <= 0
+//
+//	factor*attribute - bound >= 0  or  <= 0  or  != 0
+//
 // where the inequality type is returned as the first parameter.
 //
 // NB: this method does not verify the proof. Do not trust the output unless proof.Verify() has been
@@ -456,6 +898,9 @@ func (p *Proof) Proves(statement *Statement) bool {
 func (p *Proof) ProvenStatement() (StatementType, uint, *big.Int) {
 	bound := new(big.Int).Set(p.K)
 	factor := p.A
+	if p.Sign == 0 {
+		return NotEqual, factor, bound
+	}
 	if len(p.Cs) == 3 {
 		bound.Add(bound, big.NewInt(2)).Rsh(bound, 2)
 		factor >>= 2
@@ -483,7 +928,21 @@ func (p *Proof) ExtractStructure(index int, g *gabikeys.PublicKey) (*ProofStruct
 		(len(p.Cs) == 3 && p.A != 4) {
 		return nil, errors.New("invalid proof")
 	}
-	return newWithParams(index, p.Sign, p.A, p.K, nil, len(p.Cs), p.Ld)
+	if p.Other != nil && (p.Other.Factor == 0 || (p.Other.Proof == nil && p.Other.Index == index) ||
+		(len(p.Cs) == 3 && p.Other.Factor != 4)) {
+		return nil, errors.New("invalid proof")
+	}
+	var other *OtherAttribute
+	if p.Other != nil {
+		other = p.Other.copy()
+	}
+	if p.Sign == 0 {
+		if len(p.Cs) != 4 {
+			return nil, errors.New("invalid proof")
+		}
+		return newNotEqual(index, p.A, other, p.K, nil)
+	}
+	return newWithParams(index, p.Sign, p.A, other, p.K, nil, len(p.Cs), p.Ld)
 }
 
 // ---
@@ -493,6 +952,15 @@ func (c *proofCommit) Secret(name string) *big.Int {
 	if name == "m" {
 		return c.m
 	}
+	if name == "m2" {
+		return c.m2
+	}
+	if name == "delta" {
+		return c.delta
+	}
+	if name == "w" {
+		return c.w
+	}
 	if name == "v5" {
 		return c.v5
 	}
@@ -517,6 +985,15 @@ func (c *proofCommit) Randomizer(name string) *big.Int {
 	if name == "m" {
 		return c.mRandomizer
 	}
+	if name == "m2" {
+		return c.m2Randomizer
+	}
+	if name == "delta" {
+		return c.deltaRandomizer
+	}
+	if name == "w" {
+		return c.wRandomizer
+	}
 	if name == "v5" {
 		return c.v5Randomizer
 	}
@@ -538,6 +1015,9 @@ func (c *proofCommit) Randomizer(name string) *big.Int {
 }
 
 func (c *proofCommit) Base(name string) *big.Int {
+	if name == "Cdelta" {
+		return c.cDelta
+	}
 	if name[0] == 'C' {
 		i, err := strconv.Atoi(name[1:])
 		if err != nil || i < 0 || i >= len(c.c) {
@@ -558,10 +1038,13 @@ func (c *proofCommit) Exp(ret *big.Int, name string, exp, n *big.Int) bool {
 }
 
 func (c *proofCommit) Names() []string {
-	result := make([]string, 0, len(c.c))
+	result := make([]string, 0, len(c.c)+1)
 	for i := range c.c {
 		result = append(result, fmt.Sprintf("C%d", i))
 	}
+	if c.cDelta != nil {
+		result = append(result, "Cdelta")
+	}
 
 	return result
 }
@@ -573,6 +1056,15 @@ func (p *proof) ProofResult(name string) *big.Int {
 	if name == "m" {
 		return p.MResponse
 	}
+	if name == "m2" {
+		return p.OtherResponse
+	}
+	if name == "delta" {
+		return p.DeltaResponse
+	}
+	if name == "w" {
+		return p.WResponse
+	}
 	if name == "v5" {
 		return p.V5Response
 	}
@@ -594,6 +1086,9 @@ func (p *proof) ProofResult(name string) *big.Int {
 }
 
 func (p *proof) Base(name string) *big.Int {
+	if name == "Cdelta" {
+		return p.CDelta
+	}
 	if name[0] == 'C' {
 		i, err := strconv.Atoi(name[1:])
 		if err != nil || i < 0 || i >= len(p.Cs) {
@@ -614,10 +1109,13 @@ func (p *proof) Exp(ret *big.Int, name string, exp, n *big.Int) bool {
 }
 
 func (p *proof) Names() []string {
-	result := make([]string, 0, len(p.Cs))
+	result := make([]string, 0, len(p.Cs)+1)
 	for i := range p.Cs {
 		result = append(result, fmt.Sprintf("C%d", i))
 	}
+	if p.CDelta != nil {
+		result = append(result, "Cdelta")
+	}
 
 	return result
 }
@@ -336,3 +336,173 @@ func TestVerifyProofStructure(t *testing.T) {
 	proof.VResponses = append(proof.VResponses, backup)
 	assert.True(t, s.VerifyProofStructure(g, proof))
 }
+
+func testNotEqualProof(t *testing.T, m, k *big.Int) {
+	g := setupPubkey(t)
+
+	statement, err := rangeproof.NewStatement(rangeproof.NotEqual, k)
+	require.NoError(t, err)
+	s, err := statement.ProofStructure(1)
+	require.NoError(t, err)
+
+	mRandomizer, err := common.RandomBigInt(g.Params.Lm + g.Params.Lh + g.Params.Lstatzk)
+	require.NoError(t, err)
+
+	secretList, commit, err := s.CommitmentsFromSecrets(g, m, mRandomizer)
+	require.NoError(t, err)
+	proof := s.BuildProof(commit, big.NewInt(1234567))
+	assert.True(t, s.VerifyProofStructure(g, proof))
+	assert.True(t, proof.Proves(statement))
+	assert.False(t, proof.ProvesStatement(1, 1, k))
+	proofList := s.CommitmentsFromProof(g, proof, big.NewInt(1234567))
+	assert.Equal(t, secretList, proofList)
+
+	s, err = proof.ExtractStructure(1, g)
+	require.NoError(t, err)
+	assert.True(t, s.VerifyProofStructure(g, proof))
+	proofList = s.CommitmentsFromProof(g, proof, big.NewInt(1234567))
+	assert.Equal(t, secretList, proofList)
+
+	typ, factor, bound := proof.ProvenStatement()
+	assert.Equal(t, rangeproof.NotEqual, typ)
+	assert.Equal(t, uint(1), factor)
+	assert.Equal(t, k, bound)
+}
+
+func TestNotEqualProof(t *testing.T) {
+	testNotEqualProof(t, big.NewInt(112), big.NewInt(45))
+	testNotEqualProof(t, big.NewInt(45), big.NewInt(112))
+	testNotEqualProof(t, big.NewInt(112), big.NewInt(111))
+	testNotEqualProof(t, big.NewInt(112), big.NewInt(113))
+	testNotEqualProof(t, big.NewInt(0), big.NewInt(1))
+
+	g := setupPubkey(t)
+	m, err := common.RandomBigInt(g.Params.Lm)
+	require.NoError(t, err)
+	testNotEqualProof(t, m, big.NewInt(3))
+	testNotEqualProof(t, big.NewInt(3), m)
+}
+
+func TestNotEqualProofInvalidStatement(t *testing.T) {
+	g := setupPubkey(t)
+
+	s, err := rangeproof.NewProofStructure(1, 0, 1, big.NewInt(112), nil)
+	require.NoError(t, err)
+
+	m := big.NewInt(112)
+	mRandomizer, err := common.RandomBigInt(g.Params.Lm + g.Params.Lh + g.Params.Lstatzk)
+	require.NoError(t, err)
+
+	_, _, err = s.CommitmentsFromSecrets(g, m, mRandomizer)
+	assert.Equal(t, rangeproof.ErrFalseStatement, err)
+
+	_, err = rangeproof.NewProofStructure(1, 0, 1, big.NewInt(112), &bruteForce3{})
+	assert.Equal(t, rangeproof.ErrUnsupportedSplitter, err)
+	_, err = rangeproof.NewProofStructure(1, 0, 0, big.NewInt(112), nil)
+	assert.Error(t, err)
+}
+
+func TestNotEqualProofTampered(t *testing.T) {
+	g := setupPubkey(t)
+
+	s, err := rangeproof.NewProofStructure(1, 0, 1, big.NewInt(45), nil)
+	require.NoError(t, err)
+
+	mRandomizer, err := common.RandomBigInt(g.Params.Lm + g.Params.Lh + g.Params.Lstatzk)
+	require.NoError(t, err)
+
+	secretList, commit, err := s.CommitmentsFromSecrets(g, big.NewInt(112), mRandomizer)
+	require.NoError(t, err)
+
+	proof := s.BuildProof(commit, big.NewInt(1234567))
+	proof.K = big.NewInt(46)
+	s2, err := proof.ExtractStructure(1, g)
+	require.NoError(t, err)
+	assert.NotEqual(t, secretList, s2.CommitmentsFromProof(g, proof, big.NewInt(1234567)))
+
+	proof = s.BuildProof(commit, big.NewInt(1234567))
+	proof.CDelta = nil
+	assert.False(t, s.VerifyProofStructure(g, proof))
+
+	proof = s.BuildProof(commit, big.NewInt(1234567))
+	proof.Cs = proof.Cs[:3]
+	_, err = proof.ExtractStructure(1, g)
+	assert.Error(t, err)
+}
+
+func testRelationProof(t *testing.T, s *rangeproof.ProofStructure, m, m2 *big.Int) {
+	g := setupPubkey(t)
+
+	mRandomizer, err := common.RandomBigInt(g.Params.Lm + g.Params.Lh + g.Params.Lstatzk)
+	require.NoError(t, err)
+	m2Randomizer, err := common.RandomBigInt(g.Params.Lm + g.Params.Lh + g.Params.Lstatzk)
+	require.NoError(t, err)
+
+	_, _, err = s.CommitmentsFromSecrets(g, m, mRandomizer)
+	assert.Error(t, err)
+
+	secretList, commit, err := s.CommitmentsFromSecretsWithOther(g, m, mRandomizer, m2, m2Randomizer)
+	require.NoError(t, err)
+	proof := s.BuildProof(commit, big.NewInt(1234567))
+	assert.True(t, s.VerifyProofStructure(g, proof))
+	proofList := s.CommitmentsFromProof(g, proof, big.NewInt(1234567))
+	assert.Equal(t, secretList, proofList)
+
+	s2, err := proof.ExtractStructure(1, g)
+	require.NoError(t, err)
+	assert.Equal(t, s.OtherAttribute(), s2.OtherAttribute())
+	assert.True(t, s2.VerifyProofStructure(g, proof))
+	assert.Equal(t, secretList, s2.CommitmentsFromProof(g, proof, big.NewInt(1234567)))
+
+	// The proof must be bound to the response of the other attribute
+	proof.OtherResponse.Add(proof.OtherResponse, big.NewInt(1))
+	assert.NotEqual(t, secretList, s2.CommitmentsFromProof(g, proof, big.NewInt(1234567)))
+	proof.OtherResponse = nil
+	assert.False(t, s2.VerifyProofStructure(g, proof))
+}
+
+func TestRelationProof(t *testing.T) {
+	for _, split := range []rangeproof.SquareSplitter{&bruteForce3{}, &bruteForce4{}, nil} {
+		s, err := rangeproof.NewRelationProofStructure(1, 1, 1, &rangeproof.OtherAttribute{Index: 2, Factor: 1}, big.NewInt(45), split)
+		require.NoError(t, err)
+		testRelationProof(t, s, big.NewInt(112), big.NewInt(50))
+	}
+
+	s, err := rangeproof.NewRelationProofStructure(1, -1, 1, &rangeproof.OtherAttribute{Index: 2, Factor: 2}, big.NewInt(-45), nil)
+	require.NoError(t, err)
+	testRelationProof(t, s, big.NewInt(112), big.NewInt(100))
+
+	s, err = rangeproof.NewRelationProofStructure(1, 0, 1, &rangeproof.OtherAttribute{Index: 2, Factor: 1}, big.NewInt(0), nil)
+	require.NoError(t, err)
+	testRelationProof(t, s, big.NewInt(112), big.NewInt(111))
+}
+
+func TestRelationProofStatement(t *testing.T) {
+	g := setupPubkey(t)
+
+	statement, err := rangeproof.NewRelationStatement(rangeproof.GreaterOrEqual, 2, big.NewInt(45))
+	require.NoError(t, err)
+	s, err := statement.ProofStructure(1)
+	require.NoError(t, err)
+
+	mRandomizer, err := common.RandomBigInt(g.Params.Lm + g.Params.Lh + g.Params.Lstatzk)
+	require.NoError(t, err)
+
+	_, _, err = s.CommitmentsFromSecretsWithOther(g, big.NewInt(112), mRandomizer, big.NewInt(100), mRandomizer)
+	assert.Equal(t, rangeproof.ErrFalseStatement, err)
+
+	_, commit, err := s.CommitmentsFromSecretsWithOther(g, big.NewInt(112), mRandomizer, big.NewInt(50), mRandomizer)
+	require.NoError(t, err)
+	proof := s.BuildProof(commit, big.NewInt(1234567))
+	assert.True(t, proof.Proves(statement))
+	assert.False(t, proof.ProvesStatement(1, 1, big.NewInt(45)))
+	assert.False(t, proof.Proves(&rangeproof.Statement{Sign: 1, Factor: 1, Bound: big.NewInt(45)}))
+	assert.False(t, proof.Proves(&rangeproof.Statement{Sign: 1, Factor: 1, Bound: big.NewInt(45),
+		Other: &rangeproof.OtherAttribute{Index: 3, Factor: 1}}))
+	assert.Equal(t, statement.Other, proof.ProvenOtherAttribute())
+
+	_, err = rangeproof.NewRelationProofStructure(1, 1, 1, &rangeproof.OtherAttribute{Index: 1, Factor: 1}, big.NewInt(45), nil)
+	assert.Error(t, err)
+	_, err = rangeproof.NewRelationProofStructure(1, 1, 1, &rangeproof.OtherAttribute{Index: 2, Factor: 2}, big.NewInt(45), &bruteForce3{})
+	assert.Error(t, err)
+}
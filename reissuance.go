@@ -0,0 +1,176 @@
+package gabi
+
+import (
+	"io"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/revocation"
+)
+
+// ReissuanceBuilder creates the messages of the user in a re-issuance session, in which the user
+// obtains a new signature on the attributes of a credential under another public key of the issuer
+// (e.g., after the issuer rotated its key, or when the credential nears expiry), without disclosing
+// the attributes to the issuer.
+//
+// The user proves possession of the credential with a ProofD that discloses none of its attributes,
+// and includes all attributes in the commitment U to the new credential, whose ProofU proves that
+// they equal those of the ProofD (see CredentialBuilder.CarryOverAttribute()). The issuer verifies
+// this and signs U using Issuer.ReissueSignature().
+//
+// If nonrevocation is proven for the credential, its revocation attribute is not carried over,
+// but replaced by the revocation attribute of a new nonrevocation witness from the issuer.
+type ReissuanceBuilder struct {
+	attributes int
+	revIndex   int // Index of the revocation attribute that is not carried over, or -1
+	disclosure *DisclosureProofBuilder
+	builder    *CredentialBuilder
+}
+
+// NewReissuanceBuilder creates a builder for the re-issuance of the credential under the specified
+// public key, optionally proving nonrevocation of the credential.
+func NewReissuanceBuilder(cred *Credential, pk *gabikeys.PublicKey, context, nonce2 *big.Int, nonrev bool) (*ReissuanceBuilder, error) {
+	return NewReissuanceBuilderWithRand(nil, cred, pk, context, nonce2, nonrev)
+}
+
+// NewReissuanceBuilderWithRand creates a builder like NewReissuanceBuilder(), using the specified
+// source of randomness (if nil, crypto/rand is used).
+func NewReissuanceBuilderWithRand(
+	random io.Reader, cred *Credential, pk *gabikeys.PublicKey, context, nonce2 *big.Int, nonrev bool,
+) (*ReissuanceBuilder, error) {
+	if len(cred.Attributes) > len(pk.R) {
+		return nil, errors.New("public key does not support enough attributes")
+	}
+	revIndex := -1
+	if nonrev {
+		var err error
+		if revIndex, err = cred.NonrevIndex(); err != nil {
+			return nil, err
+		}
+	}
+
+	disclosure, err := cred.CreateDisclosureProofBuilderWithRand(random, nil, nil, nonrev)
+	if err != nil {
+		return nil, err
+	}
+	builder, err := NewCredentialBuilderWithRand(random, pk, context, cred.Attributes[0], nonce2, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(cred.Attributes); i++ {
+		if i == revIndex {
+			continue
+		}
+		if err = builder.CarryOverAttribute(i-1, disclosure, i); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ReissuanceBuilder{
+		attributes: len(cred.Attributes),
+		revIndex:   revIndex,
+		disclosure: disclosure,
+		builder:    builder,
+	}, nil
+}
+
+// Builders returns the proof builders of the ProofD and the ProofU, e.g. for merging the
+// commitments of a keyshare server into them.
+func (b *ReissuanceBuilder) Builders() ProofBuilderList {
+	return ProofBuilderList{b.disclosure, b.builder}
+}
+
+// CommitToSecretAndProve creates the IssueCommitmentMessage containing the ProofD and the ProofU,
+// in response to the nonce of the issuer.
+func (b *ReissuanceBuilder) CommitToSecretAndProve(nonce1 *big.Int) (*IssueCommitmentMessage, error) {
+	proofs, err := b.Builders().BuildProofList(b.builder.context, nonce1, false)
+	if err != nil {
+		return nil, err
+	}
+	return b.builder.CreateIssueCommitmentMessage(proofs), nil
+}
+
+// ConstructCredential creates the new credential using the IssueSignatureMessage from the issuer.
+func (b *ReissuanceBuilder) ConstructCredential(msg *IssueSignatureMessage) (*Credential, error) {
+	attributes := make([]*big.Int, b.attributes-1)
+	if b.revIndex >= 0 {
+		if msg.NonRevocationWitness == nil {
+			return nil, errors.New("missing nonrevocation witness")
+		}
+		attributes[b.revIndex-1] = msg.NonRevocationWitness.E
+	}
+	return b.builder.ConstructCredential(msg, attributes)
+}
+
+// ReissueSignature verifies the IssueCommitmentMessage of a re-issuance session (see
+// ReissuanceBuilder) against the nonce, in which the user proves possession of a credential under
+// oldPk, and signs the same attributes under the public key of the issuer. If the user proved
+// nonrevocation of the credential, then witness must be a new nonrevocation witness whose
+// revocation attribute replaces that of the credential, and nil otherwise. Checking that the
+// accumulator used in the nonrevocation proof is sufficiently recent is left to the caller.
+func (i *Issuer) ReissueSignature(
+	msg *IssueCommitmentMessage, oldPk *gabikeys.PublicKey, nonce1 *big.Int, witness *revocation.Witness,
+) (*IssueSignatureMessage, error) {
+	if len(msg.Proofs) != 2 {
+		return nil, errors.New("re-issuance requires a ProofD and a ProofU")
+	}
+	proofd, ok := msg.Proofs[0].(*ProofD)
+	if !ok {
+		return nil, errors.New("first proof of re-issuance must be a ProofD")
+	}
+	proofu, ok := msg.Proofs[1].(*ProofU)
+	if !ok {
+		return nil, errors.New("second proof of re-issuance must be a ProofU")
+	}
+	if msg.U != nil && msg.U.Cmp(proofu.U) != 0 {
+		return nil, errors.New("commitment differs from ProofU")
+	}
+
+	// All attributes must be undisclosed, and carried over to the same index except for the
+	// revocation attribute
+	if len(proofd.ADisclosed) > 0 {
+		return nil, errors.New("attributes must not be disclosed in re-issuance")
+	}
+	count := len(proofd.AResponses)
+	if count > len(i.Pk.R) {
+		return nil, errors.New("public key does not support enough attributes")
+	}
+	revIndex := -1
+	if proofd.HasNonRevocationProof() {
+		if witness == nil {
+			return nil, errors.New("nonrevocation witness required")
+		}
+		revIndex = proofd.revocationAttrIndex()
+	} else if witness != nil {
+		return nil, errors.New("nonrevocation witness given but nonrevocation not proven")
+	}
+	var carried []int
+	for j := 0; j < count; j++ {
+		if proofd.AResponses[j] == nil {
+			return nil, errors.New("missing attribute in ProofD")
+		}
+		if j == 0 || j == revIndex {
+			continue
+		}
+		if ref, ok := proofu.CarriedAttributes[j]; !ok || ref != (AttributeRef{Proof: 0, Attribute: j}) {
+			return nil, errors.Errorf("attribute %d not carried over", j)
+		}
+		carried = append(carried, j-1)
+	}
+	if len(proofu.CarriedAttributes) != len(carried) {
+		return nil, errors.New("unexpected carried over attributes")
+	}
+
+	if err := msg.Proofs.VerifyDetailed(
+		[]*gabikeys.PublicKey{oldPk, i.Pk}, i.Context, nonce1, false, nil, nil,
+	); err != nil {
+		return nil, err
+	}
+
+	attributes := make([]*big.Int, count-1)
+	if revIndex > 0 {
+		attributes[revIndex-1] = witness.E
+	}
+	return i.IssueSignatureWithCarriedAttributes(proofu, attributes, witness, msg.Nonce2, nil, carried)
+}
@@ -68,6 +68,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
 	"time"
 
@@ -156,6 +157,13 @@ const (
 var Logger *logrus.Logger
 
 func NewAccumulator(sk *gabikeys.PrivateKey) (*Update, error) {
+	return NewAccumulatorWithRand(nil, sk)
+}
+
+// NewAccumulatorWithRand creates a new accumulator like NewAccumulator(), choosing its initial
+// value using the specified source of randomness (if nil, a fast CPRNG seeded from crypto/rand is
+// used).
+func NewAccumulatorWithRand(random io.Reader, sk *gabikeys.PrivateKey) (*Update, error) {
 	empty := [32]byte{}
 	emptyhash, err := multihash.Encode(empty[:], HashAlgorithm)
 	initialEvent := &Event{
@@ -168,7 +176,7 @@ func NewAccumulator(sk *gabikeys.PrivateKey) (*Update, error) {
 	}
 	acc := &Accumulator{
 		Index:     0,
-		Nu:        common.RandomQR(sk.N),
+		Nu:        common.RandomQRFrom(random, sk.N),
 		Time:      time.Now().Unix(),
 		EventHash: initialEvent.hash(),
 	}
@@ -191,6 +199,35 @@ func (acc *Accumulator) Sign(sk *gabikeys.PrivateKey) (*SignedAccumulator, error
 	return &SignedAccumulator{Data: sig, PKCounter: sk.Counter, Accumulator: acc}, nil
 }
 
+// legacyAccumulator is the CBOR encoding of Accumulator. Unlike big.Int itself, which encodes to
+// a CBOR bignum, it encodes Nu as an untagged byte string, so that accumulators are signed in the
+// same encoding as before big.Int supported CBOR bignums.
+type legacyAccumulator struct {
+	Nu        []byte
+	Index     uint64
+	Time      int64
+	EventHash Hash
+}
+
+// MarshalCBOR implements cbor.Marshaler, see legacyAccumulator.
+func (acc *Accumulator) MarshalCBOR() ([]byte, error) {
+	return cbor.Marshal(&legacyAccumulator{
+		Nu:        legacyBytes(acc.Nu),
+		Index:     acc.Index,
+		Time:      acc.Time,
+		EventHash: acc.EventHash,
+	}, cbor.EncOptions{})
+}
+
+// legacyBytes returns the byte string to which i was encoded in CBOR before big.Int supported
+// CBOR bignums. The result is nil if i is, so that it encodes to null.
+func legacyBytes(i *big.Int) []byte {
+	if i == nil {
+		return nil
+	}
+	return i.Bytes()
+}
+
 // Remove generates a new accumulator with the specified e removed from it.
 func (acc *Accumulator) Remove(sk *gabikeys.PrivateKey, e *big.Int, parent *Event) (*Accumulator, *Event, error) {
 	eInverse, ok := common.ModInverse(e, sk.Order)
@@ -444,8 +481,24 @@ func (el *EventList) UnmarshalJSON(bts []byte) error {
 	return nil
 }
 
+// legacyEventList is the CBOR encoding of EventList, which like legacyAccumulator encodes its
+// integers as untagged byte strings.
+type legacyEventList struct {
+	Index      uint64   `json:"i"`
+	ParentHash Hash     `json:"hash"`
+	E          [][]byte `json:"e"`
+}
+
 func (el *EventList) MarshalCBOR() ([]byte, error) {
-	return cbor.Marshal(el.compress(), cbor.EncOptions{})
+	c := el.compress()
+	legacy := &legacyEventList{Index: c.Index, ParentHash: c.ParentHash}
+	if c.E != nil {
+		legacy.E = make([][]byte, len(c.E))
+		for i, e := range c.E {
+			legacy.E[i] = legacyBytes(e)
+		}
+	}
+	return cbor.Marshal(legacy, cbor.EncOptions{})
 }
 
 func (el *EventList) UnmarshalCBOR(bts []byte) error {
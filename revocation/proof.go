@@ -1,7 +1,7 @@
 package revocation
 
 import (
-	"crypto/rand"
+	"io"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -160,12 +160,24 @@ func init() {
 // NewProofRandomizer returns a bigint suitable for use as the randomizer in a nonrevocation
 // zero knowledge proof.
 func NewProofRandomizer() *big.Int {
-	return common.FastRandomBigInt(new(big.Int).Mul(Parameters.b, Parameters.twoZk))
+	return NewProofRandomizerWithRand(nil)
+}
+
+// NewProofRandomizerWithRand returns a randomizer like NewProofRandomizer(), read from the
+// specified source of randomness (if nil, a fast CPRNG seeded from crypto/rand is used).
+func NewProofRandomizerWithRand(random io.Reader) *big.Int {
+	return common.FastRandomBigIntFrom(random, new(big.Int).Mul(Parameters.b, Parameters.twoZk))
 }
 
 // RandomWitness returns a new random Witness valid against the specified Accumulator.
 func RandomWitness(sk *gabikeys.PrivateKey, acc *Accumulator) (*Witness, error) {
-	e, err := common.RandomPrimeInRange(rand.Reader, 3, Parameters.AttributeSize)
+	return RandomWitnessWithRand(nil, sk, acc)
+}
+
+// RandomWitnessWithRand returns a new random Witness like RandomWitness(), read from the specified
+// source of randomness (if nil, crypto/rand is used).
+func RandomWitnessWithRand(random io.Reader, sk *gabikeys.PrivateKey, acc *Accumulator) (*Witness, error) {
+	e, err := common.RandomPrimeInRange(common.RandReader(random), 3, Parameters.AttributeSize)
 	if err != nil {
 		return nil, err
 	}
@@ -174,18 +186,24 @@ func RandomWitness(sk *gabikeys.PrivateKey, acc *Accumulator) (*Witness, error)
 
 // NewProofCommit performs the first move in the Schnorr zero-knowledge protocol: committing to randomizers.
 func NewProofCommit(key *gabikeys.PublicKey, witn *Witness, randomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
+	return NewProofCommitWithRand(nil, key, witn, randomizer)
+}
+
+// NewProofCommitWithRand commits to randomizers like NewProofCommit(), read from the specified
+// source of randomness (if nil, a fast CPRNG seeded from crypto/rand is used).
+func NewProofCommitWithRand(random io.Reader, key *gabikeys.PublicKey, witn *Witness, randomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
 	Logger.Tracef("revocation.NewProofCommit()")
 	defer Logger.Tracef("revocation.NewProofCommit() done")
 	witn.randomizer = randomizer
 	if randomizer == nil {
-		witn.randomizer = NewProofRandomizer()
+		witn.randomizer = NewProofRandomizerWithRand(random)
 	}
 	if !proofstructure.isTrue((*witness)(witn), witn.SignedAccumulator.Accumulator.Nu, key.N) {
 		return nil, nil, errors.New("non-revocation relation does not hold")
 	}
 
 	bases := zkproof.NewBaseMerge(key, &accumulator{Nu: witn.SignedAccumulator.Accumulator.Nu})
-	list, commit := proofstructure.commitmentsFromSecrets(key, []*big.Int{}, &bases, (*witness)(witn))
+	list, commit := proofstructure.commitmentsFromSecrets(random, key, []*big.Int{}, &bases, (*witness)(witn))
 	commit.sacc = witn.SignedAccumulator
 	return list, (*ProofCommit)(&commit), nil
 }
@@ -209,21 +227,30 @@ func (p *Proof) ChallengeContributions(key *gabikeys.PublicKey) []*big.Int {
 }
 
 func (p *Proof) VerifyWithChallenge(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) bool {
+	return p.VerifyWithChallengeDetailed(pk, reconstructedChallenge) == nil
+}
+
+// VerifyWithChallengeDetailed verifies the proof like VerifyWithChallenge(), returning an error
+// describing the failed check if the proof is invalid.
+func (p *Proof) VerifyWithChallengeDetailed(pk *gabikeys.PublicKey, reconstructedChallenge *big.Int) error {
 	if !proofstructure.verifyProofStructure((*proof)(p)) {
-		return false
+		return errors.New("invalid nonrevocation proof structure")
 	}
 	if (*proof)(p).ProofResult("alpha").Cmp(Parameters.bTwoZk) > 0 {
-		return false
+		return errors.New("nonrevocation response too large")
 	}
 	acc, err := p.SignedAccumulator.UnmarshalVerify(pk)
 	if err != nil {
-		return false
+		return errors.WrapPrefix(err, "invalid accumulator", 0)
 	}
 	p.acc = acc
 	if p.Nu.Cmp(p.acc.Nu) != 0 {
-		return false
+		return errors.New("nonrevocation proof does not match accumulator")
 	}
-	return p.Challenge.Cmp(reconstructedChallenge) == 0
+	if p.Challenge.Cmp(reconstructedChallenge) != 0 {
+		return errors.New("nonrevocation proof challenge mismatch")
+	}
+	return nil
 }
 
 func (c *ProofCommit) BuildProof(challenge *big.Int) *Proof {
@@ -375,7 +402,7 @@ func (p *proof) verify(pk *gabikeys.PublicKey) bool {
 	return (*Proof)(p).VerifyWithChallenge(pk, common.HashCommit(commitments, false))
 }
 
-func (s *proofStructure) commitmentsFromSecrets(g *gabikeys.PublicKey, list []*big.Int, bases zkproof.BaseLookup, secretdata zkproof.SecretLookup) ([]*big.Int, proofCommit) {
+func (s *proofStructure) commitmentsFromSecrets(random io.Reader, g *gabikeys.PublicKey, list []*big.Int, bases zkproof.BaseLookup, secretdata zkproof.SecretLookup) ([]*big.Int, proofCommit) {
 	commit := proofCommit{
 		g:           g,
 		secrets:     make(map[string]*big.Int, 5),
@@ -389,8 +416,8 @@ func (s *proofStructure) commitmentsFromSecrets(g *gabikeys.PublicKey, list []*b
 	nDiv4twoZk := new(big.Int).Mul(nDiv4, Parameters.twoZk)
 	nbDiv4twoZk := new(big.Int).Mul(nDiv4twoZk, Parameters.b)
 
-	r2 := common.FastRandomBigInt(nDiv4)
-	r3 := common.FastRandomBigInt(nDiv4)
+	r2 := common.FastRandomBigIntFrom(random, nDiv4)
+	r3 := common.FastRandomBigIntFrom(random, nDiv4)
 
 	alpha := secretdata.Secret("alpha")
 	commit.secrets["alpha"] = alpha
@@ -400,10 +427,10 @@ func (s *proofStructure) commitmentsFromSecrets(g *gabikeys.PublicKey, list []*b
 	commit.secrets["zeta"] = r3
 
 	commit.randomizers["alpha"] = secretdata.Randomizer("alpha")
-	commit.randomizers["beta"] = common.FastRandomBigInt(nbDiv4twoZk)
-	commit.randomizers["delta"] = common.FastRandomBigInt(nbDiv4twoZk)
-	commit.randomizers["epsilon"] = common.FastRandomBigInt(nDiv4twoZk)
-	commit.randomizers["zeta"] = common.FastRandomBigInt(nDiv4twoZk)
+	commit.randomizers["beta"] = common.FastRandomBigIntFrom(random, nbDiv4twoZk)
+	commit.randomizers["delta"] = common.FastRandomBigIntFrom(random, nbDiv4twoZk)
+	commit.randomizers["epsilon"] = common.FastRandomBigIntFrom(random, nDiv4twoZk)
+	commit.randomizers["zeta"] = common.FastRandomBigIntFrom(random, nDiv4twoZk)
 
 	var tmp big.Int
 
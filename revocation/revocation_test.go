@@ -1,6 +1,7 @@
 package revocation
 
 import (
+	"bytes"
 	"crypto/rand"
 	"testing"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/privacybydesign/gabi/signed"
 	"github.com/privacybydesign/gabi/zkproof"
 
+	"github.com/fxamacker/cbor"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
@@ -116,7 +118,7 @@ func testProof(t *testing.T, pk *gabikeys.PublicKey, sk *gabikeys.PrivateKey, va
 	bases := zkproof.NewBaseMerge(pk, (*accumulator)(acc))
 	require.Equal(t, valid, proofstructure.isTrue((*witness)(witn), acc.Nu, sk.N), "statement to prove ")
 
-	list, commit := proofstructure.commitmentsFromSecrets(pk, []*big.Int{}, &bases, (*witness)(witn))
+	list, commit := proofstructure.commitmentsFromSecrets(nil, pk, []*big.Int{}, &bases, (*witness)(witn))
 	challenge := common.HashCommit(list, false)
 	sacc, err := acc.Sign(sk)
 	require.NoError(t, err)
@@ -300,3 +302,30 @@ func TestUpdateVerification(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestLegacyCBOREncoding(t *testing.T) {
+	update, pk, _, acc := generateUpdate(t)
+
+	// The integers of accumulators and updates are encoded as byte strings, not as bignums
+	contains := func(bts []byte, i *big.Int) {
+		legacy, err := cbor.Marshal(i.Bytes(), cbor.EncOptions{})
+		require.NoError(t, err)
+		bignum, err := cbor.Marshal(i, cbor.EncOptions{})
+		require.NoError(t, err)
+		require.True(t, bytes.Contains(bts, legacy))
+		require.False(t, bytes.Contains(bts, bignum))
+	}
+	contains(update.SignedAccumulator.Data, acc.Nu)
+	bts, err := cbor.Marshal(update, cbor.EncOptions{})
+	require.NoError(t, err)
+	for _, event := range update.Events {
+		contains(bts, event.E)
+	}
+
+	var decoded Update
+	require.NoError(t, cbor.Unmarshal(bts, &decoded))
+	decodedAcc, err := decoded.Verify(pk)
+	require.NoError(t, err)
+	require.Equal(t, acc.Nu, decodedAcc.Nu)
+	require.Equal(t, len(update.Events), len(decoded.Events))
+}
@@ -4,9 +4,11 @@
 package safeprime
 
 import (
+	"context"
 	"crypto/rand"
 	"io"
 	"runtime"
+	"sync"
 
 	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi/big"
@@ -17,6 +19,17 @@ import (
 // until the stop channel receives a struct or is closed. If an error is encountered, generation is
 // stopped in all goroutines, and the error is sent on the second return parameter.
 func GenerateConcurrent(bitsize int, stop chan struct{}) (<-chan *big.Int, <-chan error) {
+	return generateConcurrent(bitsize, stop)
+}
+
+// GenerateConcurrentContext concurrently and continuously generates safeprimes on all CPU cores,
+// like GenerateConcurrent(), until ctx is done. The caller must cancel ctx when it has received
+// enough safeprimes, in order to release the goroutines.
+func GenerateConcurrentContext(ctx context.Context, bitsize int) (<-chan *big.Int, <-chan error) {
+	return generateConcurrent(bitsize, ctx.Done())
+}
+
+func generateConcurrent(bitsize int, stop <-chan struct{}) (<-chan *big.Int, <-chan error) {
 	count := runtime.GOMAXPROCS(0)
 	ints := make(chan *big.Int, count)
 	errs := make(chan error, count)
@@ -27,10 +40,12 @@ func GenerateConcurrent(bitsize int, stop chan struct{}) (<-chan *big.Int, <-cha
 	// this, so that we always stop all goroutines independent of whether the caller close()s stop
 	// or sends a struct{}{} to it.
 	stopped := make(chan struct{})
+	var once sync.Once
+	stopAll := func() { once.Do(func() { close(stopped) }) }
 	go func() {
 		select {
 		case <-stop:
-			close(stopped)
+			stopAll()
 		case <-stopped: // stopped can also be closed by a goroutine that encountered an error
 		}
 	}()
@@ -40,20 +55,23 @@ func GenerateConcurrent(bitsize int, stop chan struct{}) (<-chan *big.Int, <-cha
 		go func() {
 			for {
 				// Pass stopped chan along; if closed, Generate() returns nil, nil
-				x, err := Generate(bitsize, stopped)
+				x, err := generate(rand.Reader, bitsize, stopped)
 				if err != nil {
 					errs <- err
-					close(stopped)
+					stopAll()
 					return
 				}
 
-				// Only send result and continue generating if we have not been told to stop
+				if x == nil { // we have been told to stop
+					return
+				}
+
+				// Only send result and continue generating if we have not been told to stop,
+				// also while blocking on a full channel
 				select {
 				case <-stopped:
 					return
-				default:
-					ints <- x
-					continue
+				case ints <- x:
 				}
 			}
 		}()
@@ -75,6 +93,30 @@ func GenerateConcurrent(bitsize int, stop chan struct{}) (<-chan *big.Int, <-cha
 // In order to cancel the generation algorithm, send a struct{} on the stop parameter or close() it.
 // (Passing nil is allowed; then the algorithm cannot be cancelled).
 func Generate(bitsize int, stop chan struct{}) (*big.Int, error) {
+	return generate(rand.Reader, bitsize, stop)
+}
+
+// GenerateContext generates a safe prime of the given size like Generate(), returning ctx.Err()
+// if ctx is done before a safe prime is found.
+func GenerateContext(ctx context.Context, bitsize int) (*big.Int, error) {
+	return GenerateWithRand(ctx, rand.Reader, bitsize)
+}
+
+// GenerateWithRand generates a safe prime of the given size like GenerateContext(), reading the
+// candidates from the specified source of randomness (crypto/rand if nil). Given a deterministic
+// source, the result is deterministic.
+func GenerateWithRand(ctx context.Context, random io.Reader, bitsize int) (*big.Int, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	x, err := generate(random, bitsize, ctx.Done())
+	if err == nil && x == nil {
+		return nil, ctx.Err()
+	}
+	return x, err
+}
+
+func generate(random io.Reader, bitsize int, stop <-chan struct{}) (*big.Int, error) {
 	var (
 		one        = big.NewInt(1)
 		two        = big.NewInt(2)
@@ -112,7 +154,7 @@ NextCandidate:
 			}
 		}
 
-		_, err = io.ReadFull(rand.Reader, bytes)
+		_, err = io.ReadFull(random, bytes)
 		if err != nil {
 			return nil, err
 		}
@@ -3,6 +3,9 @@
 package safeprime
 
 import (
+	"context"
+	"io"
+
 	"github.com/privacybydesign/gabi/big"
 )
 
@@ -13,3 +16,15 @@ func Generate(int, chan struct{}) (*big.Int, error) {
 func GenerateConcurrent(int, chan struct{}) (<-chan *big.Int, <-chan error) {
 	panic("Safe prime generation is disabled")
 }
+
+func GenerateContext(context.Context, int) (*big.Int, error) {
+	panic("Safe prime generation is disabled")
+}
+
+func GenerateConcurrentContext(context.Context, int) (<-chan *big.Int, <-chan error) {
+	panic("Safe prime generation is disabled")
+}
+
+func GenerateWithRand(context.Context, io.Reader, int) (*big.Int, error) {
+	panic("Safe prime generation is disabled")
+}
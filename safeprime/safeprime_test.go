@@ -1,6 +1,7 @@
 package safeprime
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -47,3 +48,27 @@ func TestGenerateConcurrent(t *testing.T) {
 
 	require.NotZero(t, count)
 }
+
+func TestGenerateContext(t *testing.T) {
+	x, err := GenerateContext(context.Background(), 256)
+	require.NoError(t, err)
+	require.True(t, ProbablySafePrime(x, 40), "Generated number was not a safe prime")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	x, err = GenerateContext(ctx, 8192)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Nil(t, x)
+}
+
+func TestGenerateConcurrentContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ints, errs := GenerateConcurrentContext(ctx, 64)
+	select {
+	case x := <-ints:
+		require.True(t, ProbablySafePrime(x, 40))
+	case err := <-errs:
+		require.NoError(t, err)
+	}
+	cancel()
+}
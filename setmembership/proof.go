@@ -0,0 +1,475 @@
+package setmembership
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+	"github.com/privacybydesign/gabi/zkproof"
+
+	"github.com/go-errors/errors"
+)
+
+/*
+This subpackage of gabi implements proofs that an undisclosed attribute m is an element of a public
+set {v_1, ..., v_n}, without revealing which element it is.
+
+The prover shows that the polynomial P(x) = \product_i (x - v_i) vanishes in m, by committing to the
+partial products P_j = \product_{i<=j} (m - v_i) and proving that each commitment is the previous one
+raised to the power (m - v_j). Writing P_0 = 1, this results in the following substatements:
+
+    D_0 R^(-1) = S^(r_0)
+    D_j D_(j-1)^(v_j) = D_(j-1)^m S^(s_j)        for 1 <= j < n
+    D_(n-1)^(v_n) = D_(n-1)^m S^(s_n)
+
+where
+- m is the attribute value, bound to the attribute through its response in the disclosure proof,
+- D_j = R^(P_j) S^(r_j) are commitments to the partial products P_j,
+- r_j are computational hiders for the P_j,
+- s_j = r_j - r_(j-1)*(m - v_j), and s_n = -r_(n-1)*(m - v_n).
+
+Unrolling the substatements gives R^(P_n) = S^b for some b known to the prover. Along the lines of the
+soundness proof for the range proofs in the rangeproof subpackage, a prover that succeeds for P_n != 0
+(i.e. for m not in the set) can be used to break the strong RSA assumption.
+
+Since the s_j may be negative, the randomizers for the s_j are offset by 2^(l_s+l_h), such that all
+responses are positive (and hence can be serialized) while remaining statistically hiding.
+*/
+
+type (
+	// Statement states that an attribute is an element of Set.
+	Statement struct {
+		Set []*big.Int
+	}
+
+	ProofStructure struct {
+		pCorrect []zkproof.QrRepresentationProofStructure
+		d0       zkproof.QrRepresentationProofStructure
+
+		index int
+		set   []*big.Int
+	}
+
+	Proof struct {
+		// Actual proof responses
+		Ds         []*big.Int `json:"Ds"`
+		R0Response *big.Int   `json:"r0"`
+		SResponses []*big.Int `json:"ss"`
+		MResponse  *big.Int   `json:"-"`
+
+		// Proof structure description
+		Set []*big.Int `json:"set"`
+	}
+
+	ProofCommit struct {
+		// Bases
+		d []*big.Int
+
+		// Secrets
+		r0           *big.Int
+		r0Randomizer *big.Int
+		s            []*big.Int
+		sRandomizers []*big.Int
+		m            *big.Int
+		mRandomizer  *big.Int
+	}
+
+	proof       Proof
+	proofCommit ProofCommit
+)
+
+// MaxSetSize is the maximum amount of elements of a set in a membership statement.
+const MaxSetSize = 256
+
+var (
+	ErrFalseStatement = errors.New("attribute is not an element of the set")
+	ErrInvalidSet     = errors.New("invalid set: must be nonempty, contain at most MaxSetSize elements, and contain only nonnegative elements")
+)
+
+// NewStatement returns a statement that an attribute is an element of the specified set.
+func NewStatement(set []*big.Int) (*Statement, error) {
+	if err := checkSet(set, 0); err != nil {
+		return nil, err
+	}
+	return &Statement{Set: copySet(set)}, nil
+}
+
+func checkSet(set []*big.Int, lm uint) error {
+	if len(set) == 0 || len(set) > MaxSetSize {
+		return ErrInvalidSet
+	}
+	for _, v := range set {
+		if v == nil || v.Sign() < 0 || (lm != 0 && uint(v.BitLen()) > lm) {
+			return ErrInvalidSet
+		}
+	}
+	return nil
+}
+
+func copySet(set []*big.Int) []*big.Int {
+	result := make([]*big.Int, len(set))
+	for i, v := range set {
+		result[i] = new(big.Int).Set(v)
+	}
+	return result
+}
+
+// Create a new proof structure for proving that the attribute at the specified index is an element
+// of the specified set.
+func NewProofStructure(index int, set []*big.Int) (*ProofStructure, error) {
+	if err := checkSet(set, 0); err != nil {
+		return nil, err
+	}
+
+	n := len(set)
+	result := &ProofStructure{
+		d0: zkproof.QrRepresentationProofStructure{
+			Lhs: []zkproof.LhsContribution{
+				{Base: "D0", Power: big.NewInt(1)},
+				{Base: fmt.Sprintf("R%d", index), Power: big.NewInt(-1)},
+			},
+			Rhs: []zkproof.RhsContribution{
+				{Base: "S", Secret: "r0", Power: 1},
+			},
+		},
+
+		index: index,
+		set:   copySet(set),
+	}
+
+	for j := 1; j <= n; j++ {
+		var lhs []zkproof.LhsContribution
+		if j < n {
+			lhs = append(lhs, zkproof.LhsContribution{Base: fmt.Sprintf("D%d", j), Power: big.NewInt(1)})
+		}
+		lhs = append(lhs, zkproof.LhsContribution{Base: fmt.Sprintf("D%d", j-1), Power: result.set[j-1]})
+		result.pCorrect = append(result.pCorrect, zkproof.QrRepresentationProofStructure{
+			Lhs: lhs,
+			Rhs: []zkproof.RhsContribution{
+				{Base: fmt.Sprintf("D%d", j-1), Secret: "m", Power: 1},
+				{Base: "S", Secret: fmt.Sprintf("s%d", j), Power: 1},
+			},
+		})
+	}
+
+	return result, nil
+}
+
+func (statement *Statement) ProofStructure(index int) (*ProofStructure, error) {
+	return NewProofStructure(index, statement.Set)
+}
+
+// ls returns the bitsize of the s_j.
+func ls(g *gabikeys.PublicKey) uint {
+	return 2*g.Params.Lm + 1
+}
+
+func (s *ProofStructure) CommitmentsFromSecrets(g *gabikeys.PublicKey, m, mRandomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
+	return s.CommitmentsFromSecretsWithRand(nil, g, m, mRandomizer)
+}
+
+// CommitmentsFromSecretsWithRand is like CommitmentsFromSecrets, reading the randomness of the
+// commitments from the specified source (if nil, crypto/rand is used).
+func (s *ProofStructure) CommitmentsFromSecretsWithRand(random io.Reader, g *gabikeys.PublicKey, m, mRandomizer *big.Int) ([]*big.Int, *ProofCommit, error) {
+	var err error
+
+	member := false
+	for _, v := range s.set {
+		if v.Cmp(m) == 0 {
+			member = true
+			break
+		}
+	}
+	if !member {
+		return nil, nil, ErrFalseStatement
+	}
+
+	n := len(s.set)
+	commit := &proofCommit{
+		m:           m,
+		mRandomizer: mRandomizer,
+	}
+
+	// Generate hiders r_j for the partial products, and r_0's randomizer
+	r := make([]*big.Int, n)
+	for j := range r {
+		r[j], err = common.RandomBigIntFrom(random, g.Params.Lm)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	commit.r0 = r[0]
+	commit.r0Randomizer, err = common.RandomBigIntFrom(random, g.Params.Lm+g.Params.Lh+g.Params.Lstatzk)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Calculate the partial products, the bases, and the s_j with their randomizers
+	offset := new(big.Int).Lsh(big.NewInt(1), ls(g)+g.Params.Lh)
+	p := big.NewInt(1)
+	commit.d = make([]*big.Int, n)
+	commit.s = make([]*big.Int, n)
+	commit.sRandomizers = make([]*big.Int, n)
+	for j := 0; j < n; j++ {
+		commit.d[j] = g.ExpModN(g.R[s.index], p)
+		commit.d[j].Mul(commit.d[j], g.ExpModN(g.S, r[j]))
+		commit.d[j].Mod(commit.d[j], g.N)
+
+		diff := new(big.Int).Sub(m, s.set[j])
+		p.Mul(p, diff)
+
+		// s_(j+1) = r_(j+1) - r_j*(m - v_(j+1)), where r_n = 0
+		commit.s[j] = new(big.Int).Mul(r[j], diff)
+		commit.s[j].Neg(commit.s[j])
+		if j+1 < n {
+			commit.s[j].Add(commit.s[j], r[j+1])
+		}
+
+		commit.sRandomizers[j], err = common.RandomBigIntFrom(random, ls(g)+g.Params.Lh+g.Params.Lstatzk)
+		if err != nil {
+			return nil, nil, err
+		}
+		commit.sRandomizers[j].Add(commit.sRandomizers[j], offset)
+	}
+
+	bases := zkproof.NewBaseMerge(g, commit)
+
+	var contributions []*big.Int
+	contributions = s.d0.CommitmentsFromSecrets(g, contributions, &bases, commit)
+	for i := range s.pCorrect {
+		contributions = s.pCorrect[i].CommitmentsFromSecrets(g, contributions, &bases, commit)
+	}
+
+	return contributions, (*ProofCommit)(commit), nil
+}
+
+func (s *ProofStructure) BuildProof(commit *ProofCommit, challenge *big.Int) *Proof {
+	result := &Proof{
+		Ds:         make([]*big.Int, len(commit.d)),
+		R0Response: new(big.Int).Add(new(big.Int).Mul(challenge, commit.r0), commit.r0Randomizer),
+		SResponses: make([]*big.Int, len(commit.s)),
+		MResponse:  new(big.Int).Add(new(big.Int).Mul(challenge, commit.m), commit.mRandomizer),
+
+		Set: copySet(s.set),
+	}
+
+	for i := range commit.d {
+		result.Ds[i] = new(big.Int).Set(commit.d[i])
+	}
+	for i := range commit.s {
+		result.SResponses[i] = new(big.Int).Add(new(big.Int).Mul(challenge, commit.s[i]), commit.sRandomizers[i])
+	}
+
+	return result
+}
+
+func (s *ProofStructure) VerifyProofStructure(g *gabikeys.PublicKey, p *Proof) bool {
+	if len(s.set) != len(p.Ds) || len(s.set) != len(p.SResponses) {
+		return false
+	}
+
+	if p.R0Response == nil || p.MResponse == nil {
+		return false
+	}
+
+	if p.R0Response.Sign() < 0 || p.MResponse.Sign() < 0 ||
+		uint(p.R0Response.BitLen()) > g.Params.Lm+g.Params.Lh+g.Params.Lstatzk+1 ||
+		uint(p.MResponse.BitLen()) > g.Params.Lm+g.Params.Lh+g.Params.Lstatzk+1 {
+		return false
+	}
+
+	for i := range s.set {
+		if p.Ds[i] == nil || p.SResponses[i] == nil {
+			return false
+		}
+
+		if p.Ds[i].BitLen() > g.N.BitLen() ||
+			p.SResponses[i].Sign() < 0 ||
+			uint(p.SResponses[i].BitLen()) > ls(g)+g.Params.Lh+g.Params.Lstatzk+1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *ProofStructure) CommitmentsFromProof(g *gabikeys.PublicKey, p *Proof, challenge *big.Int) []*big.Int {
+	bases := zkproof.NewBaseMerge(g, (*proof)(p))
+
+	var contributions []*big.Int
+	contributions = s.d0.CommitmentsFromProof(g, contributions, challenge, &bases, (*proof)(p))
+	for i := range s.pCorrect {
+		contributions = s.pCorrect[i].CommitmentsFromProof(g, contributions, challenge, &bases, (*proof)(p))
+	}
+
+	return contributions
+}
+
+// ProvesSet returns whether the Proof proves that the attribute is an element of the specified set.
+// The order of the elements is irrelevant.
+func (p *Proof) ProvesSet(set []*big.Int) bool {
+	if len(p.Set) != len(set) {
+		return false
+	}
+	a, b := sortedSet(p.Set), sortedSet(set)
+	for i := range a {
+		if a[i] == nil || b[i] == nil || a[i].Cmp(b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Proves returns whether the Proof proves the specified statement.
+func (p *Proof) Proves(statement *Statement) bool {
+	return p.ProvesSet(statement.Set)
+}
+
+// ProvenStatement returns the statement that this proof proves.
+//
+// NB: this method does not verify the proof. Do not trust the output unless proof.Verify() has been
+// invoked first.
+func (p *Proof) ProvenStatement() *Statement {
+	return &Statement{Set: copySet(p.Set)}
+}
+
+func sortedSet(set []*big.Int) []*big.Int {
+	result := make([]*big.Int, len(set))
+	copy(result, set)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i] == nil || result[j] == nil {
+			return result[j] != nil
+		}
+		return result[i].Cmp(result[j]) < 0
+	})
+	return result
+}
+
+// Extract proof structure from proof
+func (p *Proof) ExtractStructure(index int, g *gabikeys.PublicKey) (*ProofStructure, error) {
+	// Set elements larger than 2^lm can never equal an attribute, and bigger sets would allow
+	// a prover to make the verifier perform an unbounded amount of work
+	if err := checkSet(p.Set, g.Params.Lm); err != nil {
+		return nil, errors.New("invalid proof")
+	}
+	return NewProofStructure(index, p.Set)
+}
+
+// ---
+// Commit structure keyproof interfaces
+// ---
+func (c *proofCommit) Secret(name string) *big.Int {
+	if name == "m" {
+		return c.m
+	}
+	if name == "r0" {
+		return c.r0
+	}
+	if name[0] == 's' {
+		i, err := strconv.Atoi(name[1:])
+		if err != nil || i < 1 || i > len(c.s) {
+			return nil
+		}
+		return c.s[i-1]
+	}
+	return nil
+}
+
+func (c *proofCommit) Randomizer(name string) *big.Int {
+	if name == "m" {
+		return c.mRandomizer
+	}
+	if name == "r0" {
+		return c.r0Randomizer
+	}
+	if name[0] == 's' {
+		i, err := strconv.Atoi(name[1:])
+		if err != nil || i < 1 || i > len(c.sRandomizers) {
+			return nil
+		}
+		return c.sRandomizers[i-1]
+	}
+	return nil
+}
+
+func (c *proofCommit) Base(name string) *big.Int {
+	if name[0] == 'D' {
+		i, err := strconv.Atoi(name[1:])
+		if err != nil || i < 0 || i >= len(c.d) {
+			return nil
+		}
+		return c.d[i]
+	}
+	return nil
+}
+
+func (c *proofCommit) Exp(ret *big.Int, name string, exp, n *big.Int) bool {
+	base := c.Base(name)
+	if base == nil {
+		return false
+	}
+	ret.Exp(base, exp, n)
+	return true
+}
+
+func (c *proofCommit) Names() []string {
+	result := make([]string, 0, len(c.d))
+	for i := range c.d {
+		result = append(result, fmt.Sprintf("D%d", i))
+	}
+
+	return result
+}
+
+// ---
+// Proof structure keyproof interfaces
+// ---
+func (p *proof) ProofResult(name string) *big.Int {
+	if name == "m" {
+		return p.MResponse
+	}
+	if name == "r0" {
+		return p.R0Response
+	}
+	if name[0] == 's' {
+		i, err := strconv.Atoi(name[1:])
+		if err != nil || i < 1 || i > len(p.SResponses) {
+			return nil
+		}
+		return p.SResponses[i-1]
+	}
+	return nil
+}
+
+func (p *proof) Base(name string) *big.Int {
+	if name[0] == 'D' {
+		i, err := strconv.Atoi(name[1:])
+		if err != nil || i < 0 || i >= len(p.Ds) {
+			return nil
+		}
+		return p.Ds[i]
+	}
+	return nil
+}
+
+func (p *proof) Exp(ret *big.Int, name string, exp, n *big.Int) bool {
+	base := p.Base(name)
+	if base == nil {
+		return false
+	}
+	ret.Exp(base, exp, n)
+	return true
+}
+
+func (p *proof) Names() []string {
+	result := make([]string, 0, len(p.Ds))
+	for i := range p.Ds {
+		result = append(result, fmt.Sprintf("D%d", i))
+	}
+
+	return result
+}
@@ -0,0 +1,400 @@
+package gabi
+
+import (
+	"sync"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/internal/common"
+)
+
+// Show tags limit how often a credential can be shown within a scope (e.g. a verifier) and an
+// epoch (e.g. a day), while keeping the showings unlinkable as long as the limit is respected.
+//
+// When showing a credential for the j-th time within the scope and epoch, the holder includes in
+// the ProofD the tag T = g^{1/(sk + s + j + 1)} in the prime order subgroup of the domain pseudonym
+// group, where sk is the secret key, s is an undisclosed attribute that is unique to the credential
+// (e.g. a random serial number chosen by the issuer), and g is derived from the scope and epoch
+// (see ShowTagGenerator()). The limit k is a disclosed attribute of the credential, so that it is
+// set by the issuer instead of the verifier. The counter j is hidden in a Pedersen commitment
+// C = h1^j h2^r, and the ProofD proves that:
+//
+//	T^{sk + s + j} = g T^{-1}               (binding the tag to the secret key and the serial)
+//	C = h1^j h2^r                           (binding the tag to the committed counter)
+//	OR_{0 <= v < k} C h1^{-v} = h2^r        (the counter is smaller than the limit k)
+//
+// A holder that shows the credential more than k times within the scope and epoch must reuse a
+// counter, which results in the same tag. Verifiers can detect this using a ShowTagRegistry.
+// As the serial differs per credential, the tags of other credentials of the same holder differ.
+// Show tags of secret keys that are shared with a keyshare server are not supported.
+
+// MaxShowLimit is the maximum amount of showings per scope and epoch of a show tag.
+const MaxShowLimit = 256
+
+// showTagChallengeBits is the size of the challenge of a ProofList, i.e. the output size of
+// createChallenge(). The challenges of the branches of the OR proof sum to it modulo 2^showTagChallengeBits.
+const showTagChallengeBits = 256
+
+var (
+	// nymGroupOrder is the prime order q = (p-1)/2 of the domain pseudonym group.
+	nymGroupOrder = new(big.Int).Rsh(nymGroupPrime, 1)
+
+	// showTagH1 and showTagH2 are the bases of the commitments to the counter of show tags.
+	showTagH1, showTagH2 = showTagBase(1), showTagBase(2)
+
+	showTagChallengeModulus = new(big.Int).Lsh(big.NewInt(1), showTagChallengeBits)
+)
+
+// ErrDoubleShow is returned by ShowTagRegistry.Register() for show tags that were registered before.
+var ErrDoubleShow = errors.New("credential shown more often than allowed")
+
+// ShowTagProof is a show tag, along with the proof that it is computed from the secret key and
+// the undisclosed attribute SerialAttribute of the ProofD containing it and a counter smaller than
+// Limit, which equals the disclosed attribute LimitAttribute. See LimitShowings().
+type ShowTagProof struct {
+	Scope           string   `json:"scope"`
+	Epoch           uint64   `json:"epoch"`
+	SerialAttribute int      `json:"serial_attribute"`
+	LimitAttribute  int      `json:"limit_attribute"`
+	Limit           int      `json:"limit"`
+	Tag             *big.Int `json:"tag"`
+	Commitment      *big.Int `json:"counter_commitment"`
+
+	CounterResponse *big.Int   `json:"counter_response"`
+	HiderResponse   *big.Int   `json:"hider_response"`
+	Challenges      []*big.Int `json:"challenges"`
+	Responses       []*big.Int `json:"responses"`
+}
+
+type showTagBuilder struct {
+	proof     *ShowTagProof
+	generator *big.Int
+	counter   int
+	hider     *big.Int
+
+	counterRandomizer, hiderRandomizer, branchRandomizer *big.Int
+	challenges, responses                                []*big.Int // of the simulated branches
+}
+
+// ShowTagGenerator deterministically derives the generator g of the show tags within the
+// specified scope and epoch, by hashing them into the domain pseudonym group.
+func ShowTagGenerator(scope string, epoch uint64) (*big.Int, error) {
+	if scope == "" {
+		return nil, errors.New("scope must not be empty")
+	}
+	h := common.GetHashNumber(common.IntHashSha256([]byte(scope)), new(big.Int).SetUint64(epoch),
+		0, uint(nymGroupPrime.BitLen())+128)
+	return nymGroupElement(h)
+}
+
+// showTagBase derives the specified base of the commitments to the counters of show tags.
+func showTagBase(index int) *big.Int {
+	h := common.GetHashNumber(common.IntHashSha256([]byte("gabi show tag counter")), nil,
+		index, uint(nymGroupPrime.BitLen())+128)
+	g, err := nymGroupElement(h)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// Proves reports whether the show tag limits the showings within the specified scope and epoch,
+// using the specified serial and limit attributes of the credential type. Verifiers must check
+// this before registering the tag, as a holder could otherwise evade the limit by using another
+// attribute as serial or limit.
+func (p *ShowTagProof) Proves(scope string, epoch uint64, serialAttribute, limitAttribute int) bool {
+	return p.Scope == scope && p.Epoch == epoch &&
+		p.SerialAttribute == serialAttribute && p.LimitAttribute == limitAttribute
+}
+
+// LimitShowings makes the builder include in its ProofD a show tag for the specified scope and
+// epoch, proving that the specified counter is smaller than the limit. The limit is the value of
+// the attribute with index limitAttribute, which must be disclosed. The tag is bound to the
+// attribute with index serialAttribute, which must be undisclosed and unique to the credential.
+// The holder must use each counter at most once per scope and epoch, for otherwise its showings
+// become linkable. It returns the show tag, and must be called before the builder is committed.
+func (d *DisclosureProofBuilder) LimitShowings(
+	scope string, epoch uint64, serialAttribute, limitAttribute, counter int,
+) (*big.Int, error) {
+	if d.showTag != nil {
+		return nil, errors.New("showings already limited")
+	}
+	if serialAttribute <= 0 || serialAttribute >= len(d.attributes) ||
+		!isUndisclosedAttribute(d.disclosedAttributes, serialAttribute) {
+		return nil, errors.New("serial attribute must be undisclosed and not the secret key")
+	}
+	if limitAttribute <= 0 || limitAttribute >= len(d.attributes) ||
+		isUndisclosedAttribute(d.disclosedAttributes, limitAttribute) {
+		return nil, errors.New("limit attribute must be disclosed")
+	}
+	limitValue := d.attributes[limitAttribute]
+	if limitValue.Sign() <= 0 || limitValue.Cmp(big.NewInt(MaxShowLimit)) > 0 {
+		return nil, errors.Errorf("limit must be between 1 and %d", MaxShowLimit)
+	}
+	limit := int(limitValue.Int64())
+	if counter < 0 || counter >= limit {
+		return nil, errors.New("counter must be nonnegative and smaller than limit")
+	}
+	generator, err := ShowTagGenerator(scope, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	// T = g^{1/(sk + s + j + 1)}
+	exp := new(big.Int).Add(d.attributes[0], d.attributeExponent(serialAttribute))
+	exp.Add(exp, big.NewInt(int64(counter)+1))
+	if exp.ModInverse(exp.Mod(exp, nymGroupOrder), nymGroupOrder) == nil {
+		return nil, common.ErrNoModInverse
+	}
+	tag := new(big.Int).Exp(generator, exp, nymGroupPrime)
+
+	random := common.RandReader(d.random)
+	b := &showTagBuilder{generator: generator, counter: counter}
+	for _, r := range []**big.Int{&b.hider, &b.counterRandomizer, &b.hiderRandomizer, &b.branchRandomizer} {
+		if *r, err = big.RandInt(random, nymGroupOrder); err != nil {
+			return nil, err
+		}
+	}
+	b.challenges = make([]*big.Int, limit)
+	b.responses = make([]*big.Int, limit)
+	for v := 0; v < limit; v++ {
+		if v == counter {
+			continue
+		}
+		if b.challenges[v], err = big.RandInt(random, showTagChallengeModulus); err != nil {
+			return nil, err
+		}
+		if b.responses[v], err = big.RandInt(random, nymGroupOrder); err != nil {
+			return nil, err
+		}
+	}
+
+	b.proof = &ShowTagProof{
+		Scope:           scope,
+		Epoch:           epoch,
+		SerialAttribute: serialAttribute,
+		LimitAttribute:  limitAttribute,
+		Limit:           limit,
+		Tag:             tag,
+		Commitment:      commitToCounter(big.NewInt(int64(counter)), b.hider),
+	}
+	d.showTag = b
+	return new(big.Int).Set(tag), nil
+}
+
+// commitToCounter computes h1^j h2^r.
+func commitToCounter(j, r *big.Int) *big.Int {
+	c := new(big.Int).Exp(showTagH1, j, nymGroupPrime)
+	return c.Mul(c, new(big.Int).Exp(showTagH2, r, nymGroupPrime)).Mod(c, nymGroupPrime)
+}
+
+// showTagBranchCommitment computes h2^z (C h1^{-v})^{-c}, the commitment of the branch of the OR
+// proof for counter v.
+func showTagBranchCommitment(commitment *big.Int, v int, c, z *big.Int) (*big.Int, error) {
+	h1v, err := common.ModPow(showTagH1, big.NewInt(int64(-v)), nymGroupPrime)
+	if err != nil {
+		return nil, err
+	}
+	h1v.Mul(h1v, commitment).Mod(h1v, nymGroupPrime)
+	a, err := common.ModPow(h1v, new(big.Int).Neg(c), nymGroupPrime)
+	if err != nil {
+		return nil, err
+	}
+	return a.Mul(a, new(big.Int).Exp(showTagH2, z, nymGroupPrime)).Mod(a, nymGroupPrime), nil
+}
+
+// commitShowTag returns the commitments of the proof of the show tag, if any: g, T, C,
+// T^{sk_commit + s_commit + j_commit}, h1^{j_commit} h2^{r_commit}, and the commitments of the
+// branches of the OR proof.
+func (d *DisclosureProofBuilder) commitShowTag() ([]*big.Int, error) {
+	b := d.showTag
+	if b == nil {
+		return nil, nil
+	}
+	t := new(big.Int).Add(d.attrRandomizers[0], d.attrRandomizers[b.proof.SerialAttribute])
+	t.Add(t, b.counterRandomizer)
+	list := []*big.Int{
+		b.generator,
+		b.proof.Tag,
+		b.proof.Commitment,
+		t.Exp(b.proof.Tag, t, nymGroupPrime),
+		commitToCounter(b.counterRandomizer, b.hiderRandomizer),
+	}
+	for v := 0; v < b.proof.Limit; v++ {
+		if v == b.counter {
+			list = append(list, new(big.Int).Exp(showTagH2, b.branchRandomizer, nymGroupPrime))
+			continue
+		}
+		a, err := showTagBranchCommitment(b.proof.Commitment, v, b.challenges[v], b.responses[v])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+// createShowTag creates the proof of the show tag, if any, with the provided challenge.
+func (d *DisclosureProofBuilder) createShowTag(challenge *big.Int) *ShowTagProof {
+	b := d.showTag
+	if b == nil {
+		return nil
+	}
+	proof := *b.proof
+	j := big.NewInt(int64(b.counter))
+
+	// The challenge of the real branch is the challenge minus those of the simulated branches
+	proof.Challenges = make([]*big.Int, proof.Limit)
+	proof.Responses = make([]*big.Int, proof.Limit)
+	c := new(big.Int).Set(challenge)
+	for v := 0; v < proof.Limit; v++ {
+		if v == b.counter {
+			continue
+		}
+		proof.Challenges[v] = new(big.Int).Set(b.challenges[v])
+		proof.Responses[v] = new(big.Int).Set(b.responses[v])
+		c.Sub(c, b.challenges[v])
+	}
+	proof.Challenges[b.counter] = c.Mod(c, showTagChallengeModulus)
+	proof.Responses[b.counter] = showTagResponse(b.branchRandomizer, c, b.hider)
+
+	proof.CounterResponse = showTagResponse(b.counterRandomizer, challenge, j)
+	proof.HiderResponse = showTagResponse(b.hiderRandomizer, challenge, b.hider)
+	return &proof
+}
+
+// showTagResponse computes randomizer + c*secret mod q.
+func showTagResponse(randomizer, c, secret *big.Int) *big.Int {
+	response := new(big.Int).Mul(c, secret)
+	return response.Add(response, randomizer).Mod(response, nymGroupOrder)
+}
+
+// showTagContributions reconstructs the commitments of the proof of the show tag of the ProofD,
+// if any (see commitShowTag()).
+func (p *ProofD) showTagContributions() ([]*big.Int, error) {
+	s := p.ShowTag
+	if s == nil {
+		return nil, nil
+	}
+	if s.Tag == nil || s.Commitment == nil || s.CounterResponse == nil || s.HiderResponse == nil {
+		return nil, errors.New("incomplete show tag")
+	}
+	if s.Limit <= 0 || s.Limit > MaxShowLimit || len(s.Challenges) != s.Limit || len(s.Responses) != s.Limit {
+		return nil, errors.New("invalid show tag limit")
+	}
+	if !inNymGroup(s.Tag) || !inNymGroup(s.Commitment) {
+		return nil, errors.New("show tag not in group")
+	}
+	if !inNymGroupOrder(s.CounterResponse) || !inNymGroupOrder(s.HiderResponse) {
+		return nil, errors.New("show tag response out of range")
+	}
+	skResponse := p.AResponses[0]
+	if skResponse == nil {
+		return nil, errors.New("no secret key response")
+	}
+	serialResponse := p.attributeResponse(s.SerialAttribute)
+	if s.SerialAttribute <= 0 || serialResponse == nil {
+		return nil, errors.New("show tag serial attribute must be undisclosed")
+	}
+	if limit := p.ADisclosed[s.LimitAttribute]; limit == nil || limit.Cmp(big.NewInt(int64(s.Limit))) != 0 {
+		return nil, errors.New("show tag limit differs from disclosed limit attribute")
+	}
+	generator, err := ShowTagGenerator(s.Scope, s.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	// T^{s_sk + s_s + s_j} (g T^{-1})^{-c} = T^{s_sk + s_s + s_j + c} g^{-c}
+	exp := new(big.Int).Add(skResponse, serialResponse)
+	exp.Add(exp, s.CounterResponse)
+	tagCommit := new(big.Int).Exp(s.Tag, exp.Add(exp, p.C), nymGroupPrime)
+	gc, err := common.ModPow(generator, new(big.Int).Neg(p.C), nymGroupPrime)
+	if err != nil {
+		return nil, err
+	}
+	tagCommit.Mul(tagCommit, gc).Mod(tagCommit, nymGroupPrime)
+
+	// h1^{s_j} h2^{s_r} C^{-c}
+	counterCommit, err := common.ModPow(s.Commitment, new(big.Int).Neg(p.C), nymGroupPrime)
+	if err != nil {
+		return nil, err
+	}
+	counterCommit.Mul(counterCommit, commitToCounter(s.CounterResponse, s.HiderResponse)).Mod(counterCommit, nymGroupPrime)
+
+	list := []*big.Int{generator, s.Tag, s.Commitment, tagCommit, counterCommit}
+	sum := big.NewInt(0)
+	for v := 0; v < s.Limit; v++ {
+		c, z := s.Challenges[v], s.Responses[v]
+		if c == nil || z == nil || c.Sign() < 0 || c.Cmp(showTagChallengeModulus) >= 0 || !inNymGroupOrder(z) {
+			return nil, errors.New("show tag branch out of range")
+		}
+		a, err := showTagBranchCommitment(s.Commitment, v, c, z)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+		sum.Add(sum, c)
+	}
+	if sum.Mod(sum, showTagChallengeModulus).Cmp(p.C) != 0 {
+		return nil, errors.New("show tag challenges do not sum to the challenge")
+	}
+	return list, nil
+}
+
+// inNymGroupOrder reports whether x is in [0, q).
+func inNymGroupOrder(x *big.Int) bool {
+	return x.Sign() >= 0 && x.Cmp(nymGroupOrder) < 0
+}
+
+// ShowTagRegistry records the show tags seen by a verifier, to detect credentials that are shown
+// more often than allowed. It is safe for concurrent use.
+type ShowTagRegistry struct {
+	sync.Mutex
+	tags map[string]map[uint64]map[string]string // scope -> epoch -> tag -> session
+}
+
+// NewShowTagRegistry returns an empty ShowTagRegistry.
+func NewShowTagRegistry() *ShowTagRegistry {
+	return &ShowTagRegistry{tags: map[string]map[uint64]map[string]string{}}
+}
+
+// Register records the show tag of a verified ProofD along with an identifier of the session in
+// which it was shown. If the tag was registered before, the credential was shown more often than
+// allowed within the scope and epoch of the tag; then the identifier of the session of the earlier
+// showing is returned along with ErrDoubleShow, linking both showings.
+func (r *ShowTagRegistry) Register(tag *ShowTagProof, session string) (string, error) {
+	if tag == nil || tag.Tag == nil {
+		return "", errors.New("no show tag")
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	epochs, ok := r.tags[tag.Scope]
+	if !ok {
+		epochs = map[uint64]map[string]string{}
+		r.tags[tag.Scope] = epochs
+	}
+	tags, ok := epochs[tag.Epoch]
+	if !ok {
+		tags = map[string]string{}
+		epochs[tag.Epoch] = tags
+	}
+	key := string(tag.Tag.Bytes())
+	if earlier, ok := tags[key]; ok {
+		return earlier, ErrDoubleShow
+	}
+	tags[key] = session
+	return "", nil
+}
+
+// Prune forgets the show tags of the specified scope of the epochs before the specified epoch,
+// which can no longer be shown.
+func (r *ShowTagRegistry) Prune(scope string, before uint64) {
+	r.Lock()
+	defer r.Unlock()
+	for epoch := range r.tags[scope] {
+		if epoch < before {
+			delete(r.tags[scope], epoch)
+		}
+	}
+}
@@ -0,0 +1,856 @@
+// Package testvectors generates and replays a corpus of test vectors, with which other
+// implementations of gabi can be checked for bit-exact compatibility.
+//
+// Each vector contains its inputs, including the seeds of the deterministic sources of randomness
+// from which all random values are read, along with the resulting outputs of gabi. Given the same
+// inputs, an implementation that reads its randomness in the same order as gabi should produce
+// exactly the same outputs.
+//
+// The source of randomness of a seed is AES-256 in counter mode keyed with the seed (see
+// common.CPRNG): its n-th block of 16 bytes is the encryption of the little-endian 64-bit integer
+// n followed by 8 zero bytes. Each read from the source starts at a new block, discarding the
+// remainder of the last block of the previous read.
+//
+// The corpus is stored in testdata/vectors.json, and can be regenerated by running
+//
+//	go test ./testvectors -update
+//
+// which keeps the issuer key pair already present in the corpus. Some outputs cannot be
+// reproduced, i.e. the timestamps and ECDSA signatures of revocation updates. For these, the
+// replay checks that they are valid and that the values they sign are as expected.
+package testvectors
+
+import (
+	"bytes"
+	stdcontext "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+	"github.com/privacybydesign/gabi/rangeproof"
+	"github.com/privacybydesign/gabi/revocation"
+)
+
+type (
+	// Corpus is a set of test vectors, along with the issuer key pair they use.
+	Corpus struct {
+		Keys        *Keys                `json:"keys"`
+		HashCommit  []*HashCommitVector  `json:"hashCommit"`
+		CLSignature []*CLSignatureVector `json:"clSignature"`
+		Issuance    []*IssuanceVector    `json:"issuance"`
+		Disclosure  []*DisclosureVector  `json:"disclosure"`
+		Keyshare    []*KeyshareVector    `json:"keyshare"`
+		Revocation  []*RevocationVector  `json:"revocation"`
+	}
+
+	// Keys contains an issuer key pair in XML.
+	Keys struct {
+		PrivateKey string `json:"privateKey"`
+		PublicKey  string `json:"publicKey"`
+
+		sk *gabikeys.PrivateKey
+		pk *gabikeys.PublicKey
+	}
+
+	// Seed is the seed of a deterministic source of randomness, encoded in hex in JSON.
+	Seed [32]byte
+
+	// corpusEntry holds the JSON encoding of a vector as it was read from the corpus, against
+	// which its replay is compared.
+	corpusEntry struct {
+		raw json.RawMessage
+	}
+
+	// HashCommitVector contains the output of common.HashCommit(), on which all challenges are
+	// based.
+	HashCommitVector struct {
+		corpusEntry
+
+		Name   string     `json:"name"`
+		Values []*big.Int `json:"values"`
+		IsSig  bool       `json:"issig"`
+
+		Hash *big.Int `json:"hash"`
+	}
+
+	// CLSignatureVector contains a CL signature over the attributes (see gabi.SignMessageBlock()).
+	CLSignatureVector struct {
+		corpusEntry
+
+		Name       string     `json:"name"`
+		Seed       Seed       `json:"seed"`
+		Attributes []*big.Int `json:"attributes"`
+
+		Signature *gabi.CLSignature `json:"signature"`
+	}
+
+	// IssuanceVector contains the messages of an issuance session: the ProofU of the user and
+	// the ProofS of the issuer, along with the resulting signature of the credential, whose first
+	// attribute is the secret.
+	IssuanceVector struct {
+		corpusEntry
+
+		Name       string     `json:"name"`
+		UserSeed   Seed       `json:"userSeed"`
+		IssuerSeed Seed       `json:"issuerSeed"`
+		Context    *big.Int   `json:"context"`
+		Nonce1     *big.Int   `json:"nonce1"`
+		Nonce2     *big.Int   `json:"nonce2"`
+		Secret     *big.Int   `json:"secret"`
+		Attributes []*big.Int `json:"attributes"`
+
+		CommitMessage    *gabi.IssueCommitmentMessage `json:"commitMessage"`
+		SignatureMessage *gabi.IssueSignatureMessage  `json:"signatureMessage"`
+		Signature        *gabi.CLSignature            `json:"signature"`
+	}
+
+	// RangeStatement states that an attribute satisfies a range statement (see
+	// rangeproof.NewStatement()).
+	RangeStatement struct {
+		Attribute int                      `json:"attribute"`
+		Type      rangeproof.StatementType `json:"type"`
+		Bound     *big.Int                 `json:"bound"`
+	}
+
+	// DisclosureVector contains a ProofD over the credential, optionally with range proofs and
+	// a nonrevocation proof.
+	DisclosureVector struct {
+		corpusEntry
+
+		Name            string            `json:"name"`
+		Seed            Seed              `json:"seed"`
+		Context         *big.Int          `json:"context"`
+		Nonce           *big.Int          `json:"nonce"`
+		Credential      *gabi.Credential  `json:"credential"`
+		Disclosed       []int             `json:"disclosed"`
+		RangeStatements []*RangeStatement `json:"rangeStatements,omitempty"`
+		NonRevocation   bool              `json:"nonrev"`
+
+		Proofs gabi.ProofList `json:"proofs"`
+	}
+
+	// KeyshareVector contains the issuance and disclosure of a credential whose secret key is
+	// shared between the user and a keyshare server, whose ProofPs are merged into the ProofU and
+	// ProofD of the user.
+	KeyshareVector struct {
+		corpusEntry
+
+		Name           string     `json:"name"`
+		UserSeed       Seed       `json:"userSeed"`
+		KeyshareSeed   Seed       `json:"keyshareSeed"`
+		IssuerSeed     Seed       `json:"issuerSeed"`
+		Context        *big.Int   `json:"context"`
+		Nonce1         *big.Int   `json:"nonce1"`
+		Nonce2         *big.Int   `json:"nonce2"`
+		Nonce          *big.Int   `json:"nonce"`
+		UserSecret     *big.Int   `json:"userSecret"`
+		KeyshareSecret *big.Int   `json:"keyshareSecret"`
+		Attributes     []*big.Int `json:"attributes"`
+		Disclosed      []int      `json:"disclosed"`
+
+		IssuanceCommitment   *gabi.ProofPCommitment      `json:"issuanceCommitment"`
+		IssuanceResponse     *gabi.ProofP                `json:"issuanceResponse"`
+		IssuanceProofs       gabi.ProofList              `json:"issuanceProofs"`
+		SignatureMessage     *gabi.IssueSignatureMessage `json:"signatureMessage"`
+		Signature            *gabi.CLSignature           `json:"signature"`
+		DisclosureCommitment *gabi.ProofPCommitment      `json:"disclosureCommitment"`
+		DisclosureResponse   *gabi.ProofP                `json:"disclosureResponse"`
+		DisclosureProofs     gabi.ProofList              `json:"disclosureProofs"`
+	}
+
+	// RevocationVector contains a chain of revocation updates, each revoking one of the Revoked
+	// attributes, along with a witness that is updated along the chain. The witness, which is
+	// not revoked, is generated from the seed against the accumulator of the Initial update.
+	RevocationVector struct {
+		corpusEntry
+
+		Name    string             `json:"name"`
+		Seed    Seed               `json:"seed"`
+		Initial *revocation.Update `json:"initial"`
+		Revoked []*big.Int         `json:"revoked"`
+
+		Witness  *revocation.Witness  `json:"witness"`
+		Updates  []*revocation.Update `json:"updates"`
+		WitnessU []*big.Int           `json:"witnessU"`
+	}
+)
+
+// keyExpiry is the expiry date of generated key pairs.
+var keyExpiry = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NewSeed derives a seed from the specified name.
+func NewSeed(name string) Seed {
+	return sha256.Sum256([]byte("gabi test vector " + name))
+}
+
+// Rand returns the deterministic source of randomness of the seed.
+func (s Seed) Rand() io.Reader {
+	seed := [32]byte(s)
+	random, err := common.NewCPRNG(&seed)
+	if err != nil {
+		panic(err) // only fails for invalid AES key sizes
+	}
+	return random
+}
+
+func (s Seed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(s[:]))
+}
+
+func (s *Seed) UnmarshalJSON(bts []byte) error {
+	var str string
+	if err := json.Unmarshal(bts, &str); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(str)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != len(s) {
+		return errors.New("seed must be 32 bytes")
+	}
+	copy(s[:], decoded)
+	return nil
+}
+
+// GenerateKeys generates a 2048-bit issuer key pair supporting revocation from the seed. Its
+// ECDSA revocation key is not reproducible. (Smaller keys cannot be used, as the ProofP of a
+// keyshare server does not fit in the response sizes of ProofDs of 1024-bit keys.)
+func GenerateKeys(seed Seed) (*Keys, error) {
+	sk, pk, err := gabikeys.GenerateKeyPairWithRand(
+		stdcontext.Background(), seed.Rand(), gabikeys.DefaultSystemParameters[2048], 6, 0, keyExpiry,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var skXML, pkXML bytes.Buffer
+	if _, err = sk.WriteTo(&skXML); err != nil {
+		return nil, err
+	}
+	if _, err = pk.WriteTo(&pkXML); err != nil {
+		return nil, err
+	}
+	return &Keys{PrivateKey: skXML.String(), PublicKey: pkXML.String(), sk: sk, pk: pk}, nil
+}
+
+// parse parses the key pair, if not already done.
+func (k *Keys) parse() error {
+	if k.sk != nil && k.pk != nil {
+		return nil
+	}
+	sk, err := gabikeys.NewPrivateKeyFromXML(k.PrivateKey, false)
+	if err != nil {
+		return err
+	}
+	pk, err := gabikeys.NewPublicKeyFromXML(k.PublicKey)
+	if err != nil {
+		return err
+	}
+	k.sk, k.pk = sk, pk
+	return nil
+}
+
+// Generate generates a corpus using the specified key pair.
+func Generate(keys *Keys) (*Corpus, error) {
+	if err := keys.parse(); err != nil {
+		return nil, err
+	}
+	c := &Corpus{Keys: keys}
+	if err := c.generateInputs(); err != nil {
+		return nil, err
+	}
+	for _, v := range c.vectors() {
+		if err := v.generate(keys); err != nil {
+			return nil, errors.WrapPrefix(err, v.name(), 0)
+		}
+	}
+	return c, nil
+}
+
+// UnmarshalJSON decodes the corpus, keeping the JSON encoding of each vector so that replays are
+// compared against the corpus as it is stored, instead of against a re-encoding of the decoded
+// vectors which would hide changes of the encoding.
+func (c *Corpus) UnmarshalJSON(bts []byte) error {
+	type corpus Corpus // prevent recursion
+	if err := json.Unmarshal(bts, (*corpus)(c)); err != nil {
+		return err
+	}
+	var raw struct {
+		HashCommit  []json.RawMessage `json:"hashCommit"`
+		CLSignature []json.RawMessage `json:"clSignature"`
+		Issuance    []json.RawMessage `json:"issuance"`
+		Disclosure  []json.RawMessage `json:"disclosure"`
+		Keyshare    []json.RawMessage `json:"keyshare"`
+		Revocation  []json.RawMessage `json:"revocation"`
+	}
+	if err := json.Unmarshal(bts, &raw); err != nil {
+		return err
+	}
+	// Same order as Corpus.vectors()
+	var raws []json.RawMessage
+	for _, r := range [][]json.RawMessage{
+		raw.HashCommit, raw.CLSignature, raw.Issuance, raw.Disclosure, raw.Keyshare, raw.Revocation,
+	} {
+		raws = append(raws, r...)
+	}
+	vectors := c.vectors()
+	if len(vectors) != len(raws) {
+		return errors.New("corpus contains empty vectors")
+	}
+	for i, v := range vectors {
+		v.setRaw(raws[i])
+	}
+	return nil
+}
+
+// Verify replays the corpus against the current code: it checks that each vector is valid, and
+// that generating it again from its inputs results in the same outputs.
+func (c *Corpus) Verify() error {
+	if c.Keys == nil {
+		return errors.New("corpus has no keys")
+	}
+	if err := c.Keys.parse(); err != nil {
+		return err
+	}
+	// Replay before verifying, as verification may modify the outputs (e.g. ProofList.Verify()
+	// removes the disclosed responses from nonrevocation proofs)
+	for _, v := range c.vectors() {
+		if err := v.replay(c.Keys); err != nil {
+			return errors.WrapPrefix(err, v.name(), 0)
+		}
+		if err := v.verify(c.Keys); err != nil {
+			return errors.WrapPrefix(err, v.name(), 0)
+		}
+	}
+	return nil
+}
+
+// vector is implemented by all test vectors.
+type vector interface {
+	name() string
+	// setRaw sets the JSON encoding of the vector as read from the corpus.
+	setRaw(raw json.RawMessage)
+	// generate computes the outputs of the vector from its inputs.
+	generate(keys *Keys) error
+	// verify checks that the outputs of the vector are valid.
+	verify(keys *Keys) error
+	// replay checks that the outputs of the vector are reproduced by the current code.
+	replay(keys *Keys) error
+}
+
+func (c *Corpus) vectors() []vector {
+	var vectors []vector
+	for _, v := range c.HashCommit {
+		vectors = append(vectors, v)
+	}
+	for _, v := range c.CLSignature {
+		vectors = append(vectors, v)
+	}
+	for _, v := range c.Issuance {
+		vectors = append(vectors, v)
+	}
+	for _, v := range c.Disclosure {
+		vectors = append(vectors, v)
+	}
+	for _, v := range c.Keyshare {
+		vectors = append(vectors, v)
+	}
+	for _, v := range c.Revocation {
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// generateInputs populates the corpus with the inputs of its vectors.
+func (c *Corpus) generateInputs() error {
+	sk, pk := c.Keys.sk, c.Keys.pk
+	params := pk.Params
+	random := NewSeed("inputs").Rand()
+	rnd := func(bits uint) *big.Int {
+		r, err := common.RandomBigIntFrom(random, bits)
+		if err != nil {
+			panic(err) // the CPRNG does not fail
+		}
+		return r
+	}
+	attributes := func(count int) []*big.Int {
+		attrs := make([]*big.Int, count)
+		for i := range attrs {
+			attrs[i] = rnd(params.Lm - 1)
+		}
+		return attrs
+	}
+
+	c.HashCommit = []*HashCommitVector{
+		{Name: "hashcommit-empty", Values: []*big.Int{}},
+		{Name: "hashcommit-single", Values: []*big.Int{big.NewInt(1)}},
+		{Name: "hashcommit-multiple", Values: []*big.Int{rnd(params.Lh), rnd(1024), big.NewInt(0), rnd(params.Lstatzk)}},
+		{Name: "hashcommit-issig", Values: []*big.Int{rnd(params.Lh), rnd(1024), rnd(params.Lstatzk)}, IsSig: true},
+	}
+
+	bigAttribute := new(big.Int).SetBytes(bytes.Repeat([]byte("this attribute exceeds the maximum message length "), 4))
+	c.CLSignature = []*CLSignatureVector{
+		{Name: "clsignature", Seed: NewSeed("clsignature"), Attributes: attributes(5)},
+		{Name: "clsignature-big-attribute", Seed: NewSeed("clsignature-big-attribute"),
+			Attributes: []*big.Int{rnd(params.Lm), bigAttribute, big.NewInt(0)}},
+	}
+
+	c.Issuance = []*IssuanceVector{{
+		Name:       "issuance",
+		UserSeed:   NewSeed("issuance-user"),
+		IssuerSeed: NewSeed("issuance-issuer"),
+		Context:    rnd(params.Lh),
+		Nonce1:     rnd(params.Lstatzk),
+		Nonce2:     rnd(params.Lstatzk),
+		Secret:     rnd(params.Lm),
+		Attributes: attributes(4),
+	}}
+
+	// A credential containing a revocation attribute, whose witness is valid against a new
+	// accumulator
+	update, err := revocation.NewAccumulatorWithRand(NewSeed("disclosure-accumulator").Rand(), sk)
+	if err != nil {
+		return err
+	}
+	acc, err := update.SignedAccumulator.UnmarshalVerify(pk)
+	if err != nil {
+		return err
+	}
+	witness, err := revocation.RandomWitnessWithRand(NewSeed("disclosure-witness").Rand(), sk, acc)
+	if err != nil {
+		return err
+	}
+	witness.SignedAccumulator = update.SignedAccumulator
+	attrs := append(append([]*big.Int{rnd(params.Lm)}, attributes(2)...), big.NewInt(30), witness.E)
+	signature, err := gabi.SignMessageBlockWithRand(NewSeed("disclosure-signature").Rand(), sk, pk, attrs)
+	if err != nil {
+		return err
+	}
+	cred := &gabi.Credential{Signature: signature, Attributes: attrs, NonRevocationWitness: witness}
+	c.Disclosure = []*DisclosureVector{
+		{
+			Name:       "disclosure",
+			Seed:       NewSeed("disclosure"),
+			Context:    rnd(params.Lh),
+			Nonce:      rnd(params.Lstatzk),
+			Credential: cred,
+			Disclosed:  []int{1, 2},
+		},
+		{
+			Name:       "disclosure-range-nonrev",
+			Seed:       NewSeed("disclosure-range-nonrev"),
+			Context:    rnd(params.Lh),
+			Nonce:      rnd(params.Lstatzk),
+			Credential: cred,
+			Disclosed:  []int{1},
+			RangeStatements: []*RangeStatement{
+				{Attribute: 3, Type: rangeproof.GreaterOrEqual, Bound: big.NewInt(18)},
+				{Attribute: 3, Type: rangeproof.LesserOrEqual, Bound: big.NewInt(65)},
+				{Attribute: 3, Type: rangeproof.NotEqual, Bound: big.NewInt(21)},
+			},
+			NonRevocation: true,
+		},
+	}
+
+	// The keyshare secret is one bit smaller than the user secret (see gabi.NewKeyshareSecret())
+	c.Keyshare = []*KeyshareVector{{
+		Name:           "keyshare",
+		UserSeed:       NewSeed("keyshare-user"),
+		KeyshareSeed:   NewSeed("keyshare-server"),
+		IssuerSeed:     NewSeed("keyshare-issuer"),
+		Context:        rnd(params.Lh),
+		Nonce1:         rnd(params.Lstatzk),
+		Nonce2:         rnd(params.Lstatzk),
+		Nonce:          rnd(params.Lstatzk),
+		UserSecret:     rnd(params.Lm - 1),
+		KeyshareSecret: rnd(params.Lm - 1),
+		Attributes:     attributes(3),
+		Disclosed:      []int{2},
+	}}
+
+	initial, err := revocation.NewAccumulatorWithRand(NewSeed("revocation-accumulator").Rand(), sk)
+	if err != nil {
+		return err
+	}
+	if acc, err = initial.SignedAccumulator.UnmarshalVerify(pk); err != nil {
+		return err
+	}
+	revoked := make([]*big.Int, 3)
+	for i := range revoked {
+		w, err := revocation.RandomWitnessWithRand(random, sk, acc)
+		if err != nil {
+			return err
+		}
+		revoked[i] = w.E
+	}
+	c.Revocation = []*RevocationVector{{
+		Name:    "revocation",
+		Seed:    NewSeed("revocation"),
+		Initial: initial,
+		Revoked: revoked,
+	}}
+
+	return nil
+}
+
+func (e *corpusEntry) setRaw(raw json.RawMessage) { e.raw = raw }
+
+// compare returns an error if the JSON encoding of the fresh vector differs, up to whitespace,
+// from the encoding of the vector in the corpus. If the vector was not read from a corpus, the
+// encoding of v is used instead.
+func (e *corpusEntry) compare(v, fresh interface{}) error {
+	expected := []byte(e.raw)
+	if expected == nil {
+		var err error
+		if expected, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	actual, err := json.Marshal(fresh)
+	if err != nil {
+		return err
+	}
+	var e1, e2 bytes.Buffer
+	if err = json.Compact(&e1, expected); err != nil {
+		return err
+	}
+	if err = json.Compact(&e2, actual); err != nil {
+		return err
+	}
+	if !bytes.Equal(e1.Bytes(), e2.Bytes()) {
+		return errors.New("outputs differ from the corpus")
+	}
+	return nil
+}
+
+func (v *HashCommitVector) name() string { return v.Name }
+
+func (v *HashCommitVector) generate(*Keys) error {
+	v.Hash = common.HashCommit(v.Values, v.IsSig)
+	return nil
+}
+
+func (v *HashCommitVector) verify(*Keys) error {
+	if v.Hash == nil {
+		return errors.New("missing hash")
+	}
+	return nil
+}
+
+func (v *HashCommitVector) replay(keys *Keys) error {
+	fresh := &HashCommitVector{Name: v.Name, Values: v.Values, IsSig: v.IsSig}
+	if err := fresh.generate(keys); err != nil {
+		return err
+	}
+	return v.compare(v, fresh)
+}
+
+func (v *CLSignatureVector) name() string { return v.Name }
+
+func (v *CLSignatureVector) generate(keys *Keys) (err error) {
+	v.Signature, err = gabi.SignMessageBlockWithRand(v.Seed.Rand(), keys.sk, keys.pk, v.Attributes)
+	return
+}
+
+func (v *CLSignatureVector) verify(keys *Keys) error {
+	if v.Signature == nil {
+		return errors.New("missing signature")
+	}
+	return v.Signature.VerifyDetailed(keys.pk, v.Attributes)
+}
+
+func (v *CLSignatureVector) replay(keys *Keys) error {
+	fresh := &CLSignatureVector{Name: v.Name, Seed: v.Seed, Attributes: v.Attributes}
+	if err := fresh.generate(keys); err != nil {
+		return err
+	}
+	return v.compare(v, fresh)
+}
+
+func (v *IssuanceVector) name() string { return v.Name }
+
+func (v *IssuanceVector) generate(keys *Keys) error {
+	b, err := gabi.NewCredentialBuilderWithRand(v.UserSeed.Rand(), keys.pk, v.Context, v.Secret, v.Nonce2, nil)
+	if err != nil {
+		return err
+	}
+	if v.CommitMessage, err = b.CommitToSecretAndProve(v.Nonce1); err != nil {
+		return err
+	}
+	issuer := gabi.NewIssuer(keys.sk, keys.pk, v.Context)
+	issuer.Rand = v.IssuerSeed.Rand()
+	if v.SignatureMessage, err = issuer.IssueSignature(v.CommitMessage.U, v.Attributes, nil, v.Nonce2, nil); err != nil {
+		return err
+	}
+	// ConstructCredential() modifies the signature of the message, so pass it a copy
+	msg := *v.SignatureMessage
+	signature := *msg.Signature
+	msg.Signature = &signature
+	cred, err := b.ConstructCredential(&msg, v.Attributes)
+	if err != nil {
+		return err
+	}
+	v.Signature = cred.Signature
+	return nil
+}
+
+func (v *IssuanceVector) verify(keys *Keys) error {
+	if v.CommitMessage == nil || v.SignatureMessage == nil || v.Signature == nil {
+		return errors.New("missing outputs")
+	}
+	proofu, err := v.CommitMessage.Proofs.GetFirstProofU()
+	if err != nil {
+		return err
+	}
+	if err = proofu.VerifyDetailed(keys.pk, v.Context, v.Nonce1); err != nil {
+		return err
+	}
+	err = v.SignatureMessage.Proof.VerifyDetailed(keys.pk, v.SignatureMessage.Signature, v.Context, v.Nonce2)
+	if err != nil {
+		return err
+	}
+	return v.Signature.VerifyDetailed(keys.pk, append([]*big.Int{v.Secret}, v.Attributes...))
+}
+
+func (v *IssuanceVector) replay(keys *Keys) error {
+	fresh := &IssuanceVector{
+		Name: v.Name, UserSeed: v.UserSeed, IssuerSeed: v.IssuerSeed, Context: v.Context,
+		Nonce1: v.Nonce1, Nonce2: v.Nonce2, Secret: v.Secret, Attributes: v.Attributes,
+	}
+	if err := fresh.generate(keys); err != nil {
+		return err
+	}
+	return v.compare(v, fresh)
+}
+
+func (v *DisclosureVector) name() string { return v.Name }
+
+func (v *DisclosureVector) generate(keys *Keys) error {
+	cred := *v.Credential
+	cred.Pk = keys.pk
+	if cred.NonRevocationWitness != nil {
+		if err := cred.NonRevocationWitness.Verify(keys.pk); err != nil {
+			return err
+		}
+	}
+	var statements map[int][]*rangeproof.Statement
+	if len(v.RangeStatements) > 0 {
+		statements = make(map[int][]*rangeproof.Statement)
+	}
+	for _, s := range v.RangeStatements {
+		statement, err := rangeproof.NewStatement(s.Type, s.Bound)
+		if err != nil {
+			return err
+		}
+		statements[s.Attribute] = append(statements[s.Attribute], statement)
+	}
+	b, err := cred.CreateDisclosureProofBuilderWithRand(v.Seed.Rand(), v.Disclosed, statements, v.NonRevocation)
+	if err != nil {
+		return err
+	}
+	v.Proofs, err = gabi.ProofBuilderList{b}.BuildProofList(v.Context, v.Nonce, false)
+	return err
+}
+
+func (v *DisclosureVector) verify(keys *Keys) error {
+	if v.Proofs == nil {
+		return errors.New("missing proofs")
+	}
+	if v.NonRevocation {
+		proofd, ok := v.Proofs[0].(*gabi.ProofD)
+		if !ok || !proofd.HasNonRevocationProof() {
+			return errors.New("missing nonrevocation proof")
+		}
+	}
+	return v.Proofs.VerifyDetailed([]*gabikeys.PublicKey{keys.pk}, v.Context, v.Nonce, false, nil, nil)
+}
+
+func (v *DisclosureVector) replay(keys *Keys) error {
+	fresh := &DisclosureVector{
+		Name: v.Name, Seed: v.Seed, Context: v.Context, Nonce: v.Nonce, Credential: v.Credential,
+		Disclosed: v.Disclosed, RangeStatements: v.RangeStatements, NonRevocation: v.NonRevocation,
+	}
+	if err := fresh.generate(keys); err != nil {
+		return err
+	}
+	return v.compare(v, fresh)
+}
+
+func (v *KeyshareVector) name() string { return v.Name }
+
+func (v *KeyshareVector) generate(keys *Keys) error {
+	userRand, keyshareRand := v.UserSeed.Rand(), v.KeyshareSeed.Rand()
+	pks := []*gabikeys.PublicKey{keys.pk}
+
+	// Issuance: the keyshare server's share of the secret key is included in the ProofU
+	commit, commitments, err := gabi.NewKeyshareCommitmentsWithRand(keyshareRand, v.KeyshareSecret, pks)
+	if err != nil {
+		return err
+	}
+	v.IssuanceCommitment = commitments[0]
+	b, err := gabi.NewCredentialBuilderWithRand(userRand, keys.pk, v.Context, v.UserSecret, v.Nonce2, nil)
+	if err != nil {
+		return err
+	}
+	b.MergeProofPCommitment(v.IssuanceCommitment)
+	builders := gabi.ProofBuilderList{b}
+	challenge, err := builders.Challenge(v.Context, v.Nonce1, false)
+	if err != nil {
+		return err
+	}
+	v.IssuanceResponse = gabi.KeyshareResponse(v.KeyshareSecret, commit, challenge, keys.pk)
+	if v.IssuanceProofs, err = builders.BuildDistributedProofList(challenge, []*gabi.ProofP{v.IssuanceResponse}); err != nil {
+		return err
+	}
+	issuer := gabi.NewIssuer(keys.sk, keys.pk, v.Context)
+	issuer.Rand = v.IssuerSeed.Rand()
+	u := v.IssuanceProofs[0].(*gabi.ProofU).U
+	if v.SignatureMessage, err = issuer.IssueSignature(u, v.Attributes, nil, v.Nonce2, nil); err != nil {
+		return err
+	}
+	msg := *v.SignatureMessage
+	signature := *msg.Signature
+	msg.Signature = &signature
+	cred, err := b.ConstructCredential(&msg, v.Attributes)
+	if err != nil {
+		return err
+	}
+	v.Signature = cred.Signature
+
+	// Disclosure: the keyshare server's response is merged into the ProofD
+	commit, commitments, err = gabi.NewKeyshareCommitmentsWithRand(keyshareRand, v.KeyshareSecret, pks)
+	if err != nil {
+		return err
+	}
+	v.DisclosureCommitment = commitments[0]
+	db, err := cred.CreateDisclosureProofBuilderWithRand(userRand, v.Disclosed, nil, false)
+	if err != nil {
+		return err
+	}
+	db.MergeProofPCommitment(v.DisclosureCommitment)
+	builders = gabi.ProofBuilderList{db}
+	if challenge, err = builders.Challenge(v.Context, v.Nonce, false); err != nil {
+		return err
+	}
+	v.DisclosureResponse = gabi.KeyshareResponse(v.KeyshareSecret, commit, challenge, keys.pk)
+	v.DisclosureProofs, err = builders.BuildDistributedProofList(challenge, []*gabi.ProofP{v.DisclosureResponse})
+	return err
+}
+
+func (v *KeyshareVector) verify(keys *Keys) error {
+	if v.IssuanceProofs == nil || v.SignatureMessage == nil || v.Signature == nil || v.DisclosureProofs == nil {
+		return errors.New("missing outputs")
+	}
+	pks := []*gabikeys.PublicKey{keys.pk}
+	if err := v.IssuanceProofs.VerifyDetailed(pks, v.Context, v.Nonce1, false, nil, nil); err != nil {
+		return err
+	}
+	err := v.SignatureMessage.Proof.VerifyDetailed(keys.pk, v.SignatureMessage.Signature, v.Context, v.Nonce2)
+	if err != nil {
+		return err
+	}
+	if err = v.Signature.VerifyDetailed(keys.pk, append([]*big.Int{v.UserSecret}, v.Attributes...)); err != nil {
+		return err
+	}
+	return v.DisclosureProofs.VerifyDetailed(pks, v.Context, v.Nonce, false, nil, nil)
+}
+
+func (v *KeyshareVector) replay(keys *Keys) error {
+	fresh := &KeyshareVector{
+		Name: v.Name, UserSeed: v.UserSeed, KeyshareSeed: v.KeyshareSeed, IssuerSeed: v.IssuerSeed,
+		Context: v.Context, Nonce1: v.Nonce1, Nonce2: v.Nonce2, Nonce: v.Nonce,
+		UserSecret: v.UserSecret, KeyshareSecret: v.KeyshareSecret, Attributes: v.Attributes, Disclosed: v.Disclosed,
+	}
+	if err := fresh.generate(keys); err != nil {
+		return err
+	}
+	return v.compare(v, fresh)
+}
+
+func (v *RevocationVector) name() string { return v.Name }
+
+func (v *RevocationVector) generate(keys *Keys) error {
+	acc, err := v.Initial.SignedAccumulator.UnmarshalVerify(keys.pk)
+	if err != nil {
+		return err
+	}
+	if v.Witness, err = revocation.RandomWitnessWithRand(v.Seed.Rand(), keys.sk, acc); err != nil {
+		return err
+	}
+	v.Witness.SignedAccumulator = v.Initial.SignedAccumulator
+
+	witness := *v.Witness
+	parent := v.Initial.Events[len(v.Initial.Events)-1]
+	v.Updates, v.WitnessU = nil, nil
+	for _, e := range v.Revoked {
+		var event *revocation.Event
+		if acc, event, err = acc.Remove(keys.sk, e, parent); err != nil {
+			return err
+		}
+		update, err := revocation.NewUpdate(keys.sk, acc, []*revocation.Event{event})
+		if err != nil {
+			return err
+		}
+		if err = witness.Update(keys.pk, update); err != nil {
+			return err
+		}
+		v.Updates = append(v.Updates, update)
+		v.WitnessU = append(v.WitnessU, new(big.Int).Set(witness.U))
+		parent = event
+	}
+	return nil
+}
+
+func (v *RevocationVector) verify(keys *Keys) error {
+	if v.Witness == nil || len(v.Updates) != len(v.Revoked) || len(v.WitnessU) != len(v.Revoked) {
+		return errors.New("missing outputs")
+	}
+	if err := v.Witness.Verify(keys.pk); err != nil {
+		return err
+	}
+	witness := *v.Witness
+	for i, update := range v.Updates {
+		if err := witness.Update(keys.pk, update); err != nil {
+			return err
+		}
+		if witness.U.Cmp(v.WitnessU[i]) != 0 {
+			return errors.Errorf("witness after update %d differs", i)
+		}
+	}
+	return nil
+}
+
+// replay checks that the witness and the updates are reproduced. As the timestamps and signatures
+// of the accumulators of the updates are not reproducible, it checks that the accumulators sign
+// the expected values, and takes the signed accumulators from the corpus before comparing.
+func (v *RevocationVector) replay(keys *Keys) error {
+	fresh := &RevocationVector{Name: v.Name, Seed: v.Seed, Initial: v.Initial, Revoked: v.Revoked}
+	if err := fresh.generate(keys); err != nil {
+		return err
+	}
+	if len(v.Updates) != len(fresh.Updates) {
+		return errors.New("amount of updates differs")
+	}
+	for i, update := range fresh.Updates {
+		acc, err := update.Verify(keys.pk)
+		if err != nil {
+			return err
+		}
+		updateAcc, err := v.Updates[i].Verify(keys.pk)
+		if err != nil {
+			return err
+		}
+		if updateAcc.Nu.Cmp(acc.Nu) != 0 || updateAcc.Index != acc.Index || !updateAcc.EventHash.Equal(acc.EventHash) {
+			return errors.Errorf("accumulator of update %d differs", i)
+		}
+		update.SignedAccumulator = v.Updates[i].SignedAccumulator
+	}
+	return v.compare(v, fresh)
+}
@@ -0,0 +1,68 @@
+package testvectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const corpusFile = "testdata/vectors.json"
+
+var update = flag.Bool("update", false, "regenerate the test vector corpus")
+
+func readCorpus(t *testing.T) *Corpus {
+	bts, err := ioutil.ReadFile(corpusFile)
+	require.NoError(t, err)
+	var c Corpus
+	require.NoError(t, json.Unmarshal(bts, &c))
+	return &c
+}
+
+func TestVectors(t *testing.T) {
+	if *update {
+		var keys *Keys
+		if _, err := os.Stat(corpusFile); err == nil {
+			keys = readCorpus(t).Keys
+		} else {
+			keys, err = GenerateKeys(NewSeed("keys"))
+			require.NoError(t, err)
+		}
+		c, err := Generate(keys)
+		require.NoError(t, err)
+		bts, err := json.MarshalIndent(c, "", "\t")
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll("testdata", 0755))
+		require.NoError(t, ioutil.WriteFile(corpusFile, append(bts, '\n'), 0644))
+	}
+
+	require.NoError(t, readCorpus(t).Verify())
+}
+
+func TestVectorsDetectChanges(t *testing.T) {
+	c := readCorpus(t)
+	c.CLSignature[0].Attributes[0].Add(c.CLSignature[0].Attributes[0], c.CLSignature[0].Attributes[0])
+	require.Error(t, c.Verify())
+
+	c = readCorpus(t)
+	c.HashCommit[0].IsSig = !c.HashCommit[0].IsSig
+	require.Error(t, c.Verify())
+
+	c = readCorpus(t)
+	c.Disclosure[0].Seed[0]++
+	require.Error(t, c.Verify())
+
+	// Changes of the encoding that survive decoding, as JSON keys are matched case-insensitively
+	bts, err := ioutil.ReadFile(corpusFile)
+	require.NoError(t, err)
+	for _, key := range []string{`"v_response"`, `"sacc"`} {
+		modified := bytes.Replace(bts, []byte(key), bytes.ToUpper([]byte(key)), -1)
+		c = &Corpus{}
+		require.NoError(t, json.Unmarshal(modified, c))
+		require.Error(t, c.Verify())
+	}
+}
@@ -0,0 +1,404 @@
+package gabi
+
+import (
+	"io"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+	"github.com/privacybydesign/gabi/revocation"
+)
+
+// Threshold signing distributes the private key of an issuer over n parties, each of which holds
+// an additive share of (a multiple of) the group order p'q', such that no single party can sign. To sign, the
+// parties compute shares of d = e^-1 mod p'q' for the fresh prime e of the signature, using the
+// protocol of Catalano, Gennaro and Halevi ("Computing inverses over a shared secret modulus",
+// EUROCRYPT 2000):
+//
+//  1. Each party i chooses random lambda_i and R_i, and shares them along with its share of the
+//     order among all parties using integer Shamir secret sharing of degree t = (n-1)/2, together
+//     with a sharing of 0 of degree 2t.
+//  2. Each party multiplies its shares, obtaining a share of degree 2t of
+//     gamma = lambda * order + e * R, where lambda and R are the sums of the lambda_i and R_i.
+//  3. Interpolating gamma from all shares reveals nothing about the order, as it is masked by R.
+//     With a * gamma + b * e = 1 we have e * (a * R + b) = 1 mod order, so that the parties
+//     obtain additive shares d_i = a * R_i (+ b) of d, with which they compute A = prod_i Q^{d_i}
+//     and the commitment of the ProofS.
+//  4. Each party responds to the challenge of the ProofS with its share of d.
+//
+// The protocol is secure against at most t parties that follow the protocol but try to learn the
+// order from the messages they receive, so at least 3 parties are required. The messages of the
+// first round must be sent over private channels.
+
+// SignerShare is the share of a party of a threshold issuer in the private key.
+type SignerShare struct {
+	Index   int      `json:"index"` // 1 <= Index <= Parties
+	Parties int      `json:"parties"`
+	Share   *big.Int `json:"share"` // Additive share of (a multiple of) the group order p'q'
+}
+
+// ThresholdSigner is a party of a threshold issuer, holding the state of a signing session.
+type ThresholdSigner struct {
+	Pk    *gabikeys.PublicKey
+	Share *SignerShare
+
+	// Rand is the source of randomness used for signing. If nil, crypto/rand is used.
+	Rand io.Reader
+
+	q, e, r, d, commit *big.Int
+}
+
+// ThresholdDeal is a message of the first round of threshold signing, sent over a private channel
+// from party From to party To, containing the latter's Shamir shares of the secrets of the former.
+type ThresholdDeal struct {
+	From, To int
+	Order    *big.Int
+	Lambda   *big.Int
+	R        *big.Int
+	Zero     *big.Int
+}
+
+// ThresholdExponentiation is a message of the third round of threshold signing, containing the
+// share Q^{d_i} of A and Q^{r_i} of the commitment of the ProofS.
+type ThresholdExponentiation struct {
+	A       *big.Int
+	ACommit *big.Int
+}
+
+// ThresholdIssuer is an issuer whose signing key is distributed over ThresholdSigners, which it
+// runs in process.
+type ThresholdIssuer struct {
+	Pk      *gabikeys.PublicKey
+	Context *big.Int
+	Signers []*ThresholdSigner
+
+	// Rand is the source of randomness used for issuing signatures. If nil, crypto/rand is used.
+	Rand io.Reader
+}
+
+// SplitPrivateKey splits the private key into shares for the specified amount of parties, each of
+// which should be given to one ThresholdSigner. Afterwards, the private key should be destroyed.
+func SplitPrivateKey(random io.Reader, sk *gabikeys.PrivateKey, pk *gabikeys.PublicKey, parties int) ([]*SignerShare, error) {
+	if parties < 3 {
+		return nil, errors.New("threshold signing requires at least 3 parties")
+	}
+	shares := make([]*SignerShare, parties)
+	rest := new(big.Int).Set(sk.Order)
+	for i := range shares {
+		share := rest
+		if i < parties-1 {
+			var err error
+			if share, err = common.RandomBigIntFrom(random, uint(pk.N.BitLen())+pk.Params.Lstatzk); err != nil {
+				return nil, err
+			}
+			rest.Sub(rest, share)
+		}
+		shares[i] = &SignerShare{Index: i + 1, Parties: parties, Share: share}
+	}
+	return shares, nil
+}
+
+// NewThresholdSigner creates a new party of a threshold issuer.
+func NewThresholdSigner(pk *gabikeys.PublicKey, share *SignerShare) *ThresholdSigner {
+	return &ThresholdSigner{Pk: pk, Share: share}
+}
+
+// NewThresholdIssuer creates a new threshold issuer consisting of the specified parties.
+func NewThresholdIssuer(pk *gabikeys.PublicKey, context *big.Int, signers []*ThresholdSigner) *ThresholdIssuer {
+	return &ThresholdIssuer{Pk: pk, Context: context, Signers: signers}
+}
+
+// thresholdSizes are the bit sizes of the integers of a threshold signing session: the order
+// shares, lambda_i, R_i, d_i, and the coefficients of the sharings of 0.
+type thresholdSizes struct {
+	order, lambda, r, d, zero uint
+}
+
+func newThresholdSizes(pk *gabikeys.PublicKey, parties int) thresholdSizes {
+	k := pk.Params.Lstatzk
+	n := uint(big.NewInt(int64(parties)).BitLen())
+	delta := uint(factorial(parties).BitLen())
+	s := thresholdSizes{
+		order:  uint(pk.N.BitLen()) + k + n,
+		lambda: pk.Params.Le + k,
+	}
+	s.r = s.lambda + uint(pk.N.BitLen()) + k
+	s.d = s.r + pk.Params.Le + n + 2
+	// The sharing of 0 must mask the coefficients of the sharing of Delta^2 * gamma
+	s.zero = s.order + s.lambda + s.r + pk.Params.Le + 4*k + 6*delta + uint(parties+2)*n
+	return s
+}
+
+// shamirCoefficientSize returns the bit size of the coefficients of the sharing of secrets of the
+// specified bit size.
+func shamirCoefficientSize(bits uint, pk *gabikeys.PublicKey, parties int) uint {
+	return bits + pk.Params.Lstatzk + 2*uint(factorial(parties).BitLen())
+}
+
+// degree returns the degree t = (n-1)/2 of the sharings of the secrets.
+func (s *ThresholdSigner) degree() int {
+	return (s.Share.Parties - 1) / 2
+}
+
+// Deal starts a session for signing Q with the prime e, returning the ThresholdDeals for all
+// parties (including itself) in order of their index.
+func (s *ThresholdSigner) Deal(Q, e *big.Int) ([]*ThresholdDeal, error) {
+	n := s.Share.Parties
+	sizes := newThresholdSizes(s.Pk, n)
+	lambda, err := common.RandomBigIntFrom(s.Rand, sizes.lambda)
+	if err != nil {
+		return nil, err
+	}
+	r, err := common.RandomBigIntFrom(s.Rand, sizes.r)
+	if err != nil {
+		return nil, err
+	}
+	s.q, s.e, s.r, s.d, s.commit = new(big.Int).Set(Q), new(big.Int).Set(e), r, nil, nil
+
+	t := s.degree()
+	orders, err := shareInteger(s.Rand, s.Share.Share, t, n, shamirCoefficientSize(sizes.order, s.Pk, n))
+	if err != nil {
+		return nil, err
+	}
+	lambdas, err := shareInteger(s.Rand, lambda, t, n, shamirCoefficientSize(sizes.lambda, s.Pk, n))
+	if err != nil {
+		return nil, err
+	}
+	rs, err := shareInteger(s.Rand, r, t, n, shamirCoefficientSize(sizes.r, s.Pk, n))
+	if err != nil {
+		return nil, err
+	}
+	zeros, err := shareInteger(s.Rand, big.NewInt(0), 2*t, n, sizes.zero)
+	if err != nil {
+		return nil, err
+	}
+
+	deals := make([]*ThresholdDeal, n)
+	for j := range deals {
+		deals[j] = &ThresholdDeal{
+			From: s.Share.Index, To: j + 1, Order: orders[j], Lambda: lambdas[j], R: rs[j], Zero: zeros[j],
+		}
+	}
+	return deals, nil
+}
+
+// Multiply returns the share of gamma = lambda * order + e * R of this party, computed from the
+// ThresholdDeals addressed to it by all parties.
+func (s *ThresholdSigner) Multiply(deals []*ThresholdDeal) (*big.Int, error) {
+	if s.e == nil {
+		return nil, errors.New("no signing session started")
+	}
+	if len(deals) != s.Share.Parties {
+		return nil, errors.New("expected a deal from each party")
+	}
+	order, lambda, r, zero := big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	for i, deal := range deals {
+		if deal == nil || deal.From != i+1 || deal.To != s.Share.Index ||
+			deal.Order == nil || deal.Lambda == nil || deal.R == nil || deal.Zero == nil {
+			return nil, errors.Errorf("invalid deal %d", i+1)
+		}
+		order.Add(order, deal.Order)
+		lambda.Add(lambda, deal.Lambda)
+		r.Add(r, deal.R)
+		zero.Add(zero, deal.Zero)
+	}
+
+	// lambda(j) * order(j) + Delta * e * R(j) + zero(j), which is a sharing of Delta^2 * gamma
+	product := lambda.Mul(lambda, order)
+	r.Mul(r, s.e).Mul(r, factorial(s.Share.Parties))
+	return product.Add(product, r).Add(product, zero), nil
+}
+
+// Exponentiate computes gamma from the shares of all parties (in order of their index), and from
+// it the share d_i of d = e^-1 of this party, returning Q^{d_i} and the commitment of the ProofS.
+func (s *ThresholdSigner) Exponentiate(products []*big.Int) (*ThresholdExponentiation, error) {
+	if s.r == nil {
+		return nil, errors.New("no signing session started")
+	}
+	gamma, err := interpolateProduct(products)
+	if err != nil {
+		return nil, err
+	}
+
+	// a * gamma + b * e = 1, with a < 0 so that d = (1 - a * lambda * order) / e > 0
+	a, b := new(big.Int), new(big.Int)
+	if new(big.Int).GCD(a, b, gamma, s.e).Cmp(big.NewInt(1)) != 0 {
+		return nil, errors.New("gamma not coprime to e")
+	}
+	if a.Sign() > 0 {
+		a.Sub(a, s.e)
+		b.Add(b, gamma)
+	}
+	s.d = a.Mul(a, s.r)
+	if s.Share.Index == 1 {
+		s.d.Add(s.d, b)
+	}
+	s.r = nil
+
+	sizes := newThresholdSizes(s.Pk, s.Share.Parties)
+	if s.commit, err = common.RandomBigIntFrom(s.Rand, sizes.d+s.Pk.Params.Lh+s.Pk.Params.Lstatzk); err != nil {
+		return nil, err
+	}
+	A, err := common.ModPow(s.q, s.d, s.Pk.N)
+	if err != nil {
+		return nil, err
+	}
+	return &ThresholdExponentiation{A: A, ACommit: new(big.Int).Exp(s.q, s.commit, s.Pk.N)}, nil
+}
+
+// Respond returns the share of the response of the ProofS to the challenge of this party, and
+// ends the signing session.
+func (s *ThresholdSigner) Respond(c *big.Int) (*big.Int, error) {
+	if s.d == nil {
+		return nil, errors.New("no exponentiation computed")
+	}
+	response := new(big.Int).Mul(c, s.d)
+	response.Sub(s.commit, response)
+	s.q, s.e, s.d, s.commit = nil, nil, nil, nil
+	return response, nil
+}
+
+// interpolateProduct computes x from the shares at 1, ..., n of a sharing of Delta^2 * x, such as
+// the product of two sharings produced by shareInteger().
+func interpolateProduct(shares []*big.Int) (*big.Int, error) {
+	n := len(shares)
+	x := big.NewInt(0)
+	for j, coefficient := range lagrangeCoefficients(n) {
+		if shares[j] == nil {
+			return nil, errors.New("missing share of product")
+		}
+		x.Add(x, new(big.Int).Mul(coefficient, shares[j]))
+	}
+	delta := factorial(n)
+	delta3 := new(big.Int).Mul(delta, delta)
+	delta3.Mul(delta3, delta)
+	x, rem := x.QuoRem(x, delta3, new(big.Int))
+	if rem.Sign() != 0 || x.Sign() <= 0 {
+		return nil, errors.New("inconsistent shares of product")
+	}
+	return x, nil
+}
+
+// shareInteger shares the secret among the parties 1, ..., n using integer Shamir secret sharing,
+// returning the evaluations at 1, ..., n of f(x) = Delta * secret + sum_{k=1}^{degree} a_k x^k,
+// where Delta = n! and the coefficients a_k are random integers of the specified bit size.
+func shareInteger(random io.Reader, secret *big.Int, degree, n int, bits uint) ([]*big.Int, error) {
+	coefficients := make([]*big.Int, degree+1)
+	coefficients[0] = new(big.Int).Mul(factorial(n), secret)
+	for k := 1; k <= degree; k++ {
+		var err error
+		if coefficients[k], err = common.RandomBigIntFrom(random, bits); err != nil {
+			return nil, err
+		}
+	}
+	shares := make([]*big.Int, n)
+	for j := range shares {
+		// Horner's method
+		x := big.NewInt(int64(j + 1))
+		share := big.NewInt(0)
+		for k := degree; k >= 0; k-- {
+			share.Mul(share, x).Add(share, coefficients[k])
+		}
+		shares[j] = share
+	}
+	return shares, nil
+}
+
+// lagrangeCoefficients returns the integers Delta * L_j(0) for j = 1, ..., n, where L_j are the
+// Lagrange basis polynomials for the points 1, ..., n and Delta = n!.
+func lagrangeCoefficients(n int) []*big.Int {
+	coefficients := make([]*big.Int, n)
+	for j := 1; j <= n; j++ {
+		num, den := factorial(n), big.NewInt(1)
+		for k := 1; k <= n; k++ {
+			if k == j {
+				continue
+			}
+			num.Mul(num, big.NewInt(int64(k)))
+			den.Mul(den, big.NewInt(int64(k-j)))
+		}
+		coefficients[j-1] = num.Quo(num, den)
+	}
+	return coefficients
+}
+
+// factorial returns n!.
+func factorial(n int) *big.Int {
+	return new(big.Int).MulRange(1, int64(n))
+}
+
+// IssueSignature produces an IssueSignatureMessage like Issuer.IssueSignature(), running the
+// threshold signing protocol among the signers.
+func (i *ThresholdIssuer) IssueSignature(U *big.Int, attributes []*big.Int, witness *revocation.Witness, nonce2 *big.Int, blind []int) (*IssueSignatureMessage, error) {
+	ms, mIssuer, err := issuerMessageBlock(i.Rand, i.Pk, attributes, blind, nil)
+	if err != nil {
+		return nil, err
+	}
+	Q, e, v, err := prepareSignature(i.Rand, i.Pk, U, ms)
+	if err != nil {
+		return nil, err
+	}
+	A, proof, err := i.sign(Q, e, nonce2)
+	if err != nil {
+		return nil, err
+	}
+	signature := &CLSignature{A: A, E: e, V: v}
+	return &IssueSignatureMessage{Signature: signature, Proof: proof, NonRevocationWitness: witness, MIssuer: mIssuer}, nil
+}
+
+// sign runs the threshold signing protocol, returning the e-th root A of Q and the ProofS.
+func (i *ThresholdIssuer) sign(Q, e, nonce2 *big.Int) (*big.Int, *ProofS, error) {
+	n := len(i.Signers)
+	if n < 3 {
+		return nil, nil, errors.New("threshold signing requires at least 3 parties")
+	}
+	for j, signer := range i.Signers {
+		if signer.Share.Index != j+1 || signer.Share.Parties != n {
+			return nil, nil, errors.New("signers must be ordered by index")
+		}
+	}
+
+	deals := make([][]*ThresholdDeal, n) // by recipient
+	for _, signer := range i.Signers {
+		d, err := signer.Deal(Q, e)
+		if err != nil {
+			return nil, nil, err
+		}
+		for j := range d {
+			deals[j] = append(deals[j], d[j])
+		}
+	}
+
+	products := make([]*big.Int, n)
+	for j, signer := range i.Signers {
+		var err error
+		if products[j], err = signer.Multiply(deals[j]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	A, ACommit := big.NewInt(1), big.NewInt(1)
+	for _, signer := range i.Signers {
+		exp, err := signer.Exponentiate(products)
+		if err != nil {
+			return nil, nil, err
+		}
+		A.Mul(A, exp.A).Mod(A, i.Pk.N)
+		ACommit.Mul(ACommit, exp.ACommit).Mod(ACommit, i.Pk.N)
+	}
+	if new(big.Int).Exp(A, e, i.Pk.N).Cmp(Q) != 0 {
+		return nil, nil, errors.New("threshold signing produced an invalid signature")
+	}
+
+	c := common.HashCommit([]*big.Int{i.Context, Q, A, nonce2, ACommit}, false)
+	eResponse := big.NewInt(0)
+	for _, signer := range i.Signers {
+		response, err := signer.Respond(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		eResponse.Add(eResponse, response)
+	}
+	return A, &ProofS{C: c, EResponse: eResponse}, nil
+}
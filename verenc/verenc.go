@@ -0,0 +1,343 @@
+// Package verenc implements verifiable encryption of attributes to an inspector, following the
+// scheme from "Practical Verifiable Encryption and Decryption of Discrete Logarithms" by Camenisch
+// and Shoup (CS03).
+//
+// The inspector has a public key (n, g, y1, y2, y3) with n = pq a product of safe primes, where
+// g is a random 2n-th power modulo n^2, and y_i = g^(x_i) for secret x_i. Writing h = 1+n, an
+// attribute m < n is encrypted under label L as
+//
+//	u = g^r,  e = y1^r h^m,  v = abs((y2 y3^H(u,e,L))^r)
+//
+// (all modulo n^2) for random r < n/4, where abs(x) = min(x, n^2-x). The prover shows knowledge of
+// r and m such that
+//
+//	u^2 = g^(2r),  e^2 = y1^(2r) h^(2m),  v^2 = (y2 y3^H(u,e,L))^(2r),
+//
+// using for m the same response as in the proof of knowledge of the attribute in the disclosure
+// proof, so that the verifier is convinced that the ciphertext contains the attribute. Only the
+// inspector can decrypt the ciphertext, using the x_i.
+package verenc
+
+import (
+	"io"
+
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+	"github.com/privacybydesign/gabi/safeprime"
+
+	"github.com/go-errors/errors"
+)
+
+type (
+	// PublicKey is the public key of an inspector.
+	PublicKey struct {
+		N  *big.Int `json:"n"`
+		G  *big.Int `json:"g"`
+		Y1 *big.Int `json:"y1"`
+		Y2 *big.Int `json:"y2"`
+		Y3 *big.Int `json:"y3"`
+	}
+
+	// PrivateKey is the private key of an inspector.
+	PrivateKey struct {
+		PublicKey
+		X1 *big.Int `json:"x1"`
+		X2 *big.Int `json:"x2"`
+		X3 *big.Int `json:"x3"`
+	}
+
+	// Ciphertext is an encryption of an attribute under an inspector public key.
+	Ciphertext struct {
+		U *big.Int `json:"u"`
+		E *big.Int `json:"e"`
+		V *big.Int `json:"v"`
+	}
+
+	// Proof is a verifiable encryption of an attribute, along with the responses of a proof that it
+	// encrypts the attribute.
+	Proof struct {
+		Ciphertext *Ciphertext `json:"ciphertext"`
+		Label      []byte      `json:"label,omitempty"`
+		RResponse  *big.Int    `json:"r_response"`
+		MResponse  *big.Int    `json:"-"`
+	}
+
+	// ProofCommit holds the state of the prover between committing and building the proof.
+	ProofCommit struct {
+		ciphertext  *Ciphertext
+		label       []byte
+		r           *big.Int
+		rRandomizer *big.Int
+		m           *big.Int
+		mRandomizer *big.Int
+	}
+)
+
+var (
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+	ErrInvalidKey        = errors.New("invalid inspector public key")
+)
+
+// GenerateKey generates a new inspector private key whose modulus n has the specified amount of
+// bits.
+func GenerateKey(bits int) (*PrivateKey, error) {
+	p, err := safeprime.Generate(bits/2, nil)
+	if err != nil {
+		return nil, err
+	}
+	var q *big.Int
+	for q == nil || q.Cmp(p) == 0 {
+		if q, err = safeprime.Generate(bits-bits/2, nil); err != nil {
+			return nil, err
+		}
+	}
+	return NewPrivateKey(p, q)
+}
+
+// NewPrivateKey generates a new inspector private key from the specified safe primes.
+func NewPrivateKey(p, q *big.Int) (*PrivateKey, error) {
+	return NewPrivateKeyWithRand(nil, p, q)
+}
+
+// NewPrivateKeyWithRand generates a new inspector private key from the specified safe primes,
+// using the specified source of randomness (crypto/rand if nil).
+func NewPrivateKeyWithRand(random io.Reader, p, q *big.Int) (*PrivateKey, error) {
+	random = common.RandReader(random)
+	n := new(big.Int).Mul(p, q)
+	n2 := new(big.Int).Mul(n, n)
+
+	// g = g'^(2n) for random g'
+	gPrime, err := big.RandInt(random, n2)
+	if err != nil {
+		return nil, err
+	}
+	g := new(big.Int).Exp(gPrime, new(big.Int).Lsh(n, 1), n2)
+
+	// x_i random in [0, n^2/4)
+	bound := new(big.Int).Rsh(n2, 2)
+	sk := &PrivateKey{PublicKey: PublicKey{N: n, G: g}}
+	for _, x := range []**big.Int{&sk.X1, &sk.X2, &sk.X3} {
+		if *x, err = big.RandInt(random, bound); err != nil {
+			return nil, err
+		}
+	}
+	sk.Y1 = new(big.Int).Exp(g, sk.X1, n2)
+	sk.Y2 = new(big.Int).Exp(g, sk.X2, n2)
+	sk.Y3 = new(big.Int).Exp(g, sk.X3, n2)
+
+	return sk, nil
+}
+
+func (pk *PublicKey) n2() *big.Int {
+	return new(big.Int).Mul(pk.N, pk.N)
+}
+
+// h returns h^x = (1+n)^x = 1 + x*n mod n^2.
+func (pk *PublicKey) h(x *big.Int, n2 *big.Int) *big.Int {
+	result := new(big.Int).Mul(x, pk.N)
+	result.Add(result, big.NewInt(1))
+	return result.Mod(result, n2)
+}
+
+// abs returns min(x, n^2-x).
+func abs(x, n2 *big.Int) *big.Int {
+	if new(big.Int).Lsh(x, 1).Cmp(n2) > 0 {
+		return new(big.Int).Sub(n2, x)
+	}
+	return new(big.Int).Set(x)
+}
+
+// validElement checks that x is a nonzero element of Z_(n^2).
+func validElement(x, n2 *big.Int) bool {
+	return x != nil && x.Sign() > 0 && x.Cmp(n2) < 0
+}
+
+// Validate checks that the public key is well-formed.
+func (pk *PublicKey) Validate() error {
+	if pk.N == nil || pk.N.BitLen() < 1024 {
+		return ErrInvalidKey
+	}
+	n2 := pk.n2()
+	for _, x := range []*big.Int{pk.G, pk.Y1, pk.Y2, pk.Y3} {
+		if !validElement(x, n2) {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// Equal returns whether pk and other are the same public key.
+func (pk *PublicKey) Equal(other *PublicKey) bool {
+	if pk == nil || other == nil {
+		return pk == other
+	}
+	return pk.N.Cmp(other.N) == 0 && pk.G.Cmp(other.G) == 0 &&
+		pk.Y1.Cmp(other.Y1) == 0 && pk.Y2.Cmp(other.Y2) == 0 && pk.Y3.Cmp(other.Y3) == 0
+}
+
+// hash computes the hash H(u, e, L) binding v to the rest of the ciphertext and the label.
+func hash(ct *Ciphertext, label []byte) *big.Int {
+	return common.HashCommit([]*big.Int{ct.U, ct.E, common.IntHashSha256(label)}, false)
+}
+
+// vBase returns y2 y3^H(u,e,L).
+func (pk *PublicKey) vBase(ct *Ciphertext, label []byte, n2 *big.Int) *big.Int {
+	w := new(big.Int).Exp(pk.Y3, hash(ct, label), n2)
+	return w.Mul(w, pk.Y2).Mod(w, n2)
+}
+
+// rBitLen returns the size of r, such that r < n/4.
+func (pk *PublicKey) rBitLen() uint {
+	return uint(pk.N.BitLen() - 3)
+}
+
+// NewProofCommit encrypts m under the public key and label, and computes the commitments of the
+// proof that the ciphertext contains m, using mRandomizer as randomizer for m.
+func NewProofCommit(pk *PublicKey, params *gabikeys.SystemParameters, m, mRandomizer *big.Int, label []byte) ([]*big.Int, *ProofCommit, error) {
+	return NewProofCommitWithRand(nil, pk, params, m, mRandomizer, label)
+}
+
+// NewProofCommitWithRand is like NewProofCommit(), using the specified source of randomness
+// (crypto/rand if nil).
+func NewProofCommitWithRand(
+	random io.Reader, pk *PublicKey, params *gabikeys.SystemParameters, m, mRandomizer *big.Int, label []byte,
+) ([]*big.Int, *ProofCommit, error) {
+	if err := pk.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if m.Sign() < 0 || m.Cmp(pk.N) >= 0 {
+		return nil, nil, errors.New("attribute too large to be encrypted")
+	}
+
+	var err error
+	n2 := pk.n2()
+	commit := &ProofCommit{
+		label:       label,
+		m:           m,
+		mRandomizer: mRandomizer,
+	}
+	if commit.r, err = common.RandomBigIntFrom(random, pk.rBitLen()); err != nil {
+		return nil, nil, err
+	}
+	if commit.rRandomizer, err = common.RandomBigIntFrom(random, pk.rBitLen()+params.Lh+params.Lstatzk); err != nil {
+		return nil, nil, err
+	}
+
+	// Encrypt m
+	ct := &Ciphertext{U: new(big.Int).Exp(pk.G, commit.r, n2)}
+	ct.E = new(big.Int).Exp(pk.Y1, commit.r, n2)
+	ct.E.Mul(ct.E, pk.h(m, n2)).Mod(ct.E, n2)
+	w := pk.vBase(ct, label, n2)
+	ct.V = abs(new(big.Int).Exp(w, commit.r, n2), n2)
+	commit.ciphertext = ct
+
+	// Commitments to the squared relations
+	r2 := new(big.Int).Lsh(commit.rRandomizer, 1)
+	tE := new(big.Int).Exp(pk.Y1, r2, n2)
+	tE.Mul(tE, pk.h(new(big.Int).Lsh(mRandomizer, 1), n2)).Mod(tE, n2)
+
+	return []*big.Int{
+		ct.U, ct.E, ct.V,
+		new(big.Int).Exp(pk.G, r2, n2),
+		tE,
+		new(big.Int).Exp(w, r2, n2),
+	}, commit, nil
+}
+
+// BuildProof builds the proof using the specified challenge.
+func (c *ProofCommit) BuildProof(challenge *big.Int) *Proof {
+	return &Proof{
+		Ciphertext: &Ciphertext{
+			U: new(big.Int).Set(c.ciphertext.U),
+			E: new(big.Int).Set(c.ciphertext.E),
+			V: new(big.Int).Set(c.ciphertext.V),
+		},
+		Label:     c.label,
+		RResponse: new(big.Int).Add(new(big.Int).Mul(challenge, c.r), c.rRandomizer),
+		MResponse: new(big.Int).Add(new(big.Int).Mul(challenge, c.m), c.mRandomizer),
+	}
+}
+
+// VerifyProofStructure checks that the proof is well-formed. The size of MResponse is not checked
+// here, as it is checked by the proof of knowledge of the attribute.
+func (p *Proof) VerifyProofStructure(pk *PublicKey, params *gabikeys.SystemParameters) bool {
+	if pk.Validate() != nil || p.Ciphertext == nil || p.RResponse == nil || p.MResponse == nil {
+		return false
+	}
+	n2 := pk.n2()
+	ct := p.Ciphertext
+	if !validElement(ct.U, n2) || !validElement(ct.E, n2) || !validElement(ct.V, n2) ||
+		abs(ct.V, n2).Cmp(ct.V) != 0 {
+		return false
+	}
+	return p.RResponse.Sign() >= 0 &&
+		uint(p.RResponse.BitLen()) <= pk.rBitLen()+params.Lh+params.Lstatzk+1
+}
+
+// CommitmentsFromProof reconstructs the commitments of the proof from its responses and the
+// challenge.
+func (p *Proof) CommitmentsFromProof(pk *PublicKey, challenge *big.Int) ([]*big.Int, error) {
+	n2 := pk.n2()
+	ct := p.Ciphertext
+	minusC := new(big.Int).Neg(challenge)
+	minus2C := new(big.Int).Lsh(minusC, 1)
+	r2 := new(big.Int).Lsh(p.RResponse, 1)
+	m2 := new(big.Int).Lsh(p.MResponse, 1)
+
+	// t_u = u^(-2c) g^(2 s_r)
+	tU, err := common.ModPow(ct.U, minus2C, n2)
+	if err != nil {
+		return nil, err
+	}
+	tU.Mul(tU, new(big.Int).Exp(pk.G, r2, n2)).Mod(tU, n2)
+
+	// t_e = e^(-2c) y1^(2 s_r) h^(2 s_m)
+	tE, err := common.ModPow(ct.E, minus2C, n2)
+	if err != nil {
+		return nil, err
+	}
+	tE.Mul(tE, new(big.Int).Exp(pk.Y1, r2, n2)).Mod(tE, n2)
+	tE.Mul(tE, pk.h(m2, n2)).Mod(tE, n2)
+
+	// t_v = v^(-2c) (y2 y3^H)^(2 s_r)
+	tV, err := common.ModPow(ct.V, minus2C, n2)
+	if err != nil {
+		return nil, err
+	}
+	tV.Mul(tV, new(big.Int).Exp(pk.vBase(ct, p.Label, n2), r2, n2)).Mod(tV, n2)
+
+	return []*big.Int{ct.U, ct.E, ct.V, tU, tE, tV}, nil
+}
+
+// Decrypt decrypts the ciphertext, which must have been encrypted under the specified label.
+func (sk *PrivateKey) Decrypt(ct *Ciphertext, label []byte) (*big.Int, error) {
+	n2 := sk.n2()
+	if ct == nil || !validElement(ct.U, n2) || !validElement(ct.E, n2) || !validElement(ct.V, n2) ||
+		abs(ct.V, n2).Cmp(ct.V) != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+
+	// Check v^2 = u^(2(x2 + H x3))
+	exp := new(big.Int).Mul(hash(ct, label), sk.X3)
+	exp.Add(exp, sk.X2).Lsh(exp, 1)
+	if new(big.Int).Exp(ct.U, exp, n2).Cmp(new(big.Int).Exp(ct.V, big.NewInt(2), n2)) != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+
+	// mhat = (e / u^x1)^(2t) with t = 2^-1 mod n
+	t := new(big.Int).ModInverse(big.NewInt(2), sk.N)
+	mhat, err := common.ModPow(ct.U, new(big.Int).Neg(sk.X1), n2)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	mhat.Mul(mhat, ct.E).Mod(mhat, n2)
+	mhat.Exp(mhat, t.Lsh(t, 1), n2)
+
+	// mhat must be of the form h^m = 1 + m*n
+	m := new(big.Int).Sub(mhat, big.NewInt(1))
+	if new(big.Int).Mod(m, sk.N).Sign() != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	return m.Quo(m, sk.N), nil
+}
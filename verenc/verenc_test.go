@@ -0,0 +1,107 @@
+package verenc
+
+import (
+	"testing"
+
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey *PrivateKey
+
+func setupKey(t *testing.T) *PrivateKey {
+	if testKey == nil {
+		var err error
+		testKey, err = GenerateKey(1024)
+		require.NoError(t, err)
+	}
+	return testKey
+}
+
+func buildProof(t *testing.T, pk *PublicKey, m *big.Int, label []byte) ([]*big.Int, *Proof, *big.Int) {
+	params := gabikeys.DefaultSystemParameters[1024]
+	mRandomizer, err := common.RandomBigInt(params.LmCommit)
+	require.NoError(t, err)
+	commitments, commit, err := NewProofCommit(pk, params, m, mRandomizer, label)
+	require.NoError(t, err)
+
+	challenge := common.HashCommit(commitments, false)
+	return commitments, commit.BuildProof(challenge), challenge
+}
+
+func TestVerifiableEncryption(t *testing.T) {
+	sk := setupKey(t)
+	params := gabikeys.DefaultSystemParameters[1024]
+	m := big.NewInt(123456789)
+	label := []byte("label")
+
+	commitments, proof, challenge := buildProof(t, &sk.PublicKey, m, label)
+	require.True(t, proof.VerifyProofStructure(&sk.PublicKey, params))
+	reconstructed, err := proof.CommitmentsFromProof(&sk.PublicKey, challenge)
+	require.NoError(t, err)
+	assert.Equal(t, commitments, reconstructed)
+
+	decrypted, err := sk.Decrypt(proof.Ciphertext, label)
+	require.NoError(t, err)
+	assert.Equal(t, m, decrypted)
+}
+
+func TestVerifiableEncryptionWrongAttribute(t *testing.T) {
+	sk := setupKey(t)
+	_, proof, challenge := buildProof(t, &sk.PublicKey, big.NewInt(5), nil)
+
+	proof.MResponse.Add(proof.MResponse, challenge) // response for m = 6
+	_, proof2, _ := buildProof(t, &sk.PublicKey, big.NewInt(6), nil)
+	reconstructed, err := proof.CommitmentsFromProof(&sk.PublicKey, challenge)
+	require.NoError(t, err)
+	commitments, err := proof2.CommitmentsFromProof(&sk.PublicKey, challenge)
+	require.NoError(t, err)
+	assert.NotEqual(t, commitments[4], reconstructed[4])
+}
+
+func TestVerifiableEncryptionWrongLabel(t *testing.T) {
+	sk := setupKey(t)
+	_, proof, _ := buildProof(t, &sk.PublicKey, big.NewInt(42), []byte("label"))
+
+	_, err := sk.Decrypt(proof.Ciphertext, []byte("other label"))
+	assert.Equal(t, ErrInvalidCiphertext, err)
+}
+
+func TestVerifiableEncryptionTamperedCiphertext(t *testing.T) {
+	sk := setupKey(t)
+	params := gabikeys.DefaultSystemParameters[1024]
+	commitments, proof, challenge := buildProof(t, &sk.PublicKey, big.NewInt(42), nil)
+
+	proof.Ciphertext.E.Mul(proof.Ciphertext.E, big.NewInt(2)).Mod(proof.Ciphertext.E, new(big.Int).Mul(sk.N, sk.N))
+	_, err := sk.Decrypt(proof.Ciphertext, nil)
+	assert.Equal(t, ErrInvalidCiphertext, err)
+
+	require.True(t, proof.VerifyProofStructure(&sk.PublicKey, params))
+	reconstructed, err := proof.CommitmentsFromProof(&sk.PublicKey, challenge)
+	require.NoError(t, err)
+	assert.NotEqual(t, commitments, reconstructed)
+}
+
+func TestVerifiableEncryptionProofStructure(t *testing.T) {
+	sk := setupKey(t)
+	params := gabikeys.DefaultSystemParameters[1024]
+	_, proof, _ := buildProof(t, &sk.PublicKey, big.NewInt(42), nil)
+
+	n2 := new(big.Int).Mul(sk.N, sk.N)
+	proof.Ciphertext.V = new(big.Int).Sub(n2, proof.Ciphertext.V)
+	assert.False(t, proof.VerifyProofStructure(&sk.PublicKey, params))
+
+	_, proof, _ = buildProof(t, &sk.PublicKey, big.NewInt(42), nil)
+	proof.RResponse.Lsh(proof.RResponse, 8)
+	assert.False(t, proof.VerifyProofStructure(&sk.PublicKey, params))
+}
+
+func TestVerifiableEncryptionAttributeTooLarge(t *testing.T) {
+	sk := setupKey(t)
+	params := gabikeys.DefaultSystemParameters[1024]
+	_, _, err := NewProofCommit(&sk.PublicKey, params, sk.N, big.NewInt(1), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package gabi
+
+import (
+	"io"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/gabi/gabikeys"
+	"github.com/privacybydesign/gabi/verenc"
+)
+
+// VerifiableEncryptionBuilder is a ProofBuilder that encrypts an undisclosed attribute of a
+// DisclosureProofBuilder under the public key of an inspector, along with a proof that the
+// ciphertext contains the attribute (see the verenc package). Both builders must be part of the
+// same ProofBuilderList; the attribute is linked to the resulting ProofD by using the same
+// randomizer for it.
+//
+// The attribute is encrypted as it is proven in the ProofD, i.e., attributes larger than the
+// attribute size of the issuer public key are encrypted as their hash.
+type VerifiableEncryptionBuilder struct {
+	disclosure *DisclosureProofBuilder
+	index      int
+	inspector  *verenc.PublicKey
+	label      []byte
+
+	proofIndex int
+	commit     *verenc.ProofCommit
+	randomizer *big.Int
+}
+
+// ProofVerEnc represents a verifiable encryption of an undisclosed attribute of a ProofD in the
+// same ProofList. Verifiers should check that Inspector is the public key of the intended
+// inspector, and that Label is as expected.
+type ProofVerEnc struct {
+	C          *big.Int          `json:"c"`
+	Inspector  *verenc.PublicKey `json:"inspector"`
+	ProofIndex int               `json:"proof"`
+	Attribute  int               `json:"attribute"`
+	Encryption *verenc.Proof     `json:"encryption"`
+}
+
+// NewVerifiableEncryptionBuilder creates a builder encrypting the undisclosed attribute with the
+// specified index of the disclosure proof builder under the public key of the inspector. The
+// label is bound to the ciphertext, and is required for decryption. The secret key cannot be
+// encrypted, as it may be shared with a keyshare server.
+func NewVerifiableEncryptionBuilder(
+	disclosure *DisclosureProofBuilder, index int, inspector *verenc.PublicKey, label []byte,
+) (*VerifiableEncryptionBuilder, error) {
+	if index <= 0 || index >= len(disclosure.attributes) ||
+		!isUndisclosedAttribute(disclosure.disclosedAttributes, index) {
+		return nil, errors.New("can only encrypt undisclosed attributes other than the secret key")
+	}
+	if err := inspector.Validate(); err != nil {
+		return nil, err
+	}
+	return &VerifiableEncryptionBuilder{
+		disclosure: disclosure,
+		index:      index,
+		inspector:  inspector,
+		label:      label,
+	}, nil
+}
+
+// resolveCrossAttributes looks up the position of the disclosure proof builder in the list,
+// along with the randomizer it uses for the attribute.
+func (b *VerifiableEncryptionBuilder) resolveCrossAttributes(builders ProofBuilderList, randomizers map[string]*big.Int) error {
+	b.proofIndex = -1
+	for i, builder := range builders {
+		if builder == b.disclosure {
+			b.proofIndex = i
+			break
+		}
+	}
+	if b.proofIndex < 0 {
+		return errors.New("disclosure proof builder of verifiable encryption not in list")
+	}
+	b.randomizer = b.disclosure.attributeRandomizer(b.index, randomizers)
+	return nil
+}
+
+// Commit encrypts the attribute and commits to the randomness of the encryption and to the
+// attribute, using the randomizer of the attribute in the disclosure proof builder.
+func (b *VerifiableEncryptionBuilder) Commit(map[string]*big.Int) ([]*big.Int, error) {
+	if b.randomizer == nil {
+		return nil, errors.New("verifiable encryption builder must be used in a ProofBuilderList")
+	}
+	commitments, commit, err := verenc.NewProofCommitWithRand(
+		b.disclosure.random, b.inspector, b.disclosure.pk.Params,
+		b.disclosure.attributeExponent(b.index), b.randomizer, b.label,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.commit = commit
+	return commitments, nil
+}
+
+// randomSource returns the source of randomness of the disclosure proof builder, which is also
+// used for the encryption.
+func (b *VerifiableEncryptionBuilder) randomSource() io.Reader {
+	return b.disclosure.random
+}
+
+// CreateProof creates a verifiable encryption proof with the provided challenge.
+func (b *VerifiableEncryptionBuilder) CreateProof(challenge *big.Int) Proof {
+	return &ProofVerEnc{
+		C:          new(big.Int).Set(challenge),
+		Inspector:  b.inspector,
+		ProofIndex: b.proofIndex,
+		Attribute:  b.index,
+		Encryption: b.commit.BuildProof(challenge),
+	}
+}
+
+// PublicKey returns the issuer public key of the disclosure proof builder whose attribute is
+// encrypted. Verifiers should pass the same public key for the ProofVerEnc as for the ProofD.
+func (b *VerifiableEncryptionBuilder) PublicKey() *gabikeys.PublicKey {
+	return b.disclosure.pk
+}
+
+// MergeProofPCommitment does nothing, as the secret key is not encrypted.
+func (b *VerifiableEncryptionBuilder) MergeProofPCommitment(*ProofPCommitment) {}
+
+// setCrossResponses sets the response of the encrypted attribute from the ProofD it refers to.
+func (p *ProofVerEnc) setCrossResponses(pl ProofList) error {
+	if p.Encryption == nil {
+		return errors.New("incomplete verifiable encryption proof")
+	}
+	if p.ProofIndex < 0 || p.ProofIndex >= len(pl) {
+		return errors.New("verifiable encryption relates to nonexisting proof")
+	}
+	other, ok := pl[p.ProofIndex].(*ProofD)
+	if !ok || p.Attribute == 0 || other.attributeResponse(p.Attribute) == nil {
+		return errors.New("verifiable encryption relates to disclosed or nonexisting attribute")
+	}
+	p.Encryption.MResponse = new(big.Int).Set(other.attributeResponse(p.Attribute))
+	return nil
+}
+
+// VerifyWithChallenge verifies whether the proof is correct. The proof itself was already
+// validated during challenge reconstruction.
+func (p *ProofVerEnc) VerifyWithChallenge(_ *gabikeys.PublicKey, reconstructedChallenge *big.Int) bool {
+	return p.C != nil && p.C.Cmp(reconstructedChallenge) == 0
+}
+
+// ChallengeContribution returns the contribution of this proof to the challenge. The response of
+// the encrypted attribute must have been set by ProofList.Verify().
+func (p *ProofVerEnc) ChallengeContribution(pk *gabikeys.PublicKey) ([]*big.Int, error) {
+	if pk == nil || p.C == nil || p.Inspector == nil || p.Encryption == nil {
+		return nil, errors.New("incomplete verifiable encryption proof")
+	}
+	if !p.Encryption.VerifyProofStructure(p.Inspector, pk.Params) {
+		return nil, errors.New("invalid verifiable encryption proof")
+	}
+	return p.Encryption.CommitmentsFromProof(p.Inspector, p.C)
+}
+
+// SecretKeyResponse returns nil, as the secret key is not involved in this proof.
+func (p *ProofVerEnc) SecretKeyResponse() *big.Int {
+	return nil
+}
+
+func (p *ProofVerEnc) withoutSecretKey() {}
+
+// MergeProofP does nothing, as the secret key is not encrypted.
+func (p *ProofVerEnc) MergeProofP(*ProofP, *gabikeys.PublicKey) {}
+
+// Decrypt decrypts the attribute using the private key of the inspector. This does not verify
+// the proof, which should be done using ProofList.Verify().
+func (p *ProofVerEnc) Decrypt(sk *verenc.PrivateKey) (*big.Int, error) {
+	if p.Encryption == nil {
+		return nil, errors.New("incomplete verifiable encryption proof")
+	}
+	if !sk.PublicKey.Equal(p.Inspector) {
+		return nil, errors.New("attribute was encrypted for another inspector")
+	}
+	return sk.Decrypt(p.Encryption.Ciphertext, p.Encryption.Label)
+}
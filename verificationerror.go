@@ -0,0 +1,86 @@
+package gabi
+
+import (
+	"fmt"
+
+	"github.com/go-errors/errors"
+)
+
+// Checks performed during verification, one of which is referred to by each VerificationError.
+// Use errors.Is() to determine which check failed:
+//
+//	if errors.Is(err, gabi.ErrChallenge) { ... }
+var (
+	ErrEmptyProofList      = errors.New("empty proof list")
+	ErrPublicKeyMismatch   = errors.New("amount of public keys or keyshare servers does not match amount of proofs")
+	ErrMalformedProof      = errors.New("malformed proof")
+	ErrChallenge           = errors.New("challenge mismatch")
+	ErrResponseSize        = errors.New("response out of range")
+	ErrRangeProof          = errors.New("invalid range proof")
+	ErrSetMembershipProof  = errors.New("invalid set membership proof")
+	ErrAttributeCommitment = errors.New("invalid attribute commitment")
+	ErrShowTag             = errors.New("invalid show tag")
+	ErrNonRevocation       = errors.New("invalid nonrevocation proof")
+	ErrSecretKeyMismatch   = errors.New("secret key responses do not match")
+	ErrAttributeLink       = errors.New("linked attributes do not match")
+	ErrSignatureE          = errors.New("signature e out of range or not prime")
+	ErrSignature           = errors.New("signature equation does not hold")
+)
+
+// VerificationError describes why a proof, proof list or signature is invalid. It matches the
+// failed check (e.g. ErrChallenge) under errors.Is(), and unwraps to the underlying error, if any.
+type VerificationError struct {
+	// Proof is the index of the invalid proof within its ProofList,
+	// or -1 if the failure does not concern a particular proof of a ProofList.
+	Proof int
+	// Check is the failed check, i.e. one of the Err... variables above.
+	Check error
+	// Err is the error that caused the check to fail, if any.
+	Err error
+}
+
+// verificationError returns a VerificationError for the failed check that does not (yet) refer
+// to a proof in a ProofList.
+func verificationError(check, err error) *VerificationError {
+	return &VerificationError{Proof: -1, Check: check, Err: err}
+}
+
+// asVerificationError returns the non-nil error as a VerificationError, considering errors that
+// are not VerificationErrors to be due to a malformed proof.
+func asVerificationError(err error) *VerificationError {
+	if verr, ok := err.(*VerificationError); ok {
+		return verr
+	}
+	return verificationError(ErrMalformedProof, err)
+}
+
+// atProof returns the error as a VerificationError referring to the specified proof, considering
+// errors that are not VerificationErrors to be due to a malformed proof.
+func atProof(index int, err error) error {
+	if err == nil {
+		return nil
+	}
+	verr := asVerificationError(err)
+	return &VerificationError{Proof: index, Check: verr.Check, Err: verr.Err}
+}
+
+func (e *VerificationError) Error() string {
+	msg := e.Check.Error()
+	if e.Proof >= 0 {
+		msg = fmt.Sprintf("proof %d: %s", e.Proof, msg)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is returns whether target is the failed check.
+func (e *VerificationError) Is(target error) bool {
+	return target == e.Check
+}
+
+// Unwrap returns the error that caused the check to fail.
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
@@ -2,6 +2,7 @@ package zkproof
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/bwesterb/go-exptable"
 	"github.com/privacybydesign/gabi/big"
@@ -19,6 +20,10 @@ type Group struct {
 
 	PMod     common.FastMod
 	OrderMod common.FastMod
+
+	// Rand is the source of randomness of proofs in this group. If nil, a fast CPRNG
+	// seeded from crypto/rand is used (see common.FastRandomBigInt()).
+	Rand io.Reader
 }
 
 func BuildGroup(prime *big.Int) (Group, bool) {